@@ -30,6 +30,7 @@ import (
 	servingclientset "github.com/knative/serving/pkg/client/clientset/versioned"
 	servinginformers "github.com/knative/serving/pkg/client/informers/externalversions"
 	"github.com/knative/serving/pkg/reconciler"
+	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
@@ -110,6 +111,7 @@ func main() {
 		StopChannel:      stopCh,
 	}
 
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, opt.ResyncPeriod)
 	kfInformerFactory := informers.NewSharedInformerFactory(kfClient, opt.ResyncPeriod)
 	servingInformerFactory := servinginformers.NewSharedInformerFactory(servingClient, opt.ResyncPeriod)
 	eventingInformerFactory := eventinginformers.NewSharedInformerFactory(eventingClient, opt.ResyncPeriod)
@@ -119,6 +121,10 @@ func main() {
 	transformInformer := kfInformerFactory.Kfilter().V1alpha1().Transforms()
 	serviceInformer := servingInformerFactory.Serving().V1alpha1().Services()
 	channelInformer := eventingInformerFactory.Eventing().V1alpha1().Channels()
+	configMapInformer := kubeInformerFactory.Core().V1().ConfigMaps()
+	serviceAccountInformer := kubeInformerFactory.Core().V1().ServiceAccounts()
+	roleInformer := kubeInformerFactory.Rbac().V1().Roles()
+	roleBindingInformer := kubeInformerFactory.Rbac().V1().RoleBindings()
 
 	// Add new controllers here.
 	controllers := []*controller.Impl{
@@ -127,6 +133,10 @@ func main() {
 			kfClient,
 			serviceInformer,
 			filterInformer,
+			configMapInformer,
+			serviceAccountInformer,
+			roleInformer,
+			roleBindingInformer,
 			*filterImage,
 		),
 		ktransform.NewController(
@@ -134,6 +144,10 @@ func main() {
 			kfClient,
 			serviceInformer,
 			transformInformer,
+			configMapInformer,
+			serviceAccountInformer,
+			roleInformer,
+			roleBindingInformer,
 			*transformImage,
 		),
 		khannel.NewController(
@@ -145,6 +159,7 @@ func main() {
 		),
 	}
 
+	go kubeInformerFactory.Start(stopCh)
 	go kfInformerFactory.Start(stopCh)
 	go servingInformerFactory.Start(stopCh)
 	go eventingInformerFactory.Start(stopCh)
@@ -156,6 +171,10 @@ func main() {
 		filterInformer.Informer().HasSynced,
 		transformInformer.Informer().HasSynced,
 		channelInformer.Informer().HasSynced,
+		configMapInformer.Informer().HasSynced,
+		serviceAccountInformer.Informer().HasSynced,
+		roleInformer.Informer().HasSynced,
+		roleBindingInformer.Informer().HasSynced,
 	} {
 		if ok := cache.WaitForCacheSync(stopCh, synced); !ok {
 			logger.Fatalf("failed to wait for cache at index %v to sync", i)
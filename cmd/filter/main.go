@@ -17,108 +17,71 @@ limitations under the License.
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"expvar"
 	"flag"
 	"log"
 	"net/http"
-	"time"
+	"os"
 
-	"github.com/knative/pkg/cloudevents"
-
-	"github.com/mattmoor/kfilter/pkg/filter"
+	"github.com/mattmoor/kfilter/pkg/bundle"
+	"github.com/mattmoor/kfilter/pkg/dataplane"
 )
 
 var (
-	filterType    = flag.String("type", "", "The event type to keep.")
-	encodedFilter = flag.String("filter", "", "The base64 encoded filter expression.")
-)
-
-type Filter struct {
-	m filter.Matcher
-}
-
-func (f *Filter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-
-	var body json.RawMessage
-	ctx, err := cloudevents.Binary.FromRequest(&body, r)
-	if err != nil {
-		log.Printf("Failed to parse events from the request: %s", err)
-		// TODO: Actually fail this request?
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-	log.Printf("Received Context: %+v", ctx)
-	log.Printf("Received body as: %#v", string(body))
-
-	var unstructured map[string]interface{}
-	err = json.Unmarshal(body, &unstructured)
-	if err != nil {
-		log.Printf("Failed to unmarshal payload: %s", err)
-		// TODO: Actually fail this request?
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	// If specified, only let pull request events through.
-	if *filterType != "" {
-		if ctx.EventType != *filterType {
-			log.Printf("Skipping: %q", ctx.EventType)
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-	}
-
-	// Check to see if the compiled filter matches the body.
-	if !f.m.Match(unstructured) {
-		log.Printf("Skipping: %q", ctx.EventType)
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	setHeaders(ctx, w.Header())
-	w.Write(body)
-}
+	// flags are parsed from the args of the process.  With a bundle, the
+	// Filter is configured by the args in the bundle instead (which
+	// replace it whenever the bundle changes).
+	flags = flag.NewFlagSet("filter", flag.ExitOnError)
 
-func setHeaders(context *cloudevents.EventContext, header http.Header) {
-	// These are required ones.
-	header.Add(cloudevents.HeaderCloudEventsVersion, cloudevents.CloudEventsVersion)
-	header.Add(cloudevents.HeaderEventID, context.EventID)
-	header.Add(cloudevents.HeaderEventType, context.EventType)
-	header.Add(cloudevents.HeaderSource, context.Source)
+	bundleKey = flags.String("bundle", "", "The namespace/name of the ConfigMap that holds the rest of the args.")
 
-	header.Add(cloudevents.HeaderEventTime, context.EventTime.Format(time.RFC3339Nano))
-	if context.EventTypeVersion != "" {
-		header.Add(cloudevents.HeaderEventTypeVersion, context.EventTypeVersion)
-	}
-	if context.SchemaURL != "" {
-		header.Add(cloudevents.HeaderSchemaURL, context.SchemaURL)
-	}
-	header.Add(cloudevents.HeaderContentType, context.ContentType)
-}
+	configure = dataplane.FilterFlags(flags)
+)
 
 func main() {
-	flag.Parse()
-
-	expression, err := base64.StdEncoding.DecodeString(*encodedFilter)
-	if err != nil {
-		log.Fatalf("Unable to decode filter expression: %v", err)
-	}
-	log.Printf("Got filter expression: %v", string(expression))
-
-	var unstructured map[string]interface{}
-	if err := json.Unmarshal([]byte(expression), &unstructured); err != nil {
-		log.Fatalf("Unable to unmarshal filter expression: %v", err)
-	}
-
-	matcher, err := filter.Compile(unstructured)
-	if err != nil {
-		log.Fatalf("Unable to compile filter expression: %v", err)
-	}
-
-	f := &Filter{
-		m: matcher,
+	flags.Parse(os.Args[1:])
+	key := *bundleKey
+
+	mux := http.NewServeMux()
+	var h bundle.Handler
+	if key == "" {
+		f, err := configure()
+		if err != nil {
+			log.Fatalf("Unable to configure filter: %v", err)
+		}
+		h.Set(f)
+	} else {
+		lw, err := bundle.InCluster(key)
+		if err != nil {
+			log.Fatalf("Unable to access bundle: %v", err)
+		}
+		args, hash, err := bundle.Load(lw)
+		if err != nil {
+			log.Fatalf("Unable to load bundle: %v", err)
+		}
+		f, err := dataplane.ParseFilter(args)
+		if err != nil {
+			log.Fatalf("Unable to configure filter: %v", err)
+		}
+		h.Set(f)
+
+		// Swap in the new Filter whenever the bundle changes.  Note that
+		// this starts over the events that it has seen and throttled.
+		w := bundle.NewWatcher(lw, hash, func(args []string) error {
+			f, err := dataplane.ParseFilter(args)
+			if err != nil {
+				return err
+			}
+			h.Set(f)
+			return nil
+		})
+		go w.Run(make(chan struct{}))
+		// Report rejected bundles on /debug/vars, as well as in the logs.
+		expvar.Publish("bundle", expvar.Func(w.Status))
 	}
 
-	http.ListenAndServe(":8080", f)
+	mux.HandleFunc(bundle.ReadyPath, h.Ready)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/", &h)
+	http.ListenAndServe(":8080", mux)
 }
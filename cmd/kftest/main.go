@@ -0,0 +1,192 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kftest runs the tests embedded in the Filters and Transforms in the given
+// YAML files, e.g. before applying them.  ConfigMaps in the same files are
+// used to resolve the references of their specs (e.g. libraries).
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/spectest"
+)
+
+// separator splits YAML files into their documents.
+var separator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// resources holds the objects read from the files, in order.
+type resources struct {
+	filters    []*kfv1alpha1.Filter
+	transforms []*kfv1alpha1.Transform
+	configMaps map[string]*corev1.ConfigMap
+}
+
+func (r *resources) read(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, doc := range separator.Split(string(b), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		var tm metav1.TypeMeta
+		if err := yaml.Unmarshal([]byte(doc), &tm); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		var obj interface{}
+		switch tm.Kind {
+		case "Filter":
+			kf := &kfv1alpha1.Filter{}
+			r.filters = append(r.filters, kf)
+			obj = kf
+		case "Transform":
+			kf := &kfv1alpha1.Transform{}
+			r.transforms = append(r.transforms, kf)
+			obj = kf
+		case "ConfigMap":
+			obj = &corev1.ConfigMap{}
+		default:
+			continue
+		}
+		if err := yaml.Unmarshal([]byte(doc), obj); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if cm, ok := obj.(*corev1.ConfigMap); ok {
+			r.configMaps[cm.Name] = cm
+		}
+	}
+	return nil
+}
+
+// body returns the filter expression that the Filter applies.
+func (r *resources) body(kf *kfv1alpha1.Filter) (json.RawMessage, error) {
+	if kf.Spec.BodyFrom == nil || kf.Spec.BodyFrom.ConfigMapKeyRef == nil {
+		return kf.Spec.Body, nil
+	}
+	ref := kf.Spec.BodyFrom.ConfigMapKeyRef
+	cm, ok := r.configMaps[ref.Name]
+	if !ok {
+		return nil, fmt.Errorf("ConfigMap %q does not exist", ref.Name)
+	}
+	value, ok := cm.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("ConfigMap %q does not have the key %q", ref.Name, ref.Key)
+	}
+	return yaml.YAMLToJSON([]byte(value))
+}
+
+// libraries returns the templates in the ConfigMaps that the Transform
+// lists as libraries, keyed by name.
+func (r *resources) libraries(kf *kfv1alpha1.Transform) (map[string]string, error) {
+	libraries := make(map[string]string)
+	owners := make(map[string]string)
+	for _, ref := range kf.Spec.Libraries {
+		cm, ok := r.configMaps[ref.Name]
+		if !ok {
+			return nil, fmt.Errorf("ConfigMap %q does not exist", ref.Name)
+		}
+		keys := make([]string, 0, len(cm.Data))
+		for key := range cm.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if owner, ok := owners[key]; ok {
+				return nil, fmt.Errorf("ConfigMaps %q and %q both have the key %q", owner, ref.Name, key)
+			}
+			owners[key] = ref.Name
+			libraries[key] = cm.Data[key]
+		}
+	}
+	return libraries, nil
+}
+
+func testFilter(r *resources, kf *kfv1alpha1.Filter) error {
+	body, err := r.body(kf)
+	if err != nil {
+		return err
+	}
+	f, err := spectest.CompileFilter(kf.Spec, body)
+	if err != nil {
+		return err
+	}
+	return f.Test(kf.Spec.Tests)
+}
+
+func testTransform(r *resources, kf *kfv1alpha1.Transform) error {
+	libraries, err := r.libraries(kf)
+	if err != nil {
+		return err
+	}
+	t, err := spectest.CompileTransform(kf, libraries)
+	if err != nil {
+		return err
+	}
+	return t.Test(kf.Spec.Tests)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s FILE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	r := &resources{configMaps: make(map[string]*corev1.ConfigMap)}
+	for _, path := range flag.Args() {
+		if err := r.read(path); err != nil {
+			log.Fatalf("Unable to read resources: %v", err)
+		}
+	}
+
+	failed := false
+	report := func(kind, name string, tests int, err error) {
+		if err != nil {
+			failed = true
+			fmt.Printf("FAIL\t%s/%s: %v\n", kind, name, err)
+			return
+		}
+		fmt.Printf("ok\t%s/%s (%d tests)\n", kind, name, tests)
+	}
+	for _, kf := range r.filters {
+		report("filter", kf.Name, len(kf.Spec.Tests), testFilter(r, kf))
+	}
+	for _, kf := range r.transforms {
+		report("transform", kf.Name, len(kf.Spec.Tests), testTransform(r, kf))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
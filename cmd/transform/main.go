@@ -17,100 +17,102 @@ limitations under the License.
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"context"
+	"expvar"
 	"flag"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
-	"github.com/knative/pkg/cloudevents"
+	"github.com/knative/pkg/signals"
 
-	"github.com/mattmoor/kfilter/pkg/transform"
+	"github.com/mattmoor/kfilter/pkg/bundle"
+	"github.com/mattmoor/kfilter/pkg/dataplane"
 )
 
 var (
-	encodedTransform = flag.String("transform", "", "The base64 encoded transform expression.")
-)
-
-type Transform struct {
-	m transform.Mutator
-}
-
-func (f *Transform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-
-	var body json.RawMessage
-	ctx, err := cloudevents.Binary.FromRequest(&body, r)
-	if err != nil {
-		log.Printf("Failed to parse events from the request: %s", err)
-		// TODO: Actually fail this request?
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-	log.Printf("Received Context: %+v", ctx)
-	log.Printf("Received body as: %#v", string(body))
-
-	var payload map[string]interface{}
-	if err := json.Unmarshal(body, &payload); err != nil {
-		log.Printf("Failed to unmarshal request body: %s", err)
-		// TODO: Actually fail this request?
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	// flags are parsed from the args of the process.  With a bundle, the
+	// Transform is configured by the args in the bundle instead (which
+	// replace it whenever the bundle changes).
+	flags = flag.NewFlagSet("transform", flag.ExitOnError)
 
-	// Apply the compiled transformation to the event body.
-	result, err := f.m.Mutate(payload)
-	if err != nil {
-		log.Printf("Failed to unmarshal payload: %s", err)
-		// TODO: Actually fail this request?
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-	// If the transformation returns null, then filter this message.
-	if string(result) == "null" {
-		log.Printf("Skipping: %q", ctx.EventType)
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	bundleKey = flags.String("bundle", "", "The namespace/name of the ConfigMap that holds the rest of the args.")
 
-	setHeaders(ctx, w.Header())
-	w.Write(result)
-}
-
-func setHeaders(context *cloudevents.EventContext, header http.Header) {
-	// These are required ones.
-	header.Add(cloudevents.HeaderCloudEventsVersion, cloudevents.CloudEventsVersion)
-	header.Add(cloudevents.HeaderEventID, context.EventID)
-	header.Add(cloudevents.HeaderEventType, context.EventType)
-	header.Add(cloudevents.HeaderSource, context.Source)
+	configure = dataplane.TransformFlags(flags)
+)
 
-	header.Add(cloudevents.HeaderEventTime, context.EventTime.Format(time.RFC3339Nano))
-	if context.EventTypeVersion != "" {
-		header.Add(cloudevents.HeaderEventTypeVersion, context.EventTypeVersion)
-	}
-	if context.SchemaURL != "" {
-		header.Add(cloudevents.HeaderSchemaURL, context.SchemaURL)
-	}
-	header.Add(cloudevents.HeaderContentType, context.ContentType)
-}
+// drainTimeout is how long the server waits for the events it is handling
+// on shutdown, before it closes the aggregation windows that are open.
+const drainTimeout = 10 * time.Second
 
 func main() {
-	flag.Parse()
-
-	template, err := base64.StdEncoding.DecodeString(*encodedTransform)
-	if err != nil {
-		log.Fatalf("Unable to decode transform expression: %v", err)
-	}
-	log.Printf("Got transform expression: %v", string(template))
-
-	mutator, err := transform.Compile(string(template))
-	if err != nil {
-		log.Fatalf("Unable to compile transform expression: %v", err)
+	flags.Parse(os.Args[1:])
+	key := *bundleKey
+
+	mux := http.NewServeMux()
+	var h bundle.Handler
+	// set up signals so we handle the first shutdown signal gracefully
+	stopCh := signals.SetupSignalHandler()
+	if key == "" {
+		f, err := configure()
+		if err != nil {
+			log.Fatalf("Unable to configure transform: %v", err)
+		}
+		f.Start()
+		h.Set(f)
+	} else {
+		lw, err := bundle.InCluster(key)
+		if err != nil {
+			log.Fatalf("Unable to access bundle: %v", err)
+		}
+		args, hash, err := bundle.Load(lw)
+		if err != nil {
+			log.Fatalf("Unable to load bundle: %v", err)
+		}
+		f, err := dataplane.ParseTransform(args)
+		if err != nil {
+			log.Fatalf("Unable to configure transform: %v", err)
+		}
+		f.Start()
+		h.Set(f)
+
+		// Swap in the new Transform whenever the bundle changes, and then
+		// close the windows that the old one has open.
+		w := bundle.NewWatcher(lw, hash, func(args []string) error {
+			f, err := dataplane.ParseTransform(args)
+			if err != nil {
+				return err
+			}
+			f.Start()
+			old := h.Get().(*dataplane.Transform)
+			h.Set(f)
+			old.Close()
+			return nil
+		})
+		go w.Run(stopCh)
+		// Report rejected bundles on /debug/vars, as well as in the logs.
+		expvar.Publish("bundle", expvar.Func(w.Status))
 	}
 
-	f := &Transform{
-		m: mutator,
+	mux.HandleFunc(bundle.ReadyPath, h.Ready)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/", &h)
+	srv := &http.Server{Addr: ":8080", Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatalf("Unable to serve: %v", err)
+		}
+	}()
+
+	// On shutdown (which also stops watching the bundle), stop taking
+	// events, and then close the windows that are still open rather than
+	// lose their events.
+	<-stopCh
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Failed to drain events: %v", err)
 	}
-
-	http.ListenAndServe(":8080", f)
+	h.Get().(*dataplane.Transform).Close()
 }
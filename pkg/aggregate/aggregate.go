@@ -0,0 +1,215 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Window identifies a window of a group of events.  Windows contain the
+// events that arrive from Start until (but excluding) End.
+type Window struct {
+	Group string
+	Start time.Time
+	End   time.Time
+}
+
+// Store holds the events of open windows.
+type Store interface {
+	// Append adds the given decoded event to each of the windows, which
+	// belong to the same group.  When it fails, the event is added to none
+	// of them.
+	Append(ws []Window, event interface{}) error
+
+	// Take removes the windows that end at or before the given time, and
+	// returns them along with their events, ordered by their end and then
+	// their group.
+	Take(end time.Time) ([]Result, error)
+}
+
+// Result is a closed window and its events, in order of arrival.
+type Result struct {
+	Window
+	Events []interface{}
+}
+
+// Aggregator assigns events to windows and closes them.
+type Aggregator interface {
+	// Add adds the given decoded event of the given group to the windows
+	// that are open at the given time.
+	Add(group string, t time.Time, event interface{}) error
+
+	// Close returns the windows that have closed by the given time.
+	Close(t time.Time) ([]Result, error)
+}
+
+// MaxOverlap is how many windows an event may be added to at most, which
+// bounds the ratio of the window size to the slide.
+const MaxOverlap = 100
+
+// New returns an Aggregator with windows of the given size, which start
+// every slide (a slide of zero, or of size, makes tumbling windows).
+// Windows start at multiples of the slide (as time.Truncate computes
+// them), and are held in the given Store.
+func New(size, slide time.Duration, store Store) (Aggregator, error) {
+	if slide == 0 {
+		slide = size
+	}
+	switch {
+	case size <= 0:
+		return nil, errors.New("the window size must be positive")
+	case slide < 0 || slide > size:
+		return nil, errors.New("the window slide must be positive, and at most the window size")
+	case size/slide > MaxOverlap:
+		return nil, fmt.Errorf("the window size may be at most %d times the slide", MaxOverlap)
+	}
+	return &aggregator{size: size, slide: slide, store: store}, nil
+}
+
+type aggregator struct {
+	size  time.Duration
+	slide time.Duration
+	store Store
+}
+
+// aggregator implements Aggregator
+var _ Aggregator = (*aggregator)(nil)
+
+func (a *aggregator) Add(group string, t time.Time, event interface{}) error {
+	// The windows that contain t start at multiples of the slide, from
+	// the latest one at or before t back to the earliest that ends after t.
+	var ws []Window
+	for start := t.Truncate(a.slide); start.Add(a.size).After(t); start = start.Add(-a.slide) {
+		ws = append(ws, Window{Group: group, Start: start, End: start.Add(a.size)})
+	}
+	return a.store.Append(ws, event)
+}
+
+func (a *aggregator) Close(t time.Time) ([]Result, error) {
+	return a.store.Take(t)
+}
+
+const (
+	// DefaultMaxGroups is how many groups may have open windows at once
+	// by default.
+	DefaultMaxGroups = 10000
+
+	// DefaultMaxEvents is how many events a window may hold by default.
+	DefaultMaxEvents = 10000
+)
+
+var (
+	// ErrTooManyGroups is returned when an event would open windows for a
+	// group beyond those a Store may hold.
+	ErrTooManyGroups = errors.New("too many groups have open windows")
+
+	// ErrWindowFull is returned when an event would be added to a window
+	// that holds as many events as it may.
+	ErrWindowFull = errors.New("the window holds too many events")
+)
+
+// NewMemory returns a Store that holds windows in memory, for at most
+// maxGroups groups at once and with at most maxEvents events per window
+// (where zero leaves them unbounded).  Events beyond these bounds fail to
+// append, with ErrTooManyGroups or ErrWindowFull, until windows close.
+func NewMemory(maxGroups, maxEvents int) Store {
+	return &memory{
+		maxGroups: maxGroups,
+		maxEvents: maxEvents,
+		windows:   make(map[key]*Result),
+		groups:    make(map[string]int),
+	}
+}
+
+// key identifies a window, without the monotonic clock readings and
+// locations that make time.Time unsuitable as a map key.
+type key struct {
+	group      string
+	start, end int64
+}
+
+type memory struct {
+	maxGroups int
+	maxEvents int
+
+	m       sync.Mutex
+	windows map[key]*Result
+	// groups counts the open windows of each group.
+	groups map[string]int
+}
+
+// memory implements Store
+var _ Store = (*memory)(nil)
+
+func keyOf(w Window) key {
+	return key{group: w.Group, start: w.Start.UnixNano(), end: w.End.UnixNano()}
+}
+
+func (m *memory) Append(ws []Window, event interface{}) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	// Check the bounds before adding the event anywhere.
+	for _, w := range ws {
+		if m.groups[w.Group] == 0 && m.maxGroups != 0 && len(m.groups) >= m.maxGroups {
+			return ErrTooManyGroups
+		}
+		if r, ok := m.windows[keyOf(w)]; ok && m.maxEvents != 0 && len(r.Events) >= m.maxEvents {
+			return ErrWindowFull
+		}
+	}
+
+	for _, w := range ws {
+		k := keyOf(w)
+		r, ok := m.windows[k]
+		if !ok {
+			r = &Result{Window: w}
+			m.windows[k] = r
+			m.groups[w.Group]++
+		}
+		r.Events = append(r.Events, event)
+	}
+	return nil
+}
+
+func (m *memory) Take(end time.Time) ([]Result, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	var results []Result
+	for k, r := range m.windows {
+		if r.End.After(end) {
+			continue
+		}
+		results = append(results, *r)
+		delete(m.windows, k)
+		if m.groups[k.group]--; m.groups[k.group] == 0 {
+			delete(m.groups, k.group)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].End.Equal(results[j].End) {
+			return results[i].End.Before(results[j].End)
+		}
+		return results[i].Group < results[j].Group
+	})
+	return results, nil
+}
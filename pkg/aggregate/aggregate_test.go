@@ -0,0 +1,208 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTumbling(t *testing.T) {
+	a, err := New(time.Minute, 0, NewMemory(0, 0))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	base := time.Date(2019, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, e := range []struct {
+		group  string
+		offset time.Duration
+		event  string
+	}{
+		{"foo", 10 * time.Second, "a"},
+		{"bar", 20 * time.Second, "b"},
+		{"foo", 30 * time.Second, "c"},
+		{"foo", 70 * time.Second, "d"},
+	} {
+		if err := a.Add(e.group, base.Add(e.offset), e.event); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+	}
+
+	got, err := a.Close(base.Add(59 * time.Second))
+	if err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Close() = %v, wanted no windows", got)
+	}
+
+	got, err = a.Close(base.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	want := []Result{{
+		Window: Window{Group: "bar", Start: base, End: base.Add(time.Minute)},
+		Events: []interface{}{"b"},
+	}, {
+		Window: Window{Group: "foo", Start: base, End: base.Add(time.Minute)},
+		Events: []interface{}{"a", "c"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Close() = %v, wanted %v", got, want)
+	}
+
+	// Windows are only returned once.
+	got, err = a.Close(base.Add(2 * time.Minute))
+	if err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	want = []Result{{
+		Window: Window{Group: "foo", Start: base.Add(time.Minute), End: base.Add(2 * time.Minute)},
+		Events: []interface{}{"d"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Close() = %v, wanted %v", got, want)
+	}
+}
+
+func TestSliding(t *testing.T) {
+	a, err := New(time.Minute, 30*time.Second, NewMemory(0, 0))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	base := time.Date(2019, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, e := range []struct {
+		offset time.Duration
+		event  string
+	}{
+		{10 * time.Second, "a"},
+		{40 * time.Second, "b"},
+		{70 * time.Second, "c"},
+	} {
+		if err := a.Add("", base.Add(e.offset), e.event); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+	}
+
+	got, err := a.Close(base.Add(2 * time.Minute))
+	if err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	window := func(start time.Duration) Window {
+		return Window{Start: base.Add(start), End: base.Add(start + time.Minute)}
+	}
+	want := []Result{{
+		Window: window(-30 * time.Second),
+		Events: []interface{}{"a"},
+	}, {
+		Window: window(0),
+		Events: []interface{}{"a", "b"},
+	}, {
+		Window: window(30 * time.Second),
+		Events: []interface{}{"b", "c"},
+	}, {
+		Window: window(time.Minute),
+		Events: []interface{}{"c"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Close() = %v, wanted %v", got, want)
+	}
+}
+
+func TestMemoryBounds(t *testing.T) {
+	a, err := New(time.Minute, 30*time.Second, NewMemory(1, 2))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	base := time.Date(2019, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, e := range []struct {
+		group  string
+		offset time.Duration
+		event  string
+		want   error
+	}{
+		{"foo", 10 * time.Second, "a", nil},
+		{"foo", 40 * time.Second, "b", nil},
+		// The window from 0s holds a and b, so c is added to neither it
+		// nor the window from 30s.
+		{"foo", 45 * time.Second, "c", ErrWindowFull},
+		{"bar", 50 * time.Second, "d", ErrTooManyGroups},
+	} {
+		if err := a.Add(e.group, base.Add(e.offset), e.event); err != e.want {
+			t.Fatalf("Add(%q) = %v, wanted %v", e.event, err, e.want)
+		}
+	}
+
+	got, err := a.Close(base.Add(2 * time.Minute))
+	if err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	window := func(start time.Duration) Window {
+		return Window{Group: "foo", Start: base.Add(start), End: base.Add(start + time.Minute)}
+	}
+	want := []Result{{
+		Window: window(-30 * time.Second),
+		Events: []interface{}{"a"},
+	}, {
+		Window: window(0),
+		Events: []interface{}{"a", "b"},
+	}, {
+		Window: window(30 * time.Second),
+		Events: []interface{}{"b"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Close() = %v, wanted %v", got, want)
+	}
+
+	// Once its windows close, the group no longer counts.
+	if err := a.Add("bar", base.Add(3*time.Minute), "e"); err != nil {
+		t.Errorf("Add() = %v", err)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  time.Duration
+		slide time.Duration
+	}{{
+		name: "no size",
+	}, {
+		name:  "negative slide",
+		size:  time.Minute,
+		slide: -time.Second,
+	}, {
+		name:  "slide larger than size",
+		size:  time.Minute,
+		slide: 2 * time.Minute,
+	}, {
+		name:  "too many windows per event",
+		size:  time.Hour,
+		slide: time.Nanosecond,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := New(test.size, test.slide, NewMemory(0, 0)); err == nil {
+				t.Error("New() = nil, wanted error")
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package aggregate collects events into time windows, optionally keeping
+// separate windows for each group of events, so that each window's events
+// can be reduced to a single event when it closes.  Windows either tumble
+// (each event falls in exactly one window) or slide (each event falls in
+// every window that overlaps its arrival).  Open windows are held in a
+// Store, of which the in-memory one is the default; alternative Store
+// implementations may be used to persist this state, or share it across
+// replicas.
+package aggregate
@@ -28,6 +28,20 @@ const (
 	// TransformConditionServiceReady is set to whether the underlying
 	// Service has come up.
 	ConditionServiceReady duckv1alpha1.ConditionType = "ServiceReady"
+
+	// ConditionReferencesResolved is set to whether the resources
+	// referenced by the spec (e.g. ConfigMaps) have been resolved.
+	ConditionReferencesResolved duckv1alpha1.ConditionType = "ReferencesResolved"
+
+	// ConditionCompiled is set to whether the programs in the spec (e.g.
+	// templates or jq) compile, and the rest of it is valid.
+	ConditionCompiled duckv1alpha1.ConditionType = "Compiled"
+
+	// ConditionTestsPassed is set to whether the tests embedded in the
+	// spec pass.
+	ConditionTestsPassed duckv1alpha1.ConditionType = "TestsPassed"
 )
 
-var condSet = duckv1alpha1.NewLivingConditionSet(ConditionServiceReady)
+var filterCondSet = duckv1alpha1.NewLivingConditionSet(ConditionServiceReady, ConditionReferencesResolved, ConditionCompiled, ConditionTestsPassed)
+
+var transformCondSet = duckv1alpha1.NewLivingConditionSet(ConditionServiceReady, ConditionReferencesResolved, ConditionCompiled, ConditionTestsPassed)
@@ -53,6 +53,132 @@ type FilterSpec struct {
 	// TODO(mattmoor): More detailed description.
 	// +optional
 	Body json.RawMessage `json:"body,omitempty"`
+
+	// BodyFrom sources the filter to apply from another resource, as an
+	// alternative to inlining it as Body.
+	// +optional
+	BodyFrom *FilterBodySource `json:"bodyFrom,omitempty"`
+
+	// Invert the Filter to keep the events that do not match the
+	// event type and body pattern, instead of those that do.
+	// +optional
+	Invert bool `json:"invert,omitempty"`
+
+	// Deduplicate configures the Filter to drop events that it has
+	// already seen recently, e.g. redeliveries from upstream sources.
+	// +optional
+	Deduplicate *DeduplicateSpec `json:"deduplicate,omitempty"`
+
+	// Throttle configures the Filter to limit the rate at which events
+	// are kept, e.g. to cap noisy sources.
+	// +optional
+	Throttle *ThrottleSpec `json:"throttle,omitempty"`
+
+	// Mode determines whether the Filter enforces its decisions, or
+	// merely records them (defaults to Enforce).
+	// +optional
+	Mode FilterMode `json:"mode,omitempty"`
+
+	// Tests are sample events and whether the Filter is expected to keep
+	// them.  They are run whenever the Filter is reconciled, and the
+	// Filter is not ready unless they pass.
+	// +optional
+	Tests []FilterTest `json:"tests,omitempty"`
+}
+
+// FilterTest is a sample event and whether a Filter is expected to keep
+// it.  Tests exercise the event type, body and invert settings, but not
+// deduplication or throttling, which depend on the events seen before.
+type FilterTest struct {
+	// Name identifies the test in failures.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Type is the cloud event type of the sample event.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Input is the body of the sample event.
+	Input json.RawMessage `json:"input"`
+
+	// Keep is whether the Filter is expected to keep the event.
+	// +optional
+	Keep bool `json:"keep,omitempty"`
+}
+
+// FilterMode determines how a Filter acts on its decisions.
+type FilterMode string
+
+const (
+	// FilterModeEnforce skips the events that the Filter does not keep.
+	FilterModeEnforce FilterMode = "Enforce"
+
+	// FilterModeDryRun keeps every event, but records the events that
+	// would have been skipped.  These are logged, counted, and marked with
+	// the "kfilterwoulddrop" cloud event extension, whose value is the
+	// reason the event would have been skipped.
+	FilterModeDryRun FilterMode = "DryRun"
+)
+
+// FilterBodySource identifies where to find the filter to apply.
+type FilterBodySource struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap in the Filter's namespace,
+	// whose value is the filter to apply (as JSON or YAML).
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// DeduplicateSpec configures how a Filter recognizes duplicate events.
+type DeduplicateSpec struct {
+	// Key is a dot-separated path into the event body (e.g. "delivery.id")
+	// that identifies the event.  When unspecified, the cloud event ID is used.
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// TTL is how long an event is remembered after it is first seen.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// Size bounds the number of events that are remembered at once.
+	// +optional
+	Size int `json:"size,omitempty"`
+}
+
+// ThrottlePolicy is what a Filter does with events in excess of its rate limit.
+type ThrottlePolicy string
+
+const (
+	// ThrottlePolicyDrop filters excess events, as if they did not match.
+	ThrottlePolicyDrop ThrottlePolicy = "Drop"
+
+	// ThrottlePolicyReject responds to excess events with a 429 so that
+	// the sender may retry them later.
+	ThrottlePolicyReject ThrottlePolicy = "Reject"
+)
+
+// ThrottleSpec configures a token bucket limiting the rate of events.
+type ThrottleSpec struct {
+	// Limit is the number of events to keep per Period.
+	Limit int `json:"limit"`
+
+	// Period is the interval over which Limit applies (defaults to 1m).
+	// +optional
+	Period *metav1.Duration `json:"period,omitempty"`
+
+	// Burst is the number of events that may be kept at once (defaults
+	// to Limit).
+	// +optional
+	Burst int `json:"burst,omitempty"`
+
+	// Key is a dot-separated path into the event body (e.g. "repository.name")
+	// whose value groups events, with each group limited separately.
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// Policy determines what happens to events in excess of the limit
+	// (defaults to Drop).
+	// +optional
+	Policy ThrottlePolicy `json:"policy,omitempty"`
 }
 
 // FilterStatus is the status for a Filter resource
@@ -73,11 +199,35 @@ func (r *Filter) GetGroupVersionKind() schema.GroupVersionKind {
 }
 
 func (rs *FilterStatus) GetCondition(t duckv1alpha1.ConditionType) *duckv1alpha1.Condition {
-	return condSet.Manage(rs).GetCondition(t)
+	return filterCondSet.Manage(rs).GetCondition(t)
 }
 
 func (rs *FilterStatus) InitializeConditions() {
-	condSet.Manage(rs).InitializeConditions()
+	filterCondSet.Manage(rs).InitializeConditions()
+}
+
+func (rs *FilterStatus) MarkReferencesResolved() {
+	filterCondSet.Manage(rs).MarkTrue(ConditionReferencesResolved)
+}
+
+func (rs *FilterStatus) MarkReferencesUnresolved(reason, messageFormat string, messageA ...interface{}) {
+	filterCondSet.Manage(rs).MarkFalse(ConditionReferencesResolved, reason, messageFormat, messageA...)
+}
+
+func (rs *FilterStatus) MarkCompiled() {
+	filterCondSet.Manage(rs).MarkTrue(ConditionCompiled)
+}
+
+func (rs *FilterStatus) MarkCompileFailed(reason, messageFormat string, messageA ...interface{}) {
+	filterCondSet.Manage(rs).MarkFalse(ConditionCompiled, reason, messageFormat, messageA...)
+}
+
+func (rs *FilterStatus) MarkTestsPassed() {
+	filterCondSet.Manage(rs).MarkTrue(ConditionTestsPassed)
+}
+
+func (rs *FilterStatus) MarkTestsFailed(reason, messageFormat string, messageA ...interface{}) {
+	filterCondSet.Manage(rs).MarkFalse(ConditionTestsPassed, reason, messageFormat, messageA...)
 }
 
 func (rs *FilterStatus) PropagateServiceStatus(ss v1alpha1.ServiceStatus) {
@@ -88,9 +238,9 @@ func (rs *FilterStatus) PropagateServiceStatus(ss v1alpha1.ServiceStatus) {
 	}
 	switch sr.Status {
 	case corev1.ConditionTrue:
-		condSet.Manage(rs).MarkTrue(ConditionServiceReady)
+		filterCondSet.Manage(rs).MarkTrue(ConditionServiceReady)
 	case corev1.ConditionUnknown, corev1.ConditionFalse:
-		condSet.Manage(rs).MarkFalse(ConditionServiceReady, sr.Reason, sr.Message)
+		filterCondSet.Manage(rs).MarkFalse(ConditionServiceReady, sr.Reason, "%s", sr.Message)
 	}
 }
 
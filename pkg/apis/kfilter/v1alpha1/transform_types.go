@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"encoding/json"
+
 	duckv1alpha1 "github.com/knative/pkg/apis/duck/v1alpha1"
 	"github.com/knative/pkg/kmeta"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
@@ -43,9 +45,539 @@ var _ kmeta.OwnerRefable = (*Transform)(nil)
 
 // TransformSpec is the spec for a Transform resource
 type TransformSpec struct {
+	// Template is a Go template that renders the new event body as YAML.
+	// An empty result filters the event.  It is ignored when Split,
+	// Mapping, Patch, MergePatch, JQ or Script is specified.
+	//
+	// In addition to the text/template builtins, templates may call:
+	//   strings:      upper, lower, title, trim, trimPrefix, trimSuffix,
+	//                 replace, contains, hasPrefix, hasSuffix, split, join,
+	//                 repeat, substr, quote, toString, default, empty, coalesce
+	//   math:         add, sub, mul, div, mod, max, min, floor, ceil, round
+	//   lists:        list, first, last, rest, append, has
+	//   dictionaries: dict, get, set, hasKey, keys, omit
+	//   encoding:     toJson, fromJson, toYaml, b64enc, b64dec
+	//   dates:        now, date, toDate, unixTime
+	//   hashing:      sha1, sha256
+	//   values:       secret, config (see Secrets and Config)
+	// None of these have access to the environment, filesystem or network.
+	// +optional
+	Template string `json:"template,omitempty"`
+
+	// Libraries lists ConfigMaps (in the Transform's namespace) whose keys
+	// are templates that the Template (and the other templates of the spec)
+	// may invoke by name, along with any templates they define, e.g.
+	// {{ template "github.user" .sender }}.  The Transform is redeployed
+	// when they change.
+	// +optional
+	Libraries []corev1.LocalObjectReference `json:"libraries,omitempty"`
+
+	// Secrets lists keys of Secrets (in the Transform's namespace) that
+	// templates may read with {{ secret "name" "key" }}, e.g. for static
+	// tokens.  Their values are passed to the Transform's Service through its
+	// environment, so they appear in neither the spec nor the container args.
+	// +optional
+	Secrets []corev1.SecretKeySelector `json:"secrets,omitempty"`
+
+	// Config lists keys of ConfigMaps (in the Transform's namespace) that
+	// templates may read with {{ config "name" "key" }}, e.g. for tenant IDs.
+	// They are passed to the Transform's Service like Secrets.
+	// +optional
+	Config []corev1.ConfigMapKeySelector `json:"config,omitempty"`
+
+	// Mapping is a declarative alternative to Template, which builds the
+	// new event body from a list of rules that copy (and rename) fields
+	// of the input, or drop fields from the result.  The rules are applied
+	// in order, starting from an empty object, and preserve the JSON types
+	// of the values they copy.
+	// +optional
+	Mapping []MappingRule `json:"mapping,omitempty"`
+
+	// Patch is a JSON Patch (RFC 6902) to apply to the event body, as an
+	// alternative to Template.  String leaves of operation values are
+	// templates (see PatchOperation).
+	// +optional
+	Patch []PatchOperation `json:"patch,omitempty"`
+
+	// MergePatch is a JSON Merge Patch (RFC 7386) to apply to the event
+	// body, as an alternative to Template.  Its string leaves are templates,
+	// as with Patch.
+	// +optional
+	MergePatch json.RawMessage `json:"mergePatch,omitempty"`
+
+	// JQ is a jq program that computes the new event body, as an
+	// alternative to Template.  It is run against the same data as
+	// Template, and a program that produces no result (or null) filters
+	// the event.  Programs cannot read the environment, other inputs or
+	// modules.
+	// +optional
+	JQ string `json:"jq,omitempty"`
+
+	// Script is a Starlark script that computes the new event body, as an
+	// alternative to Template, for logic that is awkward to express in
+	// the others.  It must define a function transform(event), which is
+	// called with the same data as Template (as a dict), and returns the
+	// new body, or None to filter the event.  Scripts cannot load modules,
+	// and are subject to Limits.MaxSteps.
+	// +optional
+	Script string `json:"script,omitempty"`
+
+	// Split turns each event into one event per element of an array within
+	// its body (e.g. the commits of a push), instead of a single event.
+	// +optional
+	Split *TransformSplit `json:"split,omitempty"`
+
+	// Aggregate collects events into time windows, and emits a single
+	// event summarizing each window when it closes, instead of
+	// transforming each event.  Attributes don't apply to these events.
+	// +optional
+	Aggregate *TransformAggregation `json:"aggregate,omitempty"`
+
+	// Redact strips sensitive values from the event body before it is
+	// transformed, so that none of the above (nor Attributes) can see them.
+	// When it is the only thing specified, the redacted body is the result.
+	// +optional
+	Redact *TransformRedaction `json:"redact,omitempty"`
+
+	// Enrich lists HTTP lookups whose (JSON) responses are merged into the
+	// event body under enrich.<name> before it is transformed (after any
+	// redaction), e.g. {{ .enrich.employee.team }}.  The steps are
+	// performed in order, so each may use the results of those before it.
+	// Lookups don't follow redirects, and their responses may be at most
+	// Limits.MaxOutputBytes.
+	// +optional
+	Enrich []EnrichStep `json:"enrich,omitempty"`
+
+	// Format is the syntax that the Template renders (defaults to YAML).
+	// +optional
+	Format TemplateFormat `json:"format,omitempty"`
+
+	// AutoEscape causes every action in the Template to emit its value as
+	// an escaped JSON scalar (which is also valid YAML), so that values
+	// containing characters like ": " or newlines cannot corrupt the result
+	// or change its type.  Actions whose pipelines already end in toJson,
+	// quote or raw are left alone.
+	// +optional
+	AutoEscape bool `json:"autoEscape,omitempty"`
+
+	// DataModel determines what the Template is executed against (defaults
+	// to Body).
+	// +optional
+	DataModel DataModel `json:"dataModel,omitempty"`
+
+	// OutputContentType is the content type of the transformed events
+	// (defaults to that of the input events).  Unless it is a JSON content
+	// type, the result of the Template is emitted verbatim (and Format is
+	// ignored), which allows Transforms to produce plain text, XML, CSV, etc.
+	// +optional
+	OutputContentType string `json:"outputContentType,omitempty"`
+
+	// OutputSchema is a JSON Schema that the transformed event bodies must
+	// conform to, so that malformed results don't reach downstream
+	// consumers.  Results that violate it fail to transform (see OnError).
+	// It requires a JSON OutputContentType, and follows draft 7 unless its
+	// $schema says otherwise (drafts 4 and 6 are also supported).  It may
+	// $ref its own definitions, but not other documents (e.g. URLs).
+	// +optional
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+
+	// Attributes rewrite the cloud event attributes of the transformed
+	// event.
+	// +optional
+	Attributes *TransformAttributes `json:"attributes,omitempty"`
+
+	// OnError determines what happens to events that fail to transform
+	// (e.g. because a template fails to execute or renders invalid YAML).
+	// By default they are dropped.
+	// +optional
+	OnError *TransformErrorHandling `json:"onError,omitempty"`
+
+	// Limits bound the resources that transforming a single event may use.
+	// Events that exceed them fail to transform.
+	// +optional
+	Limits *TransformLimits `json:"limits,omitempty"`
+
+	// Tests are sample events and the results the Transform is expected
+	// to produce from them.  They are run whenever the Transform is
+	// reconciled, and the Transform is not ready unless they pass.
+	// +optional
+	Tests []TransformTest `json:"tests,omitempty"`
+}
+
+// TransformLimits bound the resources that transforming a single event
+// may use.  Unset limits take their defaults.
+type TransformLimits struct {
+	// Timeout bounds how long transforming an event may take (defaults
+	// to 1s).
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// MaxOutputBytes bounds how large the result may be (defaults to 4MiB).
+	// +optional
+	MaxOutputBytes int `json:"maxOutputBytes,omitempty"`
+
+	// MaxDepth bounds how deeply templates may invoke one another, e.g.
+	// recursively (defaults to 100).
+	// +optional
+	MaxDepth int `json:"maxDepth,omitempty"`
+
+	// MaxSteps bounds how many computation steps a Script may take
+	// (defaults to 1000000).
+	// +optional
+	MaxSteps int `json:"maxSteps,omitempty"`
+}
+
+// TransformTest is a sample event and the result that a Transform is
+// expected to produce from it.
+type TransformTest struct {
+	// Name identifies the test in failures.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Type is the cloud event type of the sample event.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Source is the cloud event source of the sample event.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// Input is the body of the sample event.
+	Input json.RawMessage `json:"input"`
+
+	// Output is the body the Transform is expected to produce, or a JSON
+	// array of the bodies when it splits events.  Results that aren't
+	// JSON are expected as strings.  When neither Output nor Error is
+	// set, the event is expected to be filtered.
+	// +optional
+	Output json.RawMessage `json:"output,omitempty"`
+
+	// Error is a substring of the error with which the event is expected
+	// to fail to transform.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// ErrorPolicy is what a Transform does with events that fail to transform.
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyDrop filters the event.
+	ErrorPolicyDrop ErrorPolicy = "Drop"
+
+	// ErrorPolicyPass passes the event along as it was (after redaction).
+	ErrorPolicyPass ErrorPolicy = "Pass"
+
+	// ErrorPolicyReject responds to the event with a 5xx, so that it may
+	// be redelivered.
+	ErrorPolicyReject ErrorPolicy = "Reject"
+
+	// ErrorPolicyDeadLetter sends the event as it was (after redaction) to
+	// a dead letter sink, with the error in its "error" extension.
+	ErrorPolicyDeadLetter ErrorPolicy = "DeadLetter"
+)
+
+// TransformErrorHandling describes what happens to events that fail to
+// transform.
+type TransformErrorHandling struct {
+	// Policy determines what happens to the events (defaults to Drop).
+	// +optional
+	Policy ErrorPolicy `json:"policy,omitempty"`
+
+	// DeadLetterSink is the URI to which the events are sent under the
+	// DeadLetter policy, which requires it.
+	// +optional
+	DeadLetterSink string `json:"deadLetterSink,omitempty"`
+}
+
+// TransformSplit describes how to split an event into many.  Each of the
+// resulting events has the attributes of the original (after any rewriting
+// by Attributes), except that its id is suffixed with the element's index.
+type TransformSplit struct {
+	// Path is the dot-separated path of the array within the event body
+	// (e.g. "commits").  Events without an array there produce no events.
+	Path string `json:"path"`
+
+	// Template renders the body of the event for each element.  It is
+	// executed against an object with the element under .item, its index
+	// under .index, the whole body under .data and the cloud event
+	// attributes under .ce (e.g. {{ .item.id }}), and is compiled like the
+	// Template above (except for DataModel).  An empty result omits the
+	// element.  When it is omitted, the elements are emitted as they are.
+	// +optional
 	Template string `json:"template,omitempty"`
+
+	// Sink is the URI to which the resulting events are sent.  When one
+	// fails to send, the original event is rejected, and its redelivery
+	// skips the resulting events that were sent (while they are
+	// remembered), so each is delivered at least once, with the same id.
+	// When it is omitted, they are returned together as a batched cloud
+	// events response (application/cloudevents-batch+json).
+	// +optional
+	Sink string `json:"sink,omitempty"`
+}
+
+// TransformAggregation describes how to aggregate events.  Windows are
+// measured by when events arrive, and each replica of the Transform
+// aggregates the events it receives.  Open windows are held in memory:
+// they are closed early when the replica shuts down gracefully, and lost
+// when it doesn't.  Summarizing events that fail to send are handled by
+// the OnError policy.
+type TransformAggregation struct {
+	// GroupBy is a dot-separated path into the event body (e.g.
+	// "repository.name") whose value groups events, with each group
+	// aggregated separately.  When it is omitted (or an event lacks it),
+	// events are aggregated together.
+	// +optional
+	GroupBy string `json:"groupBy,omitempty"`
+
+	// Window describes the windows events are collected into.
+	Window AggregationWindow `json:"window"`
+
+	// Template renders the body of the event summarizing each window.  It
+	// is executed against an object with the group under .group, the
+	// bounds of the window under .start and .end, the events under
+	// .events and their number under .count (e.g. {{ .count }}), and is
+	// compiled like the Template above (except for DataModel).  An empty
+	// result emits nothing for the window.
+	Template string `json:"template"`
+
+	// Type is the cloud event type of the summarizing events.
+	Type string `json:"type"`
+
+	// Source is the cloud event source of the summarizing events
+	// (defaults to the path of the Transform).
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// Sink is the URI to which the summarizing events are sent.
+	Sink string `json:"sink"`
+
+	// MaxGroups bounds how many groups may have open windows at once on
+	// each replica (defaults to 10000).  Events of further groups fail to
+	// transform, and are handled by the OnError policy.
+	// +optional
+	MaxGroups int `json:"maxGroups,omitempty"`
+
+	// MaxEvents bounds how many events each window may hold (defaults to
+	// 10000).  Events beyond it fail to transform, and are handled by the
+	// OnError policy.
+	// +optional
+	MaxEvents int `json:"maxEvents,omitempty"`
+}
+
+// AggregationWindow describes a series of time windows.
+type AggregationWindow struct {
+	// Size is how long each window is open.
+	Size metav1.Duration `json:"size"`
+
+	// Slide is how often a window opens.  When it is omitted (or equal to
+	// Size), windows tumble, with each event in exactly one window.  When
+	// it is shorter, windows overlap, and each event is in several.
+	// +optional
+	Slide *metav1.Duration `json:"slide,omitempty"`
+}
+
+// EnrichFailurePolicy is what a Transform does with an event when one of
+// its lookups fails (or times out).
+type EnrichFailurePolicy string
+
+const (
+	// EnrichFailurePolicyReject responds to the event with a 5xx, so that
+	// it may be redelivered.
+	EnrichFailurePolicyReject EnrichFailurePolicy = "Reject"
+
+	// EnrichFailurePolicyDrop filters the event.
+	EnrichFailurePolicyDrop EnrichFailurePolicy = "Drop"
+
+	// EnrichFailurePolicyIgnore carries on, as if the lookup returned null.
+	EnrichFailurePolicyIgnore EnrichFailurePolicy = "Ignore"
+)
+
+// EnrichStep is an HTTP lookup.  Its Path and Body are templates, which are
+// executed against the same data as the Template (including the results of
+// the preceding steps).
+type EnrichStep struct {
+	// Name is the key under which the response is stored.
+	Name string `json:"name"`
+
+	// URL is the absolute http(s) URL to look up, e.g. the address of a
+	// Knative Service (http://employees.default.svc.cluster.local).  Only
+	// URLs are supported: references to Addressables (e.g. a Service by
+	// name) aren't resolved.  It is fixed, so that events can't redirect
+	// the lookup to another host.
+	URL string `json:"url"`
+
+	// Path renders the path (starting with /) and/or query (starting with
+	// ?) to append to the URL as plain text.  Values should be escaped with
+	// urlquery (e.g. /logins/{{ .sender.login | urlquery }}).
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Method is GET (the default) or POST.
+	// +optional
+	Method string `json:"method,omitempty"`
+
+	// Body renders the JSON body of POST requests, as the Template would.
+	// +optional
+	Body string `json:"body,omitempty"`
+
+	// Timeout bounds how long the lookup may take (defaults to 1s).
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// CacheTTL is how long responses are reused for the same request.
+	// When it is unspecified, responses are not cached.
+	// +optional
+	CacheTTL *metav1.Duration `json:"cacheTTL,omitempty"`
+
+	// FailurePolicy determines what happens to the event when the lookup
+	// fails (defaults to Reject).
+	// +optional
+	FailurePolicy EnrichFailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// TransformRedaction describes how to strip sensitive values from event
+// bodies.  Paths are dot-separated, and the element "*" matches every key of
+// an object or element of an array (e.g. "commits.*.author.email").  Values
+// are removed first, then hashed, then masked.
+type TransformRedaction struct {
+	// Remove lists the paths of values to remove.
+	// +optional
+	Remove []string `json:"remove,omitempty"`
+
+	// Mask lists regular expressions to mask within string values.
+	// +optional
+	Mask []MaskRule `json:"mask,omitempty"`
+
+	// Hash lists the paths of values to replace with the hex encoded
+	// HMAC-SHA256 of the value (keyed by Salt), so that equal values can
+	// still be correlated without revealing them.
+	// +optional
+	Hash []string `json:"hash,omitempty"`
+
+	// Salt selects the key of a Secret (in the Transform's namespace) that
+	// holds the key for Hash.  It is strongly recommended, since unsalted
+	// hashes of guessable values (like logins) are easily reversed.
+	// +optional
+	Salt *corev1.SecretKeySelector `json:"salt,omitempty"`
+}
+
+// MaskRule replaces the text matching a regular expression.
+type MaskRule struct {
+	// Pattern is the (Go syntax) regular expression to mask.
+	Pattern string `json:"pattern"`
+
+	// Replacement is what matching text is replaced with, which may refer
+	// to submatches (e.g. "$1").  It defaults to "[REDACTED]".
+	// +optional
+	Replacement string `json:"replacement,omitempty"`
+
+	// Paths limits the rule to the strings at (or within) these paths.
+	// When it is empty, every string in the body is masked.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
 }
 
+// TransformAttributes are templates for the cloud event attributes of a
+// transformed event.  They are executed against the same data as the
+// Template, and render plain text.  An empty result leaves the attribute
+// as it was.
+type TransformAttributes struct {
+	// Type is the template for the event type.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Source is the template for the event source.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// Subject is the template for the event subject, which is conveyed as
+	// the "subject" extension.
+	// +optional
+	Subject string `json:"subject,omitempty"`
+
+	// Extensions holds templates for extension attributes, keyed by name.
+	// +optional
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+// DataModel determines what a Transform's template is executed against.
+type DataModel string
+
+const (
+	// DataModelBody templates are executed against the event body, and
+	// address its fields at the top level (e.g. {{ .action }}).
+	DataModelBody DataModel = "Body"
+
+	// DataModelEvent templates are executed against the whole event, with
+	// the body under .data and the cloud event attributes under .ce (e.g.
+	// {{ .data.action }} or {{ .ce.type }}).  The attributes are:
+	// specVersion, id, type, typeVersion, source, time, schemaURL,
+	// contentType and extensions.
+	DataModelEvent DataModel = "Event"
+)
+
+// MappingRule either copies the value at From (within the input) to To
+// (within the result), or removes the value at Drop from the result.
+// Paths are dot-separated (e.g. "issue.user.login"), array elements are
+// addressed by their index (e.g. "commits.0.id"), and the empty path
+// selects the whole input (or result).
+type MappingRule struct {
+	// From is the path of the value to copy.
+	// +optional
+	From string `json:"from,omitempty"`
+
+	// To is the path at which to store the copied value.
+	// +optional
+	To string `json:"to,omitempty"`
+
+	// Default is the value to use when nothing is found at From.  When it
+	// is omitted, To is left untouched.  A rule with a Default but no From
+	// always sets To to the Default.
+	// +optional
+	Default json.RawMessage `json:"default,omitempty"`
+
+	// Drop is the path of a value to remove from the result.  It cannot be
+	// combined with the other fields.
+	// +optional
+	Drop string `json:"drop,omitempty"`
+}
+
+// PatchOperation is a single JSON Patch (RFC 6902) operation.
+type PatchOperation struct {
+	// Op is one of add, remove, replace, move, copy or test.
+	Op string `json:"op"`
+
+	// Path is the JSON Pointer (e.g. "/issue/labels/0") the operation
+	// applies to.
+	Path string `json:"path"`
+
+	// From is the JSON Pointer to move or copy from.
+	// +optional
+	From string `json:"from,omitempty"`
+
+	// Value is the value to add, replace or test for.  Its string leaves
+	// may contain template actions, which are executed against the same
+	// data as Template.  A string consisting of a single action (e.g.
+	// "{{ .issue.number }}") is replaced by the value of that action, so its
+	// JSON type is preserved.  Any other string is replaced by the text it
+	// renders.
+	// +optional
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// TemplateFormat is the syntax that a Transform's template renders.
+type TemplateFormat string
+
+const (
+	// TemplateFormatYAML templates render YAML, which is converted to JSON.
+	TemplateFormatYAML TemplateFormat = "YAML"
+
+	// TemplateFormatJSON templates render JSON directly.
+	TemplateFormatJSON TemplateFormat = "JSON"
+)
+
 // TransformStatus is the status for a Transform resource
 type TransformStatus struct {
 	// Address holds the information needed for a Transform to be the target of an event.
@@ -64,11 +596,35 @@ func (r *Transform) GetGroupVersionKind() schema.GroupVersionKind {
 }
 
 func (rs *TransformStatus) GetCondition(t duckv1alpha1.ConditionType) *duckv1alpha1.Condition {
-	return condSet.Manage(rs).GetCondition(t)
+	return transformCondSet.Manage(rs).GetCondition(t)
 }
 
 func (rs *TransformStatus) InitializeConditions() {
-	condSet.Manage(rs).InitializeConditions()
+	transformCondSet.Manage(rs).InitializeConditions()
+}
+
+func (rs *TransformStatus) MarkCompiled() {
+	transformCondSet.Manage(rs).MarkTrue(ConditionCompiled)
+}
+
+func (rs *TransformStatus) MarkCompileFailed(reason, messageFormat string, messageA ...interface{}) {
+	transformCondSet.Manage(rs).MarkFalse(ConditionCompiled, reason, messageFormat, messageA...)
+}
+
+func (rs *TransformStatus) MarkTestsPassed() {
+	transformCondSet.Manage(rs).MarkTrue(ConditionTestsPassed)
+}
+
+func (rs *TransformStatus) MarkTestsFailed(reason, messageFormat string, messageA ...interface{}) {
+	transformCondSet.Manage(rs).MarkFalse(ConditionTestsPassed, reason, messageFormat, messageA...)
+}
+
+func (rs *TransformStatus) MarkReferencesResolved() {
+	transformCondSet.Manage(rs).MarkTrue(ConditionReferencesResolved)
+}
+
+func (rs *TransformStatus) MarkReferencesUnresolved(reason, messageFormat string, messageA ...interface{}) {
+	transformCondSet.Manage(rs).MarkFalse(ConditionReferencesResolved, reason, messageFormat, messageA...)
 }
 
 func (rs *TransformStatus) PropagateServiceStatus(ss v1alpha1.ServiceStatus) {
@@ -79,9 +635,9 @@ func (rs *TransformStatus) PropagateServiceStatus(ss v1alpha1.ServiceStatus) {
 	}
 	switch sr.Status {
 	case corev1.ConditionTrue:
-		condSet.Manage(rs).MarkTrue(ConditionServiceReady)
+		transformCondSet.Manage(rs).MarkTrue(ConditionServiceReady)
 	case corev1.ConditionUnknown, corev1.ConditionFalse:
-		condSet.Manage(rs).MarkFalse(ConditionServiceReady, sr.Reason, sr.Message)
+		transformCondSet.Manage(rs).MarkFalse(ConditionServiceReady, sr.Reason, "%s", sr.Message)
 	}
 }
 
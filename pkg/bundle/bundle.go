@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/knative/pkg/kmeta"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ArgsKey is the key of the bundle's ConfigMap that holds the data
+	// plane's args, as a JSON list.
+	ArgsKey = "args"
+
+	// HashAnnotation is the annotation of the bundle's ConfigMap that holds
+	// the hash of its args, which identifies the configuration.
+	HashAnnotation = "kfilter.mattmoor.io/hash"
+)
+
+// Hash returns the content hash of the given args.
+func Hash(args []string) string {
+	b, err := json.Marshal(args)
+	if err != nil {
+		panic(err.Error())
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// MakeConfigMap creates the named ConfigMap that holds the given args on
+// behalf of the owner.
+func MakeConfigMap(owner kmeta.OwnerRefable, name string, args []string) *corev1.ConfigMap {
+	b, err := json.Marshal(args)
+	if err != nil {
+		panic(err.Error())
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       owner.GetObjectMeta().GetNamespace(),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(owner)},
+			Annotations: map[string]string{
+				HashAnnotation: Hash(args),
+			},
+		},
+		Data: map[string]string{
+			ArgsKey: string(b),
+		},
+	}
+}
+
+// MakeServiceAccount creates the named service account that the data plane
+// runs as on behalf of the owner.  Each data plane has its own, so that it
+// can read its own bundle, but not those of other workloads.
+func MakeServiceAccount(owner kmeta.OwnerRefable, name string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       owner.GetObjectMeta().GetNamespace(),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(owner)},
+		},
+	}
+}
+
+// MakeRole creates the named Role that allows reading (and watching) the
+// ConfigMap of the same name, and nothing else, on behalf of the owner.
+func MakeRole(owner kmeta.OwnerRefable, name string) *rbacv1.Role {
+	return &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       owner.GetObjectMeta().GetNamespace(),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(owner)},
+		},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"configmaps"},
+			ResourceNames: []string{name},
+			Verbs:         []string{"get", "list", "watch"},
+		}},
+	}
+}
+
+// MakeRoleBinding creates the named RoleBinding that grants the Role of the
+// same name to the service account of the same name on behalf of the owner.
+func MakeRoleBinding(owner kmeta.OwnerRefable, name string) *rbacv1.RoleBinding {
+	namespace := owner.GetObjectMeta().GetNamespace()
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(owner)},
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      name,
+			Namespace: namespace,
+		}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     name,
+		},
+	}
+}
+
+// MakeReadinessProbe creates the probe through which the data plane
+// reports whether it is ready to serve (see Handler.Ready).
+func MakeReadinessProbe() *corev1.Probe {
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: ReadyPath,
+			},
+		},
+	}
+}
+
+// Args returns the args that the ConfigMap holds, along with their hash.
+func Args(cm *corev1.ConfigMap) ([]string, string, error) {
+	var args []string
+	if err := json.Unmarshal([]byte(cm.Data[ArgsKey]), &args); err != nil {
+		return nil, "", fmt.Errorf("configmap %q has invalid args: %v", cm.Name, err)
+	}
+	hash := cm.Annotations[HashAnnotation]
+	if hash == "" {
+		hash = Hash(args)
+	}
+	return args, hash, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+)
+
+var boolTrue = true
+
+func owner() *kfv1alpha1.Transform {
+	return &kfv1alpha1.Transform{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "baz",
+		},
+	}
+}
+
+var ownerRefs = []metav1.OwnerReference{{
+	APIVersion:         "kfilter.mattmoor.io/v1alpha1",
+	Kind:               "Transform",
+	Name:               "foo",
+	Controller:         &boolTrue,
+	BlockOwnerDeletion: &boolTrue,
+}}
+
+func TestConfigMap(t *testing.T) {
+	args := []string{"-transform", "YWN0aW9uOiB7eyAuYWN0aW9uIH19", "-auto-escape"}
+	got := MakeConfigMap(owner(), "foo-bundle", args)
+
+	want := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo-bundle",
+			Namespace:       "baz",
+			OwnerReferences: ownerRefs,
+			Annotations: map[string]string{
+				HashAnnotation: Hash(args),
+			},
+		},
+		Data: map[string]string{
+			ArgsKey: `["-transform","YWN0aW9uOiB7eyAuYWN0aW9uIH19","-auto-escape"]`,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("MakeConfigMap (-want, +got) = %v", diff)
+	}
+
+	gotArgs, hash, err := Args(got)
+	if err != nil {
+		t.Fatalf("Args() = %v", err)
+	}
+	if diff := cmp.Diff(args, gotArgs); diff != "" {
+		t.Errorf("Args (-want, +got) = %v", diff)
+	}
+	if hash != Hash(args) {
+		t.Errorf("Args() = %v, wanted hash %v", hash, Hash(args))
+	}
+}
+
+func TestHash(t *testing.T) {
+	a := Hash([]string{"-type", "dev.knative.foo"})
+	if b := Hash([]string{"-type", "dev.knative.foo"}); a != b {
+		t.Errorf("Hash() = %v, then %v for the same args", a, b)
+	}
+	// The hash distinguishes how the args are split.
+	if b := Hash([]string{"-type dev.knative.foo"}); a == b {
+		t.Errorf("Hash() = %v for different args", a)
+	}
+}
+
+func TestArgsErrors(t *testing.T) {
+	for _, data := range []map[string]string{nil, {ArgsKey: `{"type": "foo"}`}} {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-bundle"},
+			Data:       data,
+		}
+		if args, _, err := Args(cm); err == nil {
+			t.Errorf("Args(%v) = %v, wanted error", data, args)
+		}
+	}
+}
+
+func TestRBAC(t *testing.T) {
+	wantSA := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo-bundle",
+			Namespace:       "baz",
+			OwnerReferences: ownerRefs,
+		},
+	}
+	if diff := cmp.Diff(wantSA, MakeServiceAccount(owner(), "foo-bundle")); diff != "" {
+		t.Errorf("MakeServiceAccount (-want, +got) = %v", diff)
+	}
+
+	wantRole := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo-bundle",
+			Namespace:       "baz",
+			OwnerReferences: ownerRefs,
+		},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"configmaps"},
+			ResourceNames: []string{"foo-bundle"},
+			Verbs:         []string{"get", "list", "watch"},
+		}},
+	}
+	if diff := cmp.Diff(wantRole, MakeRole(owner(), "foo-bundle")); diff != "" {
+		t.Errorf("MakeRole (-want, +got) = %v", diff)
+	}
+
+	wantBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo-bundle",
+			Namespace:       "baz",
+			OwnerReferences: ownerRefs,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      "foo-bundle",
+			Namespace: "baz",
+		}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "Role",
+			Name:     "foo-bundle",
+		},
+	}
+	if diff := cmp.Diff(wantBinding, MakeRoleBinding(owner(), "foo-bundle")); diff != "" {
+		t.Errorf("MakeRoleBinding (-want, +got) = %v", diff)
+	}
+}
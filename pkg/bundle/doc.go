@@ -0,0 +1,29 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bundle ships the configuration of the data plane of a Filter or
+// Transform (the flags its binary is run with) through a ConfigMap, rather
+// than through the args of its Knative Service.  This keeps large
+// configurations (e.g. templates and their libraries) clear of limits on
+// the size of args, and since the data plane reloads the bundle when its
+// content hash changes, changing the configuration doesn't create a new
+// Revision.
+//
+// The vendored Knative Serving doesn't allow Revisions to mount volumes,
+// so the data plane watches the ConfigMap through the Kubernetes API, as a
+// service account of its own, via a Role that grants access to nothing
+// else.
+package bundle
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
+)
+
+// Reconciler creates and updates the resources that make up a bundle: its
+// ConfigMap, and the service account, Role and RoleBinding through which
+// the data plane reads it.
+type Reconciler struct {
+	KubeClientSet        kubernetes.Interface
+	ConfigMapLister      corev1listers.ConfigMapLister
+	ServiceAccountLister corev1listers.ServiceAccountLister
+	RoleLister           rbacv1listers.RoleLister
+	RoleBindingLister    rbacv1listers.RoleBindingLister
+}
+
+// Reconcile makes the owner's bundle match the desired resources.  It
+// refuses to take over resources that the owner doesn't control, so that
+// a bundle never overwrites (or exposes) a ConfigMap of the user's.
+func (r *Reconciler) Reconcile(owner metav1.Object, cm *corev1.ConfigMap, sa *corev1.ServiceAccount,
+	role *rbacv1.Role, binding *rbacv1.RoleBinding) error {
+	if err := r.reconcileConfigMap(owner, cm); err != nil {
+		return err
+	}
+	if err := r.reconcileServiceAccount(owner, sa); err != nil {
+		return err
+	}
+	if err := r.reconcileRole(owner, role); err != nil {
+		return err
+	}
+	return r.reconcileRoleBinding(owner, binding)
+}
+
+func (r *Reconciler) reconcileConfigMap(owner metav1.Object, desired *corev1.ConfigMap) error {
+	cm, err := r.ConfigMapLister.ConfigMaps(desired.Namespace).Get(desired.Name)
+	if apierrs.IsNotFound(err) {
+		_, err = r.KubeClientSet.CoreV1().ConfigMaps(desired.Namespace).Create(desired)
+		return err
+	} else if err != nil {
+		return err
+	} else if !metav1.IsControlledBy(cm, owner) {
+		return notOwned("configmap", cm.Name, owner)
+	}
+	if equality.Semantic.DeepEqual(cm.Data, desired.Data) &&
+		cm.Annotations[HashAnnotation] == desired.Annotations[HashAnnotation] {
+		return nil
+	}
+	cm = cm.DeepCopy()
+	cm.Data = desired.Data
+	if cm.Annotations == nil {
+		cm.Annotations = make(map[string]string, 1)
+	}
+	cm.Annotations[HashAnnotation] = desired.Annotations[HashAnnotation]
+	_, err = r.KubeClientSet.CoreV1().ConfigMaps(desired.Namespace).Update(cm)
+	return err
+}
+
+func (r *Reconciler) reconcileServiceAccount(owner metav1.Object, desired *corev1.ServiceAccount) error {
+	sa, err := r.ServiceAccountLister.ServiceAccounts(desired.Namespace).Get(desired.Name)
+	if apierrs.IsNotFound(err) {
+		_, err = r.KubeClientSet.CoreV1().ServiceAccounts(desired.Namespace).Create(desired)
+		return err
+	} else if err != nil {
+		return err
+	} else if !metav1.IsControlledBy(sa, owner) {
+		return notOwned("serviceaccount", sa.Name, owner)
+	}
+	// Nothing about the service account itself is desired, so there's
+	// nothing to update.
+	return nil
+}
+
+func (r *Reconciler) reconcileRole(owner metav1.Object, desired *rbacv1.Role) error {
+	role, err := r.RoleLister.Roles(desired.Namespace).Get(desired.Name)
+	if apierrs.IsNotFound(err) {
+		_, err = r.KubeClientSet.RbacV1().Roles(desired.Namespace).Create(desired)
+		return err
+	} else if err != nil {
+		return err
+	} else if !metav1.IsControlledBy(role, owner) {
+		return notOwned("role", role.Name, owner)
+	}
+	if equality.Semantic.DeepEqual(role.Rules, desired.Rules) {
+		return nil
+	}
+	role = role.DeepCopy()
+	role.Rules = desired.Rules
+	_, err = r.KubeClientSet.RbacV1().Roles(desired.Namespace).Update(role)
+	return err
+}
+
+func (r *Reconciler) reconcileRoleBinding(owner metav1.Object, desired *rbacv1.RoleBinding) error {
+	binding, err := r.RoleBindingLister.RoleBindings(desired.Namespace).Get(desired.Name)
+	if apierrs.IsNotFound(err) {
+		_, err = r.KubeClientSet.RbacV1().RoleBindings(desired.Namespace).Create(desired)
+		return err
+	} else if err != nil {
+		return err
+	} else if !metav1.IsControlledBy(binding, owner) {
+		return notOwned("rolebinding", binding.Name, owner)
+	}
+	// The RoleRef of a RoleBinding is immutable, and is derived from the
+	// same name, so only the subjects can drift.
+	if equality.Semantic.DeepEqual(binding.Subjects, desired.Subjects) {
+		return nil
+	}
+	binding = binding.DeepCopy()
+	binding.Subjects = desired.Subjects
+	_, err = r.KubeClientSet.RbacV1().RoleBindings(desired.Namespace).Update(binding)
+	return err
+}
+
+func notOwned(kind, name string, owner metav1.Object) error {
+	return fmt.Errorf("%s %q already exists, and is not owned by %q", kind, name, owner.GetName())
+}
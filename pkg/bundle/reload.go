@@ -0,0 +1,223 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ReadyPath is the path at which the data plane serves its readiness
+// check (see Handler.Ready).
+const ReadyPath = "/ready"
+
+// InCluster returns a ListerWatcher for (just) the ConfigMap with the
+// given key (namespace/name), through the Kubernetes API of the cluster
+// that the process runs in.
+func InCluster(key string) (cache.ListerWatcher, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cache.NewListWatchFromClient(client.CoreV1().RESTClient(), "configmaps", namespace,
+		fields.OneTermEqualSelector("metadata.name", name)), nil
+}
+
+// Load lists the bundle, and returns its args along with their hash.
+func Load(lw cache.ListerWatcher) ([]string, string, error) {
+	obj, err := lw.List(metav1.ListOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	list, ok := obj.(*corev1.ConfigMapList)
+	if !ok {
+		return nil, "", fmt.Errorf("listed %T, wanted configmaps", obj)
+	}
+	if len(list.Items) != 1 {
+		return nil, "", errors.New("bundle not found")
+	}
+	return Args(&list.Items[0])
+}
+
+// Watcher watches the bundle, and calls apply with its args whenever their
+// hash differs from that of the args it last saw.  When the bundle can't
+// be applied, the error is logged and the data plane carries on as it was;
+// a bundle that fails to apply isn't retried until it changes again.
+//
+// A rejected bundle doesn't affect the data plane's readiness, since every
+// replica would reject it alike, and so stop serving altogether; instead it
+// is reported by Err and Status.
+type Watcher struct {
+	lw    cache.ListerWatcher
+	apply func([]string) error
+
+	m sync.Mutex
+	// applied is the hash of the bundle that was last applied, latest
+	// that of the bundle last seen (or empty when it couldn't be loaded),
+	// and err why the latter wasn't applied.
+	applied string
+	latest  string
+	err     error
+}
+
+// NewWatcher creates a Watcher of the bundle that lw lists, whose args
+// (with the given hash) the data plane has already applied.
+func NewWatcher(lw cache.ListerWatcher, hash string, apply func([]string) error) *Watcher {
+	return &Watcher{lw: lw, apply: apply, applied: hash, latest: hash}
+}
+
+// Run watches the bundle until stopCh is closed.
+func (w *Watcher) Run(stopCh <-chan struct{}) {
+	_, controller := cache.NewInformer(w.lw, &corev1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: w.update,
+		UpdateFunc: func(_, obj interface{}) {
+			w.update(obj)
+		},
+		DeleteFunc: func(interface{}) {
+			log.Print("Bundle deleted, carrying on as before")
+		},
+	})
+	controller.Run(stopCh)
+}
+
+// update applies the given bundle, if it has changed.
+func (w *Watcher) update(obj interface{}) {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return
+	}
+	args, h, err := Args(cm)
+
+	w.m.Lock()
+	defer w.m.Unlock()
+	if err != nil {
+		log.Printf("Failed to load bundle: %v", err)
+		w.latest, w.err = "", err
+		return
+	}
+	if h == w.latest {
+		return
+	}
+	w.latest, w.err = h, nil
+	if h == w.applied {
+		return
+	}
+	if w.err = w.apply(args); w.err != nil {
+		log.Printf("Failed to apply bundle %s: %v", h, w.err)
+		return
+	}
+	w.applied = h
+	log.Printf("Applied bundle %s", h)
+}
+
+// Err returns why the latest bundle hasn't been applied, or nil when it
+// has.
+func (w *Watcher) Err() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.err != nil && w.latest != "" {
+		return fmt.Errorf("bundle %s failed to apply: %v", w.latest, w.err)
+	} else if w.err != nil {
+		return fmt.Errorf("bundle failed to load: %v", w.err)
+	}
+	return nil
+}
+
+// WatcherStatus is what a Watcher reports of the bundles it has seen.
+type WatcherStatus struct {
+	// Applied is the hash of the bundle that was last applied.
+	Applied string `json:"applied"`
+	// Error is why the latest bundle hasn't been applied, if it hasn't.
+	Error string `json:"error,omitempty"`
+}
+
+// Status returns the WatcherStatus of the Watcher, e.g. for publishing as
+// an expvar.Func.
+func (w *Watcher) Status() interface{} {
+	s := WatcherStatus{}
+	if err := w.Err(); err != nil {
+		s.Error = err.Error()
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+	s.Applied = w.applied
+	return s
+}
+
+// Handler is an http.Handler that delegates to whichever handler it was
+// most recently given, so that the data plane can swap in a new
+// configuration without interrupting the requests it is serving.
+type Handler struct {
+	current atomic.Value
+}
+
+// holder lets Handler store handlers of different types.
+type holder struct {
+	http.Handler
+}
+
+// Set makes the Handler delegate to the given handler.
+func (h *Handler) Set(handler http.Handler) {
+	h.current.Store(holder{handler})
+}
+
+// Get returns the handler that the Handler currently delegates to, or nil.
+func (h *Handler) Get() http.Handler {
+	c, _ := h.current.Load().(holder)
+	return c.Handler
+}
+
+// Handler implements http.Handler
+var _ http.Handler = (*Handler)(nil)
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler := h.Get()
+	if handler == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// Ready serves the data plane's readiness check, which passes once the
+// Handler has a handler to delegate to.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.Get() == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
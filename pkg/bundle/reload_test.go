@@ -0,0 +1,195 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	fakekubeclientset "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// listWatch lists and watches the ConfigMaps of the owner's namespace.
+func listWatch(client kubernetes.Interface) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return client.CoreV1().ConfigMaps("baz").List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().ConfigMaps("baz").Watch(opts)
+		},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	initial := []string{"-type", "foo"}
+	client := fakekubeclientset.NewSimpleClientset(MakeConfigMap(owner(), "foo-bundle", initial))
+
+	args, hash, err := Load(listWatch(client))
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if diff := cmp.Diff(initial, args); diff != "" {
+		t.Errorf("Load (-want, +got) = %v", diff)
+	}
+	if hash != Hash(initial) {
+		t.Errorf("Load() = %v, wanted hash %v", hash, Hash(initial))
+	}
+
+	if args, _, err := Load(listWatch(fakekubeclientset.NewSimpleClientset())); err == nil {
+		t.Errorf("Load() = %v, wanted error", args)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	initial := []string{"-type", "foo"}
+	client := fakekubeclientset.NewSimpleClientset(MakeConfigMap(owner(), "foo-bundle", initial))
+
+	applied := make(chan []string, 10)
+	apply := func(args []string) error {
+		applied <- args
+		if args[1] == "invalid" {
+			return errors.New("invalid")
+		}
+		return nil
+	}
+	w := NewWatcher(listWatch(client), Hash(initial), apply)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go w.Run(stopCh)
+
+	failed := func() bool {
+		return w.Err() != nil
+	}
+	waitForFailed := func(want bool) {
+		for start := time.Now(); failed() != want; time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("Timed out waiting for Err() != nil to be %v", want)
+			}
+		}
+	}
+	update := func(cm *corev1.ConfigMap) {
+		if _, err := client.CoreV1().ConfigMaps(cm.Namespace).Update(cm); err != nil {
+			t.Fatalf("Update() = %v", err)
+		}
+	}
+	noneApplied := func() {
+		time.Sleep(10 * time.Millisecond)
+		select {
+		case got := <-applied:
+			t.Errorf("apply(%v), wanted nothing applied", got)
+		default:
+		}
+	}
+
+	// The initial bundle has already been applied.
+	noneApplied()
+	if err := w.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+
+	// Bundles are applied when they change, and not otherwise, and the
+	// Watcher reports an error while the latest one isn't applied.
+	for _, test := range []struct {
+		args        []string
+		want        bool
+		wantApplied []string
+	}{{
+		args:        []string{"-type", "bar"},
+		wantApplied: []string{"-type", "bar"},
+	}, {
+		args:        []string{"-type", "invalid"},
+		want:        true,
+		wantApplied: []string{"-type", "bar"},
+	}, {
+		args:        []string{"-type", "baz"},
+		wantApplied: []string{"-type", "baz"},
+	}} {
+		update(MakeConfigMap(owner(), "foo-bundle", test.args))
+		select {
+		case got := <-applied:
+			if diff := cmp.Diff(test.args, got); diff != "" {
+				t.Errorf("apply (-want, +got) = %v", diff)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %v to be applied", test.args)
+		}
+		if got := failed(); got != test.want {
+			t.Errorf("Err() != nil = %v, wanted %v", got, test.want)
+		}
+		if got, want := w.Status().(WatcherStatus).Applied, Hash(test.wantApplied); got != want {
+			t.Errorf("Status().Applied = %v, wanted %v", got, want)
+		}
+
+		update(MakeConfigMap(owner(), "foo-bundle", test.args))
+		noneApplied()
+	}
+
+	// A bundle that can't be loaded isn't applied, and when it's fixed, the
+	// configuration is the same as before, so there's nothing to apply.
+	broken := MakeConfigMap(owner(), "foo-bundle", nil)
+	broken.Data[ArgsKey] = "nope"
+	update(broken)
+	waitForFailed(true)
+	update(MakeConfigMap(owner(), "foo-bundle", []string{"-type", "baz"}))
+	waitForFailed(false)
+	noneApplied()
+}
+
+func TestHandler(t *testing.T) {
+	h := &Handler{}
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		return w.Code
+	}
+	ready := func() int {
+		w := httptest.NewRecorder()
+		h.Ready(w, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+		return w.Code
+	}
+	if got, want := serve(), http.StatusServiceUnavailable; got != want {
+		t.Errorf("ServeHTTP() = %v, wanted %v", got, want)
+	}
+	if got, want := ready(), http.StatusServiceUnavailable; got != want {
+		t.Errorf("Ready() = %v, wanted %v", got, want)
+	}
+
+	for _, code := range []int{http.StatusOK, http.StatusAccepted} {
+		code := code
+		h.Set(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		if got := serve(); got != code {
+			t.Errorf("ServeHTTP() = %v, wanted %v", got, code)
+		}
+		if got, want := ready(), http.StatusOK; got != want {
+			t.Errorf("Ready() = %v, wanted %v", got, want)
+		}
+	}
+}
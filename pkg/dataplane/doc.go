@@ -0,0 +1,22 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dataplane implements the HTTP handlers that Filters and
+// Transforms run as, configured by the args that their reconcilers
+// generate (see the MakeArgs functions of their resources).  The
+// reconcilers also compile and test their specs through this package, so
+// that what they check is exactly what the data plane runs.
+package dataplane
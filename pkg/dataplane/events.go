@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dataplane
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/transform"
+)
+
+// contentTypeBatch is the content type of batched cloud events responses.
+const contentTypeBatch = "application/cloudevents-batch+json"
+
+// send delivers a single event to the sink in the binary encoding.
+func send(sink string, ctx *cloudevents.EventContext, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, sink, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	setHeaders(ctx, req.Header)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// makeBatch encodes the events as a JSON array of structured cloud events.
+func makeBatch(contexts []cloudevents.EventContext, bodies [][]byte) ([]byte, error) {
+	type event struct {
+		*cloudevents.EventContext
+		Data json.RawMessage `json:"data"`
+	}
+	events := make([]event, 0, len(bodies))
+	for i, body := range bodies {
+		data := json.RawMessage(body)
+		if !transform.IsJSON(contexts[i].ContentType) {
+			// Other content is conveyed as a JSON string.
+			b, err := json.Marshal(string(body))
+			if err != nil {
+				return nil, err
+			}
+			data = b
+		}
+		if contexts[i].CloudEventsVersion == "" {
+			contexts[i].CloudEventsVersion = cloudevents.CloudEventsVersion
+		}
+		events = append(events, event{EventContext: &contexts[i], Data: data})
+	}
+	return json.Marshal(events)
+}
+
+func setHeaders(context *cloudevents.EventContext, header http.Header) {
+	// These are required ones.
+	header.Add(cloudevents.HeaderCloudEventsVersion, cloudevents.CloudEventsVersion)
+	header.Add(cloudevents.HeaderEventID, context.EventID)
+	header.Add(cloudevents.HeaderEventType, context.EventType)
+	header.Add(cloudevents.HeaderSource, context.Source)
+
+	header.Add(cloudevents.HeaderEventTime, context.EventTime.Format(time.RFC3339Nano))
+	if context.EventTypeVersion != "" {
+		header.Add(cloudevents.HeaderEventTypeVersion, context.EventTypeVersion)
+	}
+	if context.SchemaURL != "" {
+		header.Add(cloudevents.HeaderSchemaURL, context.SchemaURL)
+	}
+	header.Add(cloudevents.HeaderContentType, context.ContentType)
+	for name, value := range context.Extensions {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			log.Printf("Failed to encode extension %q: %v", name, err)
+			continue
+		}
+		header.Add(cloudevents.HeaderExtensionsPrefix+name, string(encoded))
+	}
+}
+
+// decodeFlag decodes the base64 encoded JSON value of the named flag into v.
+func decodeFlag(name, value string, v interface{}) error {
+	encoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("unable to decode -%s: %v", name, err)
+	}
+	if err := json.Unmarshal(encoded, v); err != nil {
+		return fmt.Errorf("unable to unmarshal -%s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dataplane
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/dedupe"
+	"github.com/mattmoor/kfilter/pkg/fieldpath"
+	"github.com/mattmoor/kfilter/pkg/filter"
+	"github.com/mattmoor/kfilter/pkg/throttle"
+)
+
+// wouldDropExtension is the cloud event extension through which dry-run
+// mode reports why an event would have been skipped.
+const wouldDropExtension = "kfilterwoulddrop"
+
+// wouldDrop counts the events that dry-run mode would have skipped, by reason.
+// These are served (along with the other expvars) on /debug/vars.
+var wouldDrop = expvar.NewMap("wouldDrop")
+
+// Filter is the data plane of a Filter: it replies with the events that
+// it keeps, and with no event when it skips one.
+type Filter struct {
+	s *filter.Selector
+
+	// The options that apply to each event, copied from the flags.
+	dedupeKey      string
+	throttleKey    string
+	throttlePolicy string
+	dryRun         bool
+
+	// When non-nil, the store of events we have seen already.
+	seen dedupe.Store
+
+	// When non-nil, the limiter of the rate of events we keep.
+	limiter throttle.Limiter
+}
+
+// FilterFlags defines the flags that configure a Filter on the given
+// FlagSet, and returns a function that builds the Filter they describe
+// once the FlagSet is parsed.
+func FilterFlags(fs *flag.FlagSet) func() (*Filter, error) {
+	var (
+		filterType    = fs.String("type", "", "The event type to keep.")
+		encodedFilter = fs.String("filter", "", "The base64 encoded filter expression.")
+		invert        = fs.Bool("invert", false, "Whether to keep the events that don't match, instead of those that do.")
+
+		deduplicate = fs.Bool("dedupe", false, "Whether to drop events that have already been seen.")
+		dedupeKey   = fs.String("dedupe-key", "", "The path into the body that identifies an event (defaults to the event ID).")
+		dedupeTTL   = fs.Duration("dedupe-ttl", 10*time.Minute, "How long an event is remembered after it is first seen.")
+		dedupeSize  = fs.Int("dedupe-size", 10000, "The maximum number of events to remember.")
+
+		throttleLimit  = fs.Int("throttle-limit", 0, "The number of events to keep per period (setting it enables throttling).")
+		throttlePeriod = fs.Duration("throttle-period", time.Minute, "The period over which the throttle limit applies.")
+		throttleBurst  = fs.Int("throttle-burst", 0, "The number of events that may be kept at once (defaults to the limit).")
+		throttleKey    = fs.String("throttle-key", "", "The path into the body whose value groups throttled events.")
+		throttlePolicy = fs.String("throttle-policy", "Drop", "What to do with excess events: Drop or Reject.")
+		throttleGroups = fs.Int("throttle-groups", 10000, "The maximum number of groups to track at once.")
+
+		dryRun = fs.Bool("dry-run", false, "Whether to keep every event, recording the events that would have been skipped.")
+	)
+
+	return func() (*Filter, error) {
+		throttling := false
+		fs.Visit(func(f *flag.Flag) {
+			throttling = throttling || f.Name == "throttle-limit"
+		})
+
+		expression, err := base64.StdEncoding.DecodeString(*encodedFilter)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode filter expression: %v", err)
+		}
+		selector, err := filter.NewSelector(*filterType, expression, *invert)
+		if err != nil {
+			return nil, err
+		}
+
+		f := &Filter{
+			s:              selector,
+			dedupeKey:      *dedupeKey,
+			throttleKey:    *throttleKey,
+			throttlePolicy: *throttlePolicy,
+			dryRun:         *dryRun,
+		}
+		if *deduplicate {
+			f.seen, err = dedupe.NewLRU(*dedupeSize, *dedupeTTL)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create deduplication store: %v", err)
+			}
+		}
+		if throttling {
+			switch {
+			case *throttleLimit <= 0:
+				return nil, errors.New("the throttle limit must be positive")
+			case *throttlePeriod <= 0:
+				return nil, errors.New("the throttle period must be positive")
+			case *throttleBurst < 0:
+				return nil, errors.New("the throttle burst must not be negative")
+			}
+			switch *throttlePolicy {
+			case "Drop", "Reject":
+			default:
+				return nil, fmt.Errorf("unsupported throttle policy: %q", *throttlePolicy)
+			}
+			burst := *throttleBurst
+			if burst == 0 {
+				burst = *throttleLimit
+			}
+			f.limiter, err = throttle.New(*throttleLimit, *throttlePeriod, burst, *throttleGroups)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create throttle: %v", err)
+			}
+		}
+		return f, nil
+	}
+}
+
+// ParseFilter returns the Filter that the given args describe.
+func ParseFilter(args []string) (*Filter, error) {
+	fs := flag.NewFlagSet("filter", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	build := FilterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return build()
+}
+
+func (f *Filter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	var body json.RawMessage
+	ctx, err := cloudevents.Binary.FromRequest(&body, r)
+	if err != nil {
+		log.Printf("Failed to parse events from the request: %s", err)
+		// TODO: Actually fail this request?
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	log.Printf("Received Context: %+v", ctx)
+	log.Printf("Received body as: %#v", string(body))
+
+	var unstructured map[string]interface{}
+	err = json.Unmarshal(body, &unstructured)
+	if err != nil {
+		log.Printf("Failed to unmarshal payload: %s", err)
+		// TODO: Actually fail this request?
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	reason, status := f.decide(ctx, unstructured)
+	if reason != "" {
+		if !f.dryRun {
+			log.Printf("Skipping %q (%s)", ctx.EventID, reason)
+			w.WriteHeader(status)
+			return
+		}
+		// In dry-run mode, keep the event but record what we would have done.
+		log.Printf("Would have skipped %q (%s)", ctx.EventID, reason)
+		wouldDrop.Add(reason, 1)
+		if ctx.Extensions == nil {
+			ctx.Extensions = make(map[string]interface{})
+		}
+		ctx.Extensions[wouldDropExtension] = reason
+	}
+
+	setHeaders(ctx, w.Header())
+	w.Write(body)
+}
+
+// decide determines whether to skip the given event.  When the event
+// should be skipped, it returns the reason for skipping it, and the
+// status with which to respond.
+func (f *Filter) decide(ctx *cloudevents.EventContext, unstructured map[string]interface{}) (string, int) {
+	// Skip the events that don't match (or, when inverted, that do).
+	if reason := f.s.Skip(ctx.EventType, unstructured); reason != "" {
+		return reason, http.StatusOK
+	}
+
+	// If configured, drop events that we have already seen.
+	var id string
+	if f.seen != nil {
+		var ok bool
+		if id, ok = f.eventID(ctx, unstructured); !ok {
+			log.Printf("Unable to find %q in the body, not deduplicating.", f.dedupeKey)
+		} else if f.seen.Seen(id) {
+			return "duplicate", http.StatusOK
+		}
+	}
+
+	// If configured, limit the rate of events we keep.
+	if f.limiter != nil {
+		// Without a key (or when an event lacks it) events are throttled together.
+		var group string
+		if f.throttleKey != "" {
+			group, _ = fieldpath.String(unstructured, f.throttleKey)
+		}
+		if !f.limiter.Allow(group) {
+			if f.throttlePolicy == "Reject" {
+				// The event will be redelivered, which mustn't then be
+				// dropped as a duplicate.
+				if id != "" {
+					f.seen.Forget(id)
+				}
+				return "throttled", http.StatusTooManyRequests
+			}
+			return "throttled", http.StatusOK
+		}
+	}
+
+	return "", http.StatusOK
+}
+
+// eventID returns the identifier by which we deduplicate the given event.
+func (f *Filter) eventID(context *cloudevents.EventContext, body interface{}) (string, bool) {
+	if f.dedupeKey == "" {
+		return context.EventID, true
+	}
+	return fieldpath.String(body, f.dedupeKey)
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dataplane
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		inputs     []string
+		wantStatus int
+		wantKept   bool
+		wantReason string
+	}{{
+		name:       "match",
+		args:       []string{"-type", "dev.knative.foo", "-filter", b64(`{"foo": "bar"}`)},
+		inputs:     []string{`{"foo": "bar"}`},
+		wantStatus: http.StatusOK,
+		wantKept:   true,
+	}, {
+		name:       "mismatch",
+		args:       []string{"-filter", b64(`{"foo": "bar"}`)},
+		inputs:     []string{`{"foo": "baz"}`},
+		wantStatus: http.StatusOK,
+	}, {
+		name:       "inverted",
+		args:       []string{"-filter", b64(`{"foo": "bar"}`), "-invert"},
+		inputs:     []string{`{"foo": "baz"}`},
+		wantStatus: http.StatusOK,
+		wantKept:   true,
+	}, {
+		name:       "duplicate",
+		args:       []string{"-dedupe"},
+		inputs:     []string{`{"foo": "bar"}`, `{"foo": "bar"}`},
+		wantStatus: http.StatusOK,
+	}, {
+		name:       "throttled",
+		args:       []string{"-throttle-limit", "1", "-throttle-policy", "Reject"},
+		inputs:     []string{`{"foo": "bar"}`, `{"foo": "bar"}`},
+		wantStatus: http.StatusTooManyRequests,
+	}, {
+		name:       "dry run",
+		args:       []string{"-filter", b64(`{"foo": "bar"}`), "-dry-run"},
+		inputs:     []string{`{"foo": "baz"}`},
+		wantStatus: http.StatusOK,
+		wantKept:   true,
+		wantReason: `"body"`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := ParseFilter(test.args)
+			if err != nil {
+				t.Fatalf("ParseFilter() = %v", err)
+			}
+			var w *httptest.ResponseRecorder
+			for _, input := range test.inputs {
+				w = httptest.NewRecorder()
+				f.ServeHTTP(w, newRequest(t, "dev.knative.foo", input))
+			}
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, wanted %d", w.Code, test.wantStatus)
+			}
+			if kept := w.Body.Len() != 0; kept != test.wantKept {
+				t.Errorf("kept = %v, wanted %v", kept, test.wantKept)
+			}
+			if got := w.Header().Get(cloudevents.HeaderExtensionsPrefix + wouldDropExtension); got != test.wantReason {
+				t.Errorf("reason = %q, wanted %q", got, test.wantReason)
+			}
+		})
+	}
+}
+
+func TestFilterRejectedRedelivery(t *testing.T) {
+	f, err := ParseFilter([]string{
+		"-dedupe", "-dedupe-key", "id",
+		"-throttle-limit", "1", "-throttle-period", "50ms", "-throttle-policy", "Reject",
+	})
+	if err != nil {
+		t.Fatalf("ParseFilter() = %v", err)
+	}
+	deliver := func(input string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, newRequest(t, "dev.knative.foo", input))
+		return w
+	}
+
+	if w := deliver(`{"id": "a"}`); w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("deliver(a) = %d, wanted it kept", w.Code)
+	}
+	if w := deliver(`{"id": "b"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("deliver(b) = %d, wanted %d", w.Code, http.StatusTooManyRequests)
+	}
+	// Once the throttle allows it, the redelivery of the rejected event is
+	// kept rather than dropped as a duplicate.
+	time.Sleep(100 * time.Millisecond)
+	if w := deliver(`{"id": "b"}`); w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("redeliver(b) = %d, wanted it kept", w.Code)
+	}
+	// It is remembered once kept.
+	time.Sleep(100 * time.Millisecond)
+	if w := deliver(`{"id": "b"}`); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("redeliver(b) = %d, wanted it dropped as a duplicate", w.Code)
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{{
+		name: "invalid expression",
+		args: []string{"-filter", b64(`{"foo": `)},
+		want: "invalid filter expression: unexpected end of JSON input",
+	}, {
+		name: "unsupported throttle policy",
+		args: []string{"-throttle-limit", "1", "-throttle-policy", "Queue"},
+		want: `unsupported throttle policy: "Queue"`,
+	}, {
+		name: "no throttle limit",
+		args: []string{"-throttle-limit", "0"},
+		want: "the throttle limit must be positive",
+	}, {
+		name: "negative throttle burst",
+		args: []string{"-throttle-limit", "10", "-throttle-burst", "-1"},
+		want: "the throttle burst must not be negative",
+	}, {
+		name: "no throttle period",
+		args: []string{"-throttle-limit", "10", "-throttle-period", "0s"},
+		want: "the throttle period must be positive",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseFilter(test.args)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("ParseFilter() = %v, wanted %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,709 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dataplane
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/aggregate"
+	"github.com/mattmoor/kfilter/pkg/dedupe"
+	"github.com/mattmoor/kfilter/pkg/fieldpath"
+	"github.com/mattmoor/kfilter/pkg/transform"
+)
+
+const (
+	// sentSize is how many of the events that splits sent to their sink are
+	// remembered at once, and sentTTL for how long.
+	sentSize = 10000
+	sentTTL  = 10 * time.Minute
+)
+
+// errorExtension is the extension that holds the error with which an
+// event failed to transform, when it is sent to the dead letter sink.
+const errorExtension = "error"
+
+// schemaViolations counts the results that violated the output schema, by
+// the keyword they violated.  These are served (along with the other
+// expvars) on /debug/vars.
+var schemaViolations = expvar.NewMap("schemaViolations")
+
+// Option customizes how a Transform is built from its args.
+type Option func(*options)
+
+type options struct {
+	lookupEnv func(string) (string, bool)
+	maxLimits transform.Limits
+}
+
+// WithEnv resolves the environment variables that hold the keys of
+// Secrets and ConfigMaps (and the redaction salt) with the given function,
+// rather than from the environment of the process.
+func WithEnv(lookupEnv func(string) (string, bool)) Option {
+	return func(o *options) {
+		o.lookupEnv = lookupEnv
+	}
+}
+
+// WithMaxLimits caps the limits that the args set at the given (non-zero)
+// limits, which also replace any limit that the args disable.
+func WithMaxLimits(l transform.Limits) Option {
+	return func(o *options) {
+		o.maxLimits = l
+	}
+}
+
+// Transform is the data plane of a Transform: it replies with the events
+// that it transforms each event into, and with no event when it filters
+// one.
+type Transform struct {
+	m           transform.Mutator
+	cm          transform.ContextMutator
+	contentType string
+
+	// When r is set, event bodies are redacted before anything else.
+	r transform.Redactor
+
+	// When e is set, event bodies are enriched (after redaction).
+	e transform.Enricher
+
+	// When s is set, events are split rather than mutated, and the results
+	// are sent to sink (or returned as a batch when it is empty).  sent
+	// records the results that were sent, so that redeliveries skip them.
+	s    transform.Splitter
+	sink string
+	sent dedupe.Store
+
+	// When a is set, events are added to its windows (by groupBy) rather
+	// than mutated, and reducer summarizes each window (of the given size)
+	// as it closes, in an event of the given type and source that is sent
+	// to summarySink.
+	a             aggregate.Aggregator
+	reducer       transform.Reducer
+	groupBy       string
+	size          time.Duration
+	slide         time.Duration
+	summaryType   string
+	summarySource string
+	summarySink   string
+
+	// stop is closed to stop closing windows, and done once the windows
+	// are closed (see Start and Close).  pending holds the summarizing
+	// events to retry sending, and is only used by the goroutine that
+	// closes windows.
+	stop    chan struct{}
+	done    chan struct{}
+	pending []summary
+
+	// When schema is set, results that don't conform to it fail to
+	// transform.
+	schema *transform.Schema
+
+	// onError is what to do with events that fail to transform, and
+	// deadLetterSink is where they are sent under the DeadLetter policy.
+	onError        string
+	deadLetterSink string
+}
+
+// TransformFlags defines the flags that configure a Transform on the given
+// FlagSet, and returns a function that builds the Transform they describe
+// once the FlagSet is parsed.
+func TransformFlags(fs *flag.FlagSet, opts ...Option) func() (*Transform, error) {
+	o := &options{lookupEnv: os.LookupEnv}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var (
+		encodedTransform = fs.String("transform", "", "The base64 encoded transform expression.")
+		libraries        = fs.String("libraries", "", "The base64 encoded JSON object of templates (keyed by name) that templates may invoke.")
+		secrets          = fs.String("secrets", "", "The base64 encoded JSON object of the environment variables holding the keys of Secrets, by name and key.")
+		config           = fs.String("config", "", "The base64 encoded JSON object of the environment variables holding the keys of ConfigMaps, by name and key.")
+		mapping          = fs.String("mapping", "", "The base64 encoded JSON list of mapping rules, which replace the transform expression.")
+		patch            = fs.String("patch", "", "The base64 encoded JSON Patch, which replaces the transform expression.")
+		mergePatch       = fs.String("merge-patch", "", "The base64 encoded JSON Merge Patch, which replaces the transform expression.")
+		jq               = fs.String("jq", "", "The base64 encoded jq program, which replaces the transform expression.")
+		script           = fs.String("script", "", "The base64 encoded Starlark script, which replaces the transform expression.")
+		splitPath        = fs.String("split-path", "", "The path of the array to split events into one event per element of.")
+		splitTemplate    = fs.String("split-template", "", "The base64 encoded transform expression for each element of a split.")
+		splitSink        = fs.String("split-sink", "", "The URI to send split events to (defaults to replying with a batch).")
+		aggregateSize    = fs.Duration("aggregate-size", 0, "How long each aggregation window is open (setting it enables aggregation).")
+		aggregateSlide   = fs.Duration("aggregate-slide", 0, "How often an aggregation window opens (defaults to the size).")
+		aggregateGroupBy = fs.String("aggregate-group-by", "", "The path into the body whose value groups aggregated events.")
+		aggregateTmpl    = fs.String("aggregate-template", "", "The base64 encoded transform expression for the event summarizing each window.")
+		aggregateType    = fs.String("aggregate-type", "", "The cloud event type of the events summarizing each window.")
+		aggregateSource  = fs.String("aggregate-source", "", "The cloud event source of the events summarizing each window.")
+		aggregateSink    = fs.String("aggregate-sink", "", "The URI to send the events summarizing each window to.")
+		aggregateGroups  = fs.Int("aggregate-max-groups", aggregate.DefaultMaxGroups, "How many groups may have open aggregation windows at once.")
+		aggregateEvents  = fs.Int("aggregate-max-events", aggregate.DefaultMaxEvents, "How many events an aggregation window may hold.")
+		redact           = fs.String("redact", "", "The base64 encoded JSON redaction to apply to event bodies (salted by $REDACT_SALT).")
+		enrich           = fs.String("enrich", "", "The base64 encoded JSON list of lookups whose results are merged into event bodies.")
+		onError          = fs.String("on-error", "Drop", "What to do with events that fail to transform: Drop, Pass, Reject or DeadLetter.")
+		deadLetterSink   = fs.String("dead-letter-sink", "", "The URI to send events that fail to transform to (with the DeadLetter policy).")
+		timeout          = fs.Duration("timeout", transform.DefaultTimeout, "How long transforming an event may take.")
+		maxOutputBytes   = fs.Int("max-output-bytes", transform.DefaultMaxOutputBytes, "How large the result of transforming an event may be.")
+		maxDepth         = fs.Int("max-depth", transform.DefaultMaxDepth, "How deeply templates may invoke one another.")
+		maxSteps         = fs.Int("max-steps", transform.DefaultMaxSteps, "How many computation steps scripts may take.")
+		format           = fs.String("format", string(transform.YAML), "The syntax the transform expression renders (YAML or JSON).")
+		dataModel        = fs.String("data-model", string(transform.Body), "What the transform expression is executed against (Body or Event).")
+		attributes       = fs.String("attributes", "", "The base64 encoded JSON templates for the cloud event attributes of the result.")
+		contentType      = fs.String("content-type", "", "The content type of the results (defaults to that of the input).")
+		outputSchema     = fs.String("output-schema", "", "The base64 encoded JSON Schema that the results must conform to.")
+		autoEscape       = fs.Bool("auto-escape", false, "Whether to escape the values interpolated by the transform expression.")
+	)
+
+	return func() (*Transform, error) {
+		aggregating := false
+		fs.Visit(func(f *flag.Flag) {
+			aggregating = aggregating || f.Name == "aggregate-size"
+		})
+
+		template, err := base64.StdEncoding.DecodeString(*encodedTransform)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode transform expression: %v", err)
+		}
+
+		opts := []transform.Option{
+			transform.WithFormat(transform.Format(*format)),
+			transform.WithDataModel(transform.DataModel(*dataModel)),
+			transform.WithLimits(o.limits(transform.Limits{
+				Timeout:        *timeout,
+				MaxOutputBytes: *maxOutputBytes,
+				MaxDepth:       *maxDepth,
+				MaxSteps:       *maxSteps,
+			})),
+		}
+		if *autoEscape {
+			opts = append(opts, transform.WithAutoEscape())
+		}
+		if *libraries != "" {
+			var libs map[string]string
+			if err := decodeFlag("libraries", *libraries, &libs); err != nil {
+				return nil, err
+			}
+			opts = append(opts, transform.WithLibraries(libs))
+		}
+		if *secrets != "" {
+			lookup, err := o.lookup("secret", "secrets", *secrets)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, transform.WithSecrets(lookup))
+		}
+		if *config != "" {
+			lookup, err := o.lookup("config", "config", *config)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, transform.WithConfig(lookup))
+		}
+		// Results that aren't JSON are emitted verbatim.
+		if !transform.IsJSON(*contentType) {
+			opts = append(opts, transform.WithFormat(transform.Text))
+		}
+		var redactor transform.Redactor
+		if *redact != "" {
+			var r transform.Redaction
+			if err := decodeFlag("redact", *redact, &r); err != nil {
+				return nil, err
+			}
+			salt, _ := o.lookupEnv("REDACT_SALT")
+			redactor, err = transform.CompileRedaction(r, []byte(salt))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		f := &Transform{
+			contentType: *contentType,
+			sink:        *splitSink,
+		}
+		switch {
+		case aggregating:
+			var tmpl []byte
+			tmpl, err = base64.StdEncoding.DecodeString(*aggregateTmpl)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode -aggregate-template: %v", err)
+			}
+			switch {
+			case *aggregateType == "":
+				return nil, errors.New("aggregation requires a type")
+			case *aggregateSink == "":
+				return nil, errors.New("aggregation requires a sink")
+			}
+			f.a, err = aggregate.New(*aggregateSize, *aggregateSlide, aggregate.NewMemory(*aggregateGroups, *aggregateEvents))
+			if err != nil {
+				return nil, err
+			}
+			f.reducer, err = transform.CompileReducer(string(tmpl), opts...)
+			f.groupBy = *aggregateGroupBy
+			f.size = *aggregateSize
+			f.slide = *aggregateSlide
+			f.summaryType = *aggregateType
+			f.summarySource = *aggregateSource
+			f.summarySink = *aggregateSink
+		case *splitPath != "":
+			var tmpl []byte
+			tmpl, err = base64.StdEncoding.DecodeString(*splitTemplate)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode -split-template: %v", err)
+			}
+			f.s, err = transform.CompileSplit(*splitPath, string(tmpl), opts...)
+			if err == nil && f.sink != "" {
+				f.sent, err = dedupe.NewLRU(sentSize, sentTTL)
+			}
+		case *mapping != "":
+			var rules []transform.MappingRule
+			if err := decodeFlag("mapping", *mapping, &rules); err != nil {
+				return nil, err
+			}
+			f.m, err = transform.CompileMapping(rules, opts...)
+		case *patch != "":
+			var ops []transform.PatchOperation
+			if err := decodeFlag("patch", *patch, &ops); err != nil {
+				return nil, err
+			}
+			f.m, err = transform.CompilePatch(ops, opts...)
+		case *mergePatch != "":
+			var mp json.RawMessage
+			if err := decodeFlag("merge-patch", *mergePatch, &mp); err != nil {
+				return nil, err
+			}
+			f.m, err = transform.CompileMergePatch(mp, opts...)
+		case *jq != "":
+			var program []byte
+			program, err = base64.StdEncoding.DecodeString(*jq)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode -jq: %v", err)
+			}
+			f.m, err = transform.CompileJQ(string(program), opts...)
+		case *script != "":
+			var source []byte
+			source, err = base64.StdEncoding.DecodeString(*script)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode -script: %v", err)
+			}
+			f.m, err = transform.CompileScript(string(source), opts...)
+		case redactor != nil && len(template) == 0:
+			// On its own, the redaction produces the result.
+			f.m = redacted{}
+		default:
+			f.m, err = transform.Compile(string(template), opts...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.r = redactor
+
+		switch *onError {
+		case "Drop", "Pass", "Reject":
+		case "DeadLetter":
+			if *deadLetterSink == "" {
+				return nil, errors.New("the DeadLetter error policy requires a deadLetterSink")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported error policy: %q", *onError)
+		}
+		f.onError = *onError
+		f.deadLetterSink = *deadLetterSink
+
+		if *enrich != "" {
+			var steps []transform.EnrichStep
+			if err := decodeFlag("enrich", *enrich, &steps); err != nil {
+				return nil, err
+			}
+			f.e, err = transform.CompileEnrichment(steps, 0, opts...)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if *attributes != "" {
+			var at transform.AttributeTemplates
+			if err := decodeFlag("attributes", *attributes, &at); err != nil {
+				return nil, err
+			}
+			f.cm, err = transform.CompileAttributes(at, opts...)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if *outputSchema != "" {
+			if !transform.IsJSON(*contentType) {
+				return nil, errors.New("outputSchema requires a JSON outputContentType")
+			}
+			var schema json.RawMessage
+			if err := decodeFlag("output-schema", *outputSchema, &schema); err != nil {
+				return nil, err
+			}
+			f.schema, err = transform.CompileSchema(schema)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return f, nil
+	}
+}
+
+// ParseTransform returns the Transform that the given args describe.
+func ParseTransform(args []string, opts ...Option) (*Transform, error) {
+	fs := flag.NewFlagSet("transform", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	build := TransformFlags(fs, opts...)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return build()
+}
+
+// limits returns the given limits, capped at the maximum limits (if any).
+func (o *options) limits(l transform.Limits) transform.Limits {
+	max := o.maxLimits
+	if max.Timeout != 0 && (l.Timeout <= 0 || l.Timeout > max.Timeout) {
+		l.Timeout = max.Timeout
+	}
+	if max.MaxOutputBytes != 0 && (l.MaxOutputBytes <= 0 || l.MaxOutputBytes > max.MaxOutputBytes) {
+		l.MaxOutputBytes = max.MaxOutputBytes
+	}
+	if max.MaxDepth != 0 && (l.MaxDepth <= 0 || l.MaxDepth > max.MaxDepth) {
+		l.MaxDepth = max.MaxDepth
+	}
+	if max.MaxSteps != 0 && (l.MaxSteps <= 0 || l.MaxSteps > max.MaxSteps) {
+		l.MaxSteps = max.MaxSteps
+	}
+	return l
+}
+
+// lookup returns a Lookup for the values of the environment variables
+// named by the given flag (by object name and key).  Variables that aren't
+// set (e.g. for optional keys) are omitted.
+func (o *options) lookup(kind, name, value string) (transform.Lookup, error) {
+	var vars map[string]map[string]string
+	if err := decodeFlag(name, value, &vars); err != nil {
+		return nil, err
+	}
+	values := make(map[string]map[string]string, len(vars))
+	for obj, keys := range vars {
+		values[obj] = make(map[string]string, len(keys))
+		for key, variable := range keys {
+			if v, ok := o.lookupEnv(variable); ok {
+				values[obj][key] = v
+			}
+		}
+	}
+	return transform.MapLookup(kind, values), nil
+}
+
+// redacted is the Mutator of a Transform that only redacts: its result is
+// the (already redacted) body.
+type redacted struct{}
+
+func (redacted) Mutate(ctx *cloudevents.EventContext, body interface{}) ([]byte, error) {
+	return json.Marshal(body)
+}
+
+// Splits returns whether the Transform splits each event into many.
+func (f *Transform) Splits() bool {
+	return f.s != nil
+}
+
+// Aggregates returns whether the Transform summarizes windows of events,
+// rather than transforming each event.
+func (f *Transform) Aggregates() bool {
+	return f.a != nil
+}
+
+// ContentType returns the content type of the Transform's results (or
+// the empty string when they have that of the input).
+func (f *Transform) ContentType() string {
+	return f.contentType
+}
+
+// Redact returns the given decoded body with the Transform's redaction
+// (if any) applied.
+func (f *Transform) Redact(payload interface{}) interface{} {
+	if f.r == nil {
+		return payload
+	}
+	return f.r.Redact(payload)
+}
+
+// Apply returns the results of transforming the event with the given
+// context and (redacted and enriched) decoded body, which are empty when
+// the event is filtered.  Results that don't conform to the output schema
+// fail to transform.  This doesn't apply to Transforms that aggregate.
+func (f *Transform) Apply(ctx *cloudevents.EventContext, payload interface{}) ([][]byte, error) {
+	var results [][]byte
+	if f.s != nil {
+		var err error
+		if results, err = f.s.Split(ctx, payload); err != nil {
+			return nil, err
+		}
+	} else {
+		result, err := f.m.Mutate(ctx, payload)
+		if err != nil {
+			return nil, err
+		}
+		// If the transformation returns nothing (or null), then filter this message.
+		if !f.empty(result) {
+			results = [][]byte{result}
+		}
+	}
+	for _, result := range results {
+		if err := f.validate(result); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// Rewrite returns the cloud event attributes of the result(s) of the
+// event with the given context and decoded body.
+func (f *Transform) Rewrite(ctx *cloudevents.EventContext, payload interface{}) (*cloudevents.EventContext, error) {
+	if f.cm != nil {
+		var err error
+		ctx, err = f.cm.MutateContext(ctx, payload)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Leave the original context alone.
+		c := *ctx
+		ctx = &c
+	}
+	if f.contentType != "" {
+		ctx.ContentType = f.contentType
+	}
+	return ctx, nil
+}
+
+// empty returns whether the given result is nothing (or null), which
+// filters the event (or window) it came from.
+func (f *Transform) empty(result []byte) bool {
+	return len(result) == 0 || (transform.IsJSON(f.contentType) && string(result) == "null")
+}
+
+// validate checks that the result conforms to the output schema (if any).
+func (f *Transform) validate(result []byte) error {
+	if f.schema == nil {
+		return nil
+	}
+	return f.schema.Validate(result)
+}
+
+// countViolation counts the given error when it is a violation of the
+// output schema.
+func countViolation(err error) {
+	if se, ok := err.(*transform.SchemaError); ok {
+		schemaViolations.Add(se.Keyword, 1)
+	}
+}
+
+func (f *Transform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	var body json.RawMessage
+	ctx, err := cloudevents.Binary.FromRequest(&body, r)
+	if err != nil {
+		log.Printf("Failed to parse events from the request: %s", err)
+		// TODO: Actually fail this request?
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	log.Printf("Received Context: %+v", ctx)
+	if f.r == nil {
+		// Don't log what the redaction is there to remove.
+		log.Printf("Received body as: %#v", string(body))
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		log.Printf("Failed to unmarshal request body: %s", err)
+		if f.r != nil {
+			// Without a body, there's nothing redacted to pass along.
+			body = nil
+		}
+		f.fail(w, ctx, body, err)
+		return
+	}
+
+	if f.r != nil {
+		payload, _ = f.r.Redact(payload).(map[string]interface{})
+		// Events that fail are passed along redacted.
+		if body, err = json.Marshal(payload); err != nil {
+			log.Printf("Failed to marshal redacted body: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if f.e != nil {
+		enriched, err := f.e.Enrich(ctx, payload)
+		if err != nil {
+			if ee, ok := err.(*transform.EnrichError); ok && ee.Policy == transform.Drop {
+				log.Printf("Skipping %q: %s", ctx.EventType, err)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			// Fail the request, so that the event is redelivered.
+			log.Printf("Failed to enrich payload: %s", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		payload = enriched.(map[string]interface{})
+	}
+
+	if f.a != nil {
+		// Without a group (or when an event lacks it) events are aggregated together.
+		var group string
+		if f.groupBy != "" {
+			group, _ = fieldpath.String(payload, f.groupBy)
+		}
+		if err := f.a.Add(group, time.Now(), payload); err != nil {
+			log.Printf("Failed to aggregate %q: %s", ctx.EventID, err)
+			f.fail(w, ctx, body, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Apply the compiled transformation to the event body.
+	results, err := f.Apply(ctx, payload)
+	if err != nil {
+		log.Printf("Failed to transform payload: %s", err)
+		f.fail(w, ctx, body, err)
+		return
+	}
+	if len(results) == 0 {
+		log.Printf("Skipping: %q", ctx.EventType)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	rewritten, err := f.Rewrite(ctx, payload)
+	if err != nil {
+		log.Printf("Failed to rewrite attributes: %s", err)
+		f.fail(w, ctx, body, err)
+		return
+	}
+
+	if f.s != nil {
+		f.split(w, rewritten, results)
+		return
+	}
+	setHeaders(rewritten, w.Header())
+	w.Write(results[0])
+}
+
+// fail handles an event (with the given context and body) that failed to
+// transform with the given error, according to the error policy.  The body
+// is nil when it may not be passed along (because it couldn't be
+// redacted), in which case the Pass policy drops the event, and the
+// DeadLetter policy sends it without its body.
+func (f *Transform) fail(w http.ResponseWriter, ctx *cloudevents.EventContext, body []byte, err error) {
+	countViolation(err)
+	switch f.onError {
+	case "Pass":
+		if body == nil {
+			log.Printf("Dropping %q rather than passing it along unredacted", ctx.EventID)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// Pass the event along as it was.
+		setHeaders(ctx, w.Header())
+		w.Write(body)
+	case "Reject":
+		// Fail the request, so that the event is redelivered.
+		w.WriteHeader(http.StatusInternalServerError)
+	case "DeadLetter":
+		c := withError(ctx, err)
+		if err := send(f.deadLetterSink, &c, body); err != nil {
+			// Fail the request, so that the event is redelivered.
+			log.Printf("Failed to send %q to the dead letter sink: %s", ctx.EventID, err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// withError returns a copy of the given context, with the given error in
+// its error extension.
+func withError(ctx *cloudevents.EventContext, err error) cloudevents.EventContext {
+	c := *ctx
+	c.Extensions = make(map[string]interface{}, len(ctx.Extensions)+1)
+	for k, v := range ctx.Extensions {
+		c.Extensions[k] = v
+	}
+	c.Extensions[errorExtension] = err.Error()
+	return c
+}
+
+// split delivers the results of splitting an event (with the given
+// rewritten context), either by sending them to the sink or by replying
+// with them as a batch.
+func (f *Transform) split(w http.ResponseWriter, ctx *cloudevents.EventContext, results [][]byte) {
+	// Each of the resulting events gets a distinct id.
+	contexts := make([]cloudevents.EventContext, len(results))
+	for i := range results {
+		contexts[i] = *ctx
+		contexts[i].EventID = fmt.Sprintf("%s-%d", ctx.EventID, i)
+	}
+
+	if f.sink == "" {
+		batch, err := makeBatch(contexts, results)
+		if err != nil {
+			log.Printf("Failed to encode batch: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeBatch)
+		w.Write(batch)
+		return
+	}
+
+	for i, result := range results {
+		// Skip the results that an earlier delivery of the event sent.
+		key := contexts[i].Source + "\n" + contexts[i].EventID
+		if f.sent.Seen(key) {
+			continue
+		}
+		if err := send(f.sink, &contexts[i], result); err != nil {
+			// Fail the request, so that the event is redelivered, and the
+			// results from this one on are sent again.
+			f.sent.Forget(key)
+			log.Printf("Failed to send %q: %s", contexts[i].EventID, err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,485 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dataplane
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/transform"
+)
+
+// b64 base64 encodes the given flag value.
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// newRequest returns a request that delivers an event of the given type
+// with the given body, in the binary encoding.
+func newRequest(t *testing.T, eventType, body string) *http.Request {
+	t.Helper()
+	req, err := cloudevents.Binary.NewRequest("http://transform.default.svc.cluster.local/", json.RawMessage(body), cloudevents.EventContext{
+		EventID:   "1234",
+		EventType: eventType,
+		Source:    "https://github.com/mattmoor/kfilter",
+		EventTime: time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("NewRequest() = %v", err)
+	}
+	return req
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		input      string
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{{
+		name:       "template",
+		args:       []string{"-transform", b64(`number: {{ .issue.number }}`)},
+		input:      `{"issue": {"number": 42}}`,
+		wantStatus: http.StatusOK,
+		wantType:   "dev.knative.foo",
+		wantBody:   `{"number":42}`,
+	}, {
+		name:       "filtered",
+		args:       []string{"-transform", b64(`{{ if .issue }}number: {{ .issue.number }}{{ end }}`)},
+		input:      `{"pull_request": {"number": 42}}`,
+		wantStatus: http.StatusOK,
+	}, {
+		name: "attributes",
+		args: []string{
+			"-jq", b64(`{number: .issue.number}`),
+			"-attributes", b64(`{"type": "dev.knative.issue"}`),
+		},
+		input:      `{"issue": {"number": 42}}`,
+		wantStatus: http.StatusOK,
+		wantType:   "dev.knative.issue",
+		wantBody:   `{"number":42}`,
+	}, {
+		name: "redaction",
+		args: []string{
+			"-redact", b64(`{"remove": ["issue.title"]}`),
+		},
+		input:      `{"issue": {"number": 42, "title": "secret"}}`,
+		wantStatus: http.StatusOK,
+		wantType:   "dev.knative.foo",
+		wantBody:   `{"issue":{"number":42}}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := ParseTransform(test.args)
+			if err != nil {
+				t.Fatalf("ParseTransform() = %v", err)
+			}
+			w := httptest.NewRecorder()
+			f.ServeHTTP(w, newRequest(t, "dev.knative.foo", test.input))
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, wanted %d", w.Code, test.wantStatus)
+			}
+			if got := w.Header().Get(cloudevents.HeaderEventType); got != test.wantType {
+				t.Errorf("type = %q, wanted %q", got, test.wantType)
+			}
+			if got := w.Body.String(); got != test.wantBody {
+				t.Errorf("body = %s, wanted %s", got, test.wantBody)
+			}
+		})
+	}
+}
+
+func TestParseTransformErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{{
+		name: "invalid template",
+		args: []string{"-transform", b64(`{{ .foo`)},
+		want: "template: compiled:1: unclosed action",
+	}, {
+		name: "unknown flag",
+		args: []string{"-bundle", "default/transform-bundle"},
+		want: "flag provided but not defined: -bundle",
+	}, {
+		name: "dead letter without a sink",
+		args: []string{"-on-error", "DeadLetter"},
+		want: "the DeadLetter error policy requires a deadLetterSink",
+	}, {
+		name: "unsupported error policy",
+		args: []string{"-on-error", "Retry"},
+		want: `unsupported error policy: "Retry"`,
+	}, {
+		name: "output schema of text",
+		args: []string{
+			"-content-type", "text/plain",
+			"-output-schema", b64(`{"type": "string"}`),
+		},
+		want: "outputSchema requires a JSON outputContentType",
+	}, {
+		name: "aggregation without a window",
+		args: []string{
+			"-aggregate-size", "0s",
+			"-aggregate-template", b64(`count: {{ .count }}`),
+			"-aggregate-type", "com.acme.checks.summary",
+			"-aggregate-sink", "http://summaries.default.svc.cluster.local",
+		},
+		want: "the window size must be positive",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseTransform(test.args)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("ParseTransform() = %v, wanted %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestMaxLimits(t *testing.T) {
+	max := transform.Limits{
+		Timeout:        time.Second,
+		MaxOutputBytes: 1024,
+		MaxDepth:       10,
+		MaxSteps:       1000,
+	}
+	tests := []struct {
+		name   string
+		limits transform.Limits
+		want   transform.Limits
+	}{{
+		name: "within",
+		limits: transform.Limits{
+			Timeout:        time.Millisecond,
+			MaxOutputBytes: 512,
+			MaxDepth:       5,
+			MaxSteps:       500,
+		},
+		want: transform.Limits{
+			Timeout:        time.Millisecond,
+			MaxOutputBytes: 512,
+			MaxDepth:       5,
+			MaxSteps:       500,
+		},
+	}, {
+		name: "above",
+		limits: transform.Limits{
+			Timeout:        time.Hour,
+			MaxOutputBytes: 1 << 30,
+			MaxDepth:       1 << 30,
+			MaxSteps:       1 << 30,
+		},
+		want: max,
+	}, {
+		name: "disabled",
+		want: max,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := &options{}
+			WithMaxLimits(max)(o)
+			if got := o.limits(test.limits); got != test.want {
+				t.Errorf("limits() = %+v, wanted %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedactedFailures(t *testing.T) {
+	var deadLetters []*http.Request
+	var deadBodies []string
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		deadLetters = append(deadLetters, r)
+		deadBodies = append(deadBodies, string(body))
+	}))
+	defer sink.Close()
+
+	tests := []struct {
+		policy     string
+		wantStatus int
+		wantDead   bool
+	}{{
+		policy:     "Drop",
+		wantStatus: http.StatusOK,
+	}, {
+		policy:     "Pass",
+		wantStatus: http.StatusOK,
+	}, {
+		policy:     "Reject",
+		wantStatus: http.StatusInternalServerError,
+	}, {
+		policy:     "DeadLetter",
+		wantStatus: http.StatusOK,
+		wantDead:   true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			deadLetters, deadBodies = nil, nil
+			f, err := ParseTransform([]string{
+				"-redact", b64(`{"remove": ["password"]}`),
+				"-on-error", test.policy,
+				"-dead-letter-sink", sink.URL,
+			})
+			if err != nil {
+				t.Fatalf("ParseTransform() = %v", err)
+			}
+			// A body that isn't a JSON object can't be redacted.
+			w := httptest.NewRecorder()
+			f.ServeHTTP(w, newRequest(t, "dev.knative.foo", `"password: hunter2"`))
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, wanted %d", w.Code, test.wantStatus)
+			}
+			if got := w.Body.String(); got != "" {
+				t.Errorf("body = %s, wanted none", got)
+			}
+			if got := len(deadLetters) != 0; got != test.wantDead {
+				t.Fatalf("dead lettered = %v, wanted %v", got, test.wantDead)
+			}
+			if test.wantDead && deadBodies[0] != "" {
+				t.Errorf("dead letter body = %s, wanted none", deadBodies[0])
+			}
+		})
+	}
+}
+
+func TestErrorPolicies(t *testing.T) {
+	var deadLetters []*http.Request
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadLetters = append(deadLetters, r)
+	}))
+	defer sink.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	const input = `{"issue":{"number":42}}`
+	tests := []struct {
+		name       string
+		policy     string
+		sink       string
+		wantStatus int
+		wantBody   string
+		wantError  string
+	}{{
+		name:       "drop",
+		policy:     "Drop",
+		wantStatus: http.StatusOK,
+	}, {
+		name:       "pass",
+		policy:     "Pass",
+		wantStatus: http.StatusOK,
+		wantBody:   input,
+	}, {
+		name:       "reject",
+		policy:     "Reject",
+		wantStatus: http.StatusInternalServerError,
+	}, {
+		name:       "dead letter",
+		policy:     "DeadLetter",
+		sink:       sink.URL,
+		wantStatus: http.StatusOK,
+		wantError:  `"error converting YAML to JSON: yaml: line 1: did not find expected ',' or ']'"`,
+	}, {
+		name:       "dead letter sink fails",
+		policy:     "DeadLetter",
+		sink:       broken.URL,
+		wantStatus: http.StatusBadGateway,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deadLetters = nil
+			args := []string{
+				// The template renders invalid YAML.
+				"-transform", b64(`number: [{{ .issue.number }}`),
+				"-on-error", test.policy,
+			}
+			if test.sink != "" {
+				args = append(args, "-dead-letter-sink", test.sink)
+			}
+			f, err := ParseTransform(args)
+			if err != nil {
+				t.Fatalf("ParseTransform() = %v", err)
+			}
+			w := httptest.NewRecorder()
+			f.ServeHTTP(w, newRequest(t, "dev.knative.foo", input))
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, wanted %d", w.Code, test.wantStatus)
+			}
+			if got := w.Body.String(); got != test.wantBody {
+				t.Errorf("body = %s, wanted %s", got, test.wantBody)
+			}
+			if test.wantError == "" {
+				if len(deadLetters) != 0 {
+					t.Errorf("dead lettered %d event(s), wanted none", len(deadLetters))
+				}
+				return
+			}
+			if len(deadLetters) != 1 {
+				t.Fatalf("dead lettered %d event(s), wanted 1", len(deadLetters))
+			}
+			dl := deadLetters[0]
+			if got := dl.Header.Get(cloudevents.HeaderExtensionsPrefix + errorExtension); got != test.wantError {
+				t.Errorf("error extension = %s, wanted %s", got, test.wantError)
+			}
+			if got := dl.Header.Get(cloudevents.HeaderEventID); got != "1234" {
+				t.Errorf("event id = %q, wanted %q", got, "1234")
+			}
+		})
+	}
+}
+
+func TestSplitRedelivery(t *testing.T) {
+	// The sink fails the first attempt to send the second element.
+	var received []string
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(cloudevents.HeaderEventID)
+		received = append(received, id)
+		if id == "1234-1" && len(received) == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer sink.Close()
+
+	f, err := ParseTransform([]string{
+		"-split-path", "items",
+		"-split-sink", sink.URL,
+	})
+	if err != nil {
+		t.Fatalf("ParseTransform() = %v", err)
+	}
+	for _, want := range []int{http.StatusBadGateway, http.StatusOK} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, newRequest(t, "dev.knative.foo", `{"items":[1,2,3]}`))
+		if w.Code != want {
+			t.Errorf("status = %d, wanted %d", w.Code, want)
+		}
+	}
+
+	// The redelivery only sends the elements that weren't sent.
+	want := []string{"1234-0", "1234-1", "1234-1", "1234-2"}
+	if diff := cmp.Diff(want, received); diff != "" {
+		t.Errorf("received (-want, +got) = %v", diff)
+	}
+}
+
+func TestSummaryErrorPolicies(t *testing.T) {
+	var (
+		m           sync.Mutex
+		attempts    int
+		deadLetters []*http.Request
+	)
+	// The sink fails the first summarizing event it receives.
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer sink.Close()
+	deadLetterSink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		deadLetters = append(deadLetters, r)
+	}))
+	defer deadLetterSink.Close()
+
+	tests := []struct {
+		name            string
+		policy          string
+		wait            time.Duration
+		wantAttempts    int
+		wantDeadLetters int
+	}{{
+		name:         "drop",
+		policy:       "Drop",
+		wantAttempts: 1,
+	}, {
+		name:   "reject",
+		policy: "Reject",
+		// Long enough for the window to close, and then be retried.
+		wait:         500 * time.Millisecond,
+		wantAttempts: 2,
+	}, {
+		name:            "dead letter",
+		policy:          "DeadLetter",
+		wantAttempts:    1,
+		wantDeadLetters: 1,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts, deadLetters = 0, nil
+			f, err := ParseTransform([]string{
+				"-aggregate-size", "100ms",
+				"-aggregate-template", b64(`count: {{ .count }}`),
+				"-aggregate-type", "dev.knative.summary",
+				"-aggregate-sink", sink.URL,
+				"-on-error", test.policy,
+				"-dead-letter-sink", deadLetterSink.URL,
+			})
+			if err != nil {
+				t.Fatalf("ParseTransform() = %v", err)
+			}
+			f.Start()
+			w := httptest.NewRecorder()
+			f.ServeHTTP(w, newRequest(t, "dev.knative.foo", `{"issue":{"number":42}}`))
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, wanted %d", w.Code, http.StatusOK)
+			}
+			time.Sleep(test.wait)
+			// Closing sends the summaries of the windows that are open.
+			f.Close()
+
+			m.Lock()
+			defer m.Unlock()
+			if attempts != test.wantAttempts {
+				t.Errorf("sent %d summarizing event(s), wanted %d", attempts, test.wantAttempts)
+			}
+			if len(deadLetters) != test.wantDeadLetters {
+				t.Fatalf("dead lettered %d event(s), wanted %d", len(deadLetters), test.wantDeadLetters)
+			}
+			for _, dl := range deadLetters {
+				if got, want := dl.Header.Get(cloudevents.HeaderExtensionsPrefix+errorExtension), `"unexpected status: 503 Service Unavailable"`; got != want {
+					t.Errorf("error extension = %s, wanted %s", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dataplane
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/aggregate"
+	"github.com/mattmoor/kfilter/pkg/fieldpath"
+)
+
+// endOfTime is after the end of any window.
+var endOfTime = time.Unix(1<<62, 0)
+
+// maxPending is how many summarizing events that failed to send are held
+// for retrying (under the Reject error policy), beyond which the oldest
+// are dropped.
+const maxPending = 1000
+
+// summary is an event summarizing a window.
+type summary struct {
+	ctx  *cloudevents.EventContext
+	body []byte
+}
+
+// Start starts closing the aggregation windows of a Transform that
+// aggregates, until it is closed.  It is called at most once.
+func (f *Transform) Start() {
+	if f.a == nil {
+		return
+	}
+	// Close windows at least as often as they open.
+	interval := time.Second
+	if f.slide != 0 && f.slide < interval {
+		interval = f.slide
+	} else if f.size < interval {
+		interval = f.size
+	}
+	f.stop = make(chan struct{})
+	f.done = make(chan struct{})
+	go f.emit(interval)
+}
+
+// Close stops the Transform from closing aggregation windows, after it
+// closes those that are still open.  It returns once their summarizing
+// events are sent (or have failed to send).
+func (f *Transform) Close() {
+	if f.stop != nil {
+		close(f.stop)
+		<-f.done
+	}
+}
+
+// emit periodically closes the aggregation windows, and sends the events
+// that summarize them to the sink, until the Transform is closed.
+func (f *Transform) emit(interval time.Duration) {
+	defer close(f.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			// Rather than lose the events of the windows that are still
+			// open, close them early.
+			f.flush(endOfTime)
+			if len(f.pending) != 0 {
+				log.Printf("Dropping %d summarizing event(s) that failed to send", len(f.pending))
+			}
+			return
+		case now := <-ticker.C:
+			f.flush(now)
+		}
+	}
+}
+
+// flush closes the aggregation windows that end by the given time, and
+// sends the events that summarize them to the sink, after retrying those
+// that failed to send before.
+func (f *Transform) flush(now time.Time) {
+	pending := f.pending
+	f.pending = nil
+	for _, s := range pending {
+		f.deliver(s)
+	}
+
+	results, err := f.a.Close(now)
+	if err != nil {
+		log.Printf("Failed to close windows: %s", err)
+		return
+	}
+	for _, r := range results {
+		ctx, result, err := f.summarize(r)
+		if err != nil {
+			countViolation(err)
+			log.Printf("Failed to summarize window %q: %s", ctx.EventID, err)
+			f.failSummary(summary{ctx: ctx}, err)
+			continue
+		}
+		if result == nil {
+			log.Printf("Skipping window: %q", ctx.EventID)
+			continue
+		}
+		f.deliver(summary{ctx: ctx, body: result})
+	}
+}
+
+// deliver sends the given summarizing event to the sink, and applies the
+// error policy when it fails to send.
+func (f *Transform) deliver(s summary) {
+	if err := send(f.summarySink, s.ctx, s.body); err != nil {
+		log.Printf("Failed to send %q: %s", s.ctx.EventID, err)
+		f.failSummary(s, err)
+	}
+}
+
+// failSummary handles a summarizing event that failed with the given error,
+// according to the error policy.  Its body is nil when the window failed to
+// summarize.  With no event to reply with, the Pass policy drops it like
+// Drop, and the Reject policy holds those that failed to send to retry at
+// the next flush (since summarizing again would fail the same way).
+func (f *Transform) failSummary(s summary, err error) {
+	switch f.onError {
+	case "Reject":
+		if s.body == nil {
+			return
+		}
+		if len(f.pending) == maxPending {
+			log.Printf("Dropping %q to hold newer summarizing events", f.pending[0].ctx.EventID)
+			f.pending = f.pending[1:]
+		}
+		f.pending = append(f.pending, s)
+	case "DeadLetter":
+		c := withError(s.ctx, err)
+		if err := send(f.deadLetterSink, &c, s.body); err != nil {
+			log.Printf("Failed to send %q to the dead letter sink: %s", s.ctx.EventID, err)
+		}
+	}
+}
+
+// Summarize returns the body of the event that summarizes a window of the
+// given (redacted and enriched) events, starting at the given time, which
+// is nil when the window emits nothing.  The window belongs to the group
+// of the first event.
+func (f *Transform) Summarize(start time.Time, events []interface{}) ([]byte, error) {
+	var group string
+	if f.groupBy != "" && len(events) != 0 {
+		group, _ = fieldpath.String(events[0], f.groupBy)
+	}
+	_, result, err := f.summarize(aggregate.Result{
+		Window: aggregate.Window{
+			Group: group,
+			Start: start,
+			End:   start.Add(f.size),
+		},
+		Events: events,
+	})
+	return result, err
+}
+
+// summarize returns the context and body of the event that summarizes the
+// given window, where the body is nil when the window emits nothing.
+// Bodies that don't conform to the output schema fail to summarize.
+func (f *Transform) summarize(r aggregate.Result) (*cloudevents.EventContext, []byte, error) {
+	ctx := &cloudevents.EventContext{
+		CloudEventsVersion: cloudevents.CloudEventsVersion,
+		EventID:            fmt.Sprintf("%s-%d", r.Group, r.End.UnixNano()),
+		EventType:          f.summaryType,
+		Source:             f.summarySource,
+		EventTime:          r.End,
+		ContentType:        f.contentType,
+	}
+	if ctx.ContentType == "" {
+		ctx.ContentType = "application/json"
+	}
+	result, err := f.reducer.Reduce(ctx, r)
+	if err != nil {
+		return ctx, nil, err
+	}
+	if f.empty(result) {
+		return ctx, nil, nil
+	}
+	if err := f.validate(result); err != nil {
+		return ctx, nil, err
+	}
+	return ctx, result, nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedupe
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// Store records the identifiers of the events that have been seen.
+type Store interface {
+	// Seen records the identifier and returns whether it had already
+	// been recorded within the Store's window.
+	Seen(id string) bool
+
+	// Forget removes the identifier, so that the event is seen anew when
+	// it is redelivered (e.g. after it was rejected).
+	Forget(id string)
+}
+
+// NewLRU returns an in-memory Store that remembers identifiers for
+// the given ttl, and at most size of them at a time.
+func NewLRU(size int, ttl time.Duration) (Store, error) {
+	cache, err := simplelru.NewLRU(size, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &lru{
+		cache: cache,
+		ttl:   ttl,
+		now:   time.Now,
+	}, nil
+}
+
+type lru struct {
+	m     sync.Mutex
+	cache *simplelru.LRU
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// lru implements Store
+var _ Store = (*lru)(nil)
+
+func (l *lru) Seen(id string) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := l.now()
+	if v, ok := l.cache.Get(id); ok {
+		if now.Sub(v.(time.Time)) < l.ttl {
+			return true
+		}
+	}
+	// Either we haven't seen this or it has expired, so (re)start
+	// the window from now.
+	l.cache.Add(id, now)
+	return false
+}
+
+func (l *lru) Forget(id string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.cache.Remove(id)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedupe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	s, err := NewLRU(2, time.Minute)
+	if err != nil {
+		t.Fatalf("NewLRU() = %v", err)
+	}
+	now := time.Now()
+	s.(*lru).now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		id      string
+		want    bool
+	}{{
+		name: "first sighting",
+		id:   "foo",
+		want: false,
+	}, {
+		name: "redelivery",
+		id:   "foo",
+		want: true,
+	}, {
+		name:    "redelivery within the window",
+		advance: 30 * time.Second,
+		id:      "foo",
+		want:    true,
+	}, {
+		name: "another event",
+		id:   "bar",
+		want: false,
+	}, {
+		name:    "redelivery after the window",
+		advance: 31 * time.Second,
+		id:      "foo",
+		want:    false,
+	}, {
+		name: "third event evicts the oldest",
+		id:   "baz",
+		want: false,
+	}, {
+		name: "evicted event is forgotten",
+		id:   "bar",
+		want: false,
+	}}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if got := s.Seen(step.id); got != step.want {
+			t.Errorf("%s: Seen(%q) = %v, wanted %v", step.name, step.id, got, step.want)
+		}
+	}
+}
+
+func TestForget(t *testing.T) {
+	s, err := NewLRU(2, time.Minute)
+	if err != nil {
+		t.Fatalf("NewLRU() = %v", err)
+	}
+	if s.Seen("foo") {
+		t.Error("Seen(foo) = true, wanted false")
+	}
+	s.Forget("foo")
+	if s.Seen("foo") {
+		t.Error("Seen(foo) = true after Forget, wanted false")
+	}
+	if !s.Seen("foo") {
+		t.Error("Seen(foo) = false, wanted true")
+	}
+}
+
+func TestNewLRUFailure(t *testing.T) {
+	if s, err := NewLRU(0, time.Minute); err == nil {
+		t.Errorf("NewLRU(0) = %v, wanted error", s)
+	}
+}
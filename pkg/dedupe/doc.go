@@ -0,0 +1,22 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dedupe remembers the identifiers of recently seen events so
+// that redeliveries of the same event can be dropped.  Identifiers are
+// remembered for a bounded window of time, and the in-memory Store
+// bounds the number of identifiers it keeps.  Alternative Store
+// implementations may be used to share this state across replicas.
+package dedupe
@@ -0,0 +1,230 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fieldpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Get returns the value found at the given path within obj, and
+// whether such a value exists.  The empty path selects obj itself.
+func Get(obj interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return obj, true
+	}
+	for _, elt := range strings.Split(path, ".") {
+		switch o := obj.(type) {
+		case map[string]interface{}:
+			v, ok := o[elt]
+			if !ok {
+				return nil, false
+			}
+			obj = v
+		case []interface{}:
+			idx, err := strconv.Atoi(elt)
+			if err != nil || idx < 0 || idx >= len(o) {
+				return nil, false
+			}
+			obj = o[idx]
+		default:
+			return nil, false
+		}
+	}
+	return obj, true
+}
+
+// String returns the value found at the given path within obj as a
+// string, and whether such a value exists.  Non-string values are
+// rendered as JSON.
+func String(obj interface{}, path string) (string, bool) {
+	v, ok := Get(obj, path)
+	if !ok {
+		return "", false
+	}
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v), true
+	}
+	return string(b), true
+}
+
+// Set stores value at the given path within obj, creating objects along
+// the way as needed, and returns the (possibly new) root.  The empty path
+// replaces obj altogether.  Array elements may be replaced, but arrays are
+// never extended.
+func Set(obj interface{}, path string, value interface{}) (interface{}, error) {
+	if path == "" {
+		return value, nil
+	}
+	return set(obj, strings.Split(path, "."), value, path)
+}
+
+func set(obj interface{}, elts []string, value interface{}, path string) (interface{}, error) {
+	if len(elts) == 0 {
+		return value, nil
+	}
+	elt, rest := elts[0], elts[1:]
+	switch o := obj.(type) {
+	case nil:
+		v, err := set(nil, rest, value, path)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{elt: v}, nil
+	case map[string]interface{}:
+		v, err := set(o[elt], rest, value, path)
+		if err != nil {
+			return nil, err
+		}
+		o[elt] = v
+		return o, nil
+	case []interface{}:
+		idx, err := strconv.Atoi(elt)
+		if err != nil || idx < 0 || idx >= len(o) {
+			return nil, fmt.Errorf("cannot set %q: %q is not an index of the array", path, elt)
+		}
+		v, err := set(o[idx], rest, value, path)
+		if err != nil {
+			return nil, err
+		}
+		o[idx] = v
+		return o, nil
+	default:
+		return nil, fmt.Errorf("cannot set %q: %q is within a %T", path, elt, obj)
+	}
+}
+
+// Delete removes the value at the given path within obj (if any).  Array
+// elements are removed by shifting the subsequent elements down.  It
+// returns the (possibly new) root, which is nil when path is empty.
+func Delete(obj interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	elts := strings.Split(path, ".")
+	parent, ok := Get(obj, strings.Join(elts[:len(elts)-1], "."))
+	if !ok {
+		return obj
+	}
+	last := elts[len(elts)-1]
+	switch o := parent.(type) {
+	case map[string]interface{}:
+		delete(o, last)
+	case []interface{}:
+		idx, err := strconv.Atoi(last)
+		if err != nil || idx < 0 || idx >= len(o) {
+			return obj
+		}
+		// Arrays can't shrink in place, so store the shorter one.
+		shorter := append(o[:idx:idx], o[idx+1:]...)
+		if len(elts) == 1 {
+			return shorter
+		}
+		// The parent exists, so this cannot fail.
+		obj, _ = Set(obj, strings.Join(elts[:len(elts)-1], "."), shorter)
+	}
+	return obj
+}
+
+// Wildcard is the path element that matches every key of an object, or
+// every element of an array (e.g. "commits.*.author.email").
+const Wildcard = "*"
+
+// Update replaces every value matching the given path within obj (which
+// may contain Wildcard elements) with the result of f, or removes it when
+// f returns false.  Array elements are removed by shifting the subsequent
+// elements down.  It returns the (possibly new) root, which is nil when
+// the root itself is removed.
+func Update(obj interface{}, path string, f func(interface{}) (interface{}, bool)) interface{} {
+	if path == "" {
+		if v, ok := f(obj); ok {
+			return v
+		}
+		return nil
+	}
+	v, _ := update(obj, strings.Split(path, "."), f)
+	return v
+}
+
+func update(obj interface{}, elts []string, f func(interface{}) (interface{}, bool)) (interface{}, bool) {
+	if len(elts) == 0 {
+		return f(obj)
+	}
+	elt, rest := elts[0], elts[1:]
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for k, v := range o {
+			if elt != Wildcard && elt != k {
+				continue
+			}
+			if nv, ok := update(v, rest, f); ok {
+				o[k] = nv
+			} else {
+				delete(o, k)
+			}
+		}
+		return o, true
+	case []interface{}:
+		idx := -1
+		if elt != Wildcard {
+			var err error
+			idx, err = strconv.Atoi(elt)
+			if err != nil || idx < 0 || idx >= len(o) {
+				return o, true
+			}
+		}
+		result := o[:0]
+		for i, v := range o {
+			if idx >= 0 && i != idx {
+				result = append(result, v)
+				continue
+			}
+			if nv, ok := update(v, rest, f); ok {
+				result = append(result, nv)
+			}
+		}
+		return result, true
+	default:
+		return obj, true
+	}
+}
+
+// Copy returns a deep copy of the given decoded JSON value.
+func Copy(obj interface{}) interface{} {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(o))
+		for k, v := range o {
+			result[k] = Copy(v)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, 0, len(o))
+		for _, v := range o {
+			result = append(result, Copy(v))
+		}
+		return result
+	default:
+		return obj
+	}
+}
@@ -0,0 +1,427 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fieldpath
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGet(t *testing.T) {
+	obj := map[string]interface{}{
+		"foo": "bar",
+		"baz": map[string]interface{}{
+			"blah": true,
+		},
+		"list": []interface{}{
+			"a",
+			map[string]interface{}{
+				"b": 1234.5,
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		want   interface{}
+		wantOK bool
+	}{{
+		name:   "empty path",
+		path:   "",
+		want:   obj,
+		wantOK: true,
+	}, {
+		name:   "top-level key",
+		path:   "foo",
+		want:   "bar",
+		wantOK: true,
+	}, {
+		name:   "nested key",
+		path:   "baz.blah",
+		want:   true,
+		wantOK: true,
+	}, {
+		name:   "array index",
+		path:   "list.0",
+		want:   "a",
+		wantOK: true,
+	}, {
+		name:   "key within array element",
+		path:   "list.1.b",
+		want:   1234.5,
+		wantOK: true,
+	}, {
+		name: "missing key",
+		path: "nope",
+	}, {
+		name: "missing nested key",
+		path: "baz.nope",
+	}, {
+		name: "index out of range",
+		path: "list.2",
+	}, {
+		name: "non-numeric index",
+		path: "list.first",
+	}, {
+		name: "descend into scalar",
+		path: "foo.bar",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := Get(obj, test.path)
+			if ok != test.wantOK {
+				t.Fatalf("Get(%q) = %v, wanted %v", test.path, ok, test.wantOK)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Get(%q) (-want +got): %v", test.path, diff)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	obj := map[string]interface{}{
+		"foo": "bar",
+		"baz": map[string]interface{}{
+			"blah": 1234.5,
+		},
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		want   string
+		wantOK bool
+	}{{
+		name:   "string value",
+		path:   "foo",
+		want:   "bar",
+		wantOK: true,
+	}, {
+		name:   "number value",
+		path:   "baz.blah",
+		want:   "1234.5",
+		wantOK: true,
+	}, {
+		name:   "object value",
+		path:   "baz",
+		want:   `{"blah":1234.5}`,
+		wantOK: true,
+	}, {
+		name: "missing key",
+		path: "nope",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := String(obj, test.path)
+			if ok != test.wantOK {
+				t.Fatalf("String(%q) = %v, wanted %v", test.path, ok, test.wantOK)
+			}
+			if got != test.want {
+				t.Errorf("String(%q) = %q, wanted %q", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	newObj := func() map[string]interface{} {
+		return map[string]interface{}{
+			"foo": "bar",
+			"list": []interface{}{
+				map[string]interface{}{"a": 1.0},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		obj     interface{}
+		path    string
+		value   interface{}
+		want    interface{}
+		wantErr bool
+	}{{
+		name:  "empty path",
+		obj:   newObj(),
+		value: "replaced",
+		want:  "replaced",
+	}, {
+		name:  "replace top-level key",
+		obj:   newObj(),
+		path:  "foo",
+		value: 42.0,
+		want: map[string]interface{}{
+			"foo": 42.0,
+			"list": []interface{}{
+				map[string]interface{}{"a": 1.0},
+			},
+		},
+	}, {
+		name:  "create nested keys",
+		obj:   newObj(),
+		path:  "baz.blah",
+		value: true,
+		want: map[string]interface{}{
+			"foo": "bar",
+			"baz": map[string]interface{}{"blah": true},
+			"list": []interface{}{
+				map[string]interface{}{"a": 1.0},
+			},
+		},
+	}, {
+		name:  "set within array element",
+		obj:   newObj(),
+		path:  "list.0.b",
+		value: "c",
+		want: map[string]interface{}{
+			"foo": "bar",
+			"list": []interface{}{
+				map[string]interface{}{"a": 1.0, "b": "c"},
+			},
+		},
+	}, {
+		name:  "nil root",
+		path:  "a.b",
+		value: "c",
+		want: map[string]interface{}{
+			"a": map[string]interface{}{"b": "c"},
+		},
+	}, {
+		name:    "index out of range",
+		obj:     newObj(),
+		path:    "list.1",
+		value:   "c",
+		wantErr: true,
+	}, {
+		name:    "descend into scalar",
+		obj:     newObj(),
+		path:    "foo.bar",
+		value:   "c",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Set(test.obj, test.path, test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Set(%q) = %v, wanted error: %v", test.path, err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Set(%q) (-want +got): %v", test.path, diff)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	newObj := func() map[string]interface{} {
+		return map[string]interface{}{
+			"foo": "bar",
+			"baz": map[string]interface{}{
+				"list": []interface{}{"a", "b", "c"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		path string
+		want interface{}
+	}{{
+		name: "empty path",
+		obj:  newObj(),
+	}, {
+		name: "top-level key",
+		obj:  newObj(),
+		path: "foo",
+		want: map[string]interface{}{
+			"baz": map[string]interface{}{
+				"list": []interface{}{"a", "b", "c"},
+			},
+		},
+	}, {
+		name: "array element",
+		obj:  newObj(),
+		path: "baz.list.1",
+		want: map[string]interface{}{
+			"foo": "bar",
+			"baz": map[string]interface{}{
+				"list": []interface{}{"a", "c"},
+			},
+		},
+	}, {
+		name: "top-level array element",
+		obj:  []interface{}{"a", "b"},
+		path: "0",
+		want: []interface{}{"b"},
+	}, {
+		name: "missing key",
+		obj:  newObj(),
+		path: "baz.nope.nada",
+		want: newObj(),
+	}, {
+		name: "index out of range",
+		obj:  newObj(),
+		path: "baz.list.3",
+		want: newObj(),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Delete(test.obj, test.path)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Delete(%q) (-want +got): %v", test.path, diff)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	newObj := func() map[string]interface{} {
+		return map[string]interface{}{
+			"foo": "bar",
+			"commits": []interface{}{
+				map[string]interface{}{"id": "a", "email": "a@acme.com"},
+				map[string]interface{}{"id": "b", "email": "b@acme.com"},
+			},
+		}
+	}
+	upper := func(v interface{}) (interface{}, bool) {
+		if s, ok := v.(string); ok {
+			return strings.ToUpper(s), true
+		}
+		return v, true
+	}
+	remove := func(interface{}) (interface{}, bool) {
+		return nil, false
+	}
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		path string
+		f    func(interface{}) (interface{}, bool)
+		want interface{}
+	}{{
+		name: "empty path",
+		obj:  "bar",
+		f:    upper,
+		want: "BAR",
+	}, {
+		name: "remove root",
+		obj:  newObj(),
+		f:    remove,
+	}, {
+		name: "top-level key",
+		obj:  newObj(),
+		path: "foo",
+		f:    upper,
+		want: map[string]interface{}{
+			"foo": "BAR",
+			"commits": []interface{}{
+				map[string]interface{}{"id": "a", "email": "a@acme.com"},
+				map[string]interface{}{"id": "b", "email": "b@acme.com"},
+			},
+		},
+	}, {
+		name: "wildcard element",
+		obj:  newObj(),
+		path: "commits.*.email",
+		f:    remove,
+		want: map[string]interface{}{
+			"foo": "bar",
+			"commits": []interface{}{
+				map[string]interface{}{"id": "a"},
+				map[string]interface{}{"id": "b"},
+			},
+		},
+	}, {
+		name: "wildcard key",
+		obj:  newObj(),
+		path: "commits.1.*",
+		f:    upper,
+		want: map[string]interface{}{
+			"foo": "bar",
+			"commits": []interface{}{
+				map[string]interface{}{"id": "a", "email": "a@acme.com"},
+				map[string]interface{}{"id": "B", "email": "B@ACME.COM"},
+			},
+		},
+	}, {
+		name: "remove array element",
+		obj:  newObj(),
+		path: "commits.0",
+		f:    remove,
+		want: map[string]interface{}{
+			"foo": "bar",
+			"commits": []interface{}{
+				map[string]interface{}{"id": "b", "email": "b@acme.com"},
+			},
+		},
+	}, {
+		name: "missing key",
+		obj:  newObj(),
+		path: "commits.*.nope",
+		f:    remove,
+		want: newObj(),
+	}, {
+		name: "index out of range",
+		obj:  newObj(),
+		path: "commits.2.id",
+		f:    remove,
+		want: newObj(),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Update(test.obj, test.path, test.f)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Update(%q) (-want +got): %v", test.path, diff)
+			}
+		})
+	}
+}
+
+func TestCopy(t *testing.T) {
+	obj := map[string]interface{}{
+		"foo": "bar",
+		"list": []interface{}{
+			map[string]interface{}{"a": 1.0},
+		},
+	}
+
+	got := Copy(obj)
+	if diff := cmp.Diff(obj, got); diff != "" {
+		t.Fatalf("Copy() (-want +got): %v", diff)
+	}
+
+	// Modifying the copy should not affect the original.
+	got.(map[string]interface{})["list"].([]interface{})[0].(map[string]interface{})["a"] = 2.0
+	if got, want := obj["list"].([]interface{})[0].(map[string]interface{})["a"], 1.0; got != want {
+		t.Errorf("original = %v, wanted %v", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Selector decides which events a Filter keeps, from their type and body.
+// Both the data plane and the spec tests use it, so that the tests check
+// exactly the decision that the data plane makes.
+type Selector struct {
+	eventType string
+	matcher   Matcher
+	invert    bool
+}
+
+// NewSelector compiles a Selector for events of the given type (any type
+// when empty) whose body matches the given filter expression (any body
+// when empty).  When inverted, it selects the events that don't match.
+func NewSelector(eventType string, expression []byte, invert bool) (*Selector, error) {
+	// Without a filter expression, match any body.
+	pattern := map[string]interface{}{}
+	if len(expression) != 0 {
+		if err := json.Unmarshal(expression, &pattern); err != nil {
+			return nil, fmt.Errorf("invalid filter expression: %v", err)
+		}
+	}
+	matcher, err := Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression: %v", err)
+	}
+	return &Selector{
+		eventType: eventType,
+		matcher:   matcher,
+		invert:    invert,
+	}, nil
+}
+
+// Skip returns why the Selector skips the event with the given type and
+// decoded body, or the empty string when it keeps the event.  The reason
+// is "type" or "body" for events that don't match, and "matched" for
+// events that match an inverted Selector.
+func (s *Selector) Skip(eventType string, body interface{}) string {
+	reason := s.mismatch(eventType, body)
+	if !s.invert {
+		return reason
+	}
+	// When inverted, keep only the events that don't match.
+	if reason == "" {
+		return "matched"
+	}
+	return ""
+}
+
+// mismatch returns why the event doesn't match the event type and body
+// pattern, or the empty string when it matches.
+func (s *Selector) mismatch(eventType string, body interface{}) string {
+	// If specified, only match events of this type.
+	if s.eventType != "" && eventType != s.eventType {
+		return "type"
+	}
+	// Check to see if the compiled filter matches the body.
+	if !s.matcher.Match(body) {
+		return "body"
+	}
+	return ""
+}
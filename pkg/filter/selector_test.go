@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSelector(t *testing.T) {
+	tests := []struct {
+		name       string
+		eventType  string
+		expression string
+		invert     bool
+		inputType  string
+		input      string
+		want       string
+	}{{
+		name:      "no type or expression",
+		inputType: "dev.knative.foo",
+		input:     `{"foo": "bar"}`,
+	}, {
+		name:       "match",
+		eventType:  "dev.knative.foo",
+		expression: `{"foo": "bar"}`,
+		inputType:  "dev.knative.foo",
+		input:      `{"foo": "bar", "baz": true}`,
+	}, {
+		name:      "wrong type",
+		eventType: "dev.knative.foo",
+		inputType: "dev.knative.bar",
+		input:     `{"foo": "bar"}`,
+		want:      "type",
+	}, {
+		name:       "wrong body",
+		expression: `{"foo": "bar"}`,
+		inputType:  "dev.knative.foo",
+		input:      `{"foo": "baz"}`,
+		want:       "body",
+	}, {
+		name:       "inverted match",
+		expression: `{"foo": "bar"}`,
+		invert:     true,
+		inputType:  "dev.knative.foo",
+		input:      `{"foo": "bar"}`,
+		want:       "matched",
+	}, {
+		name:      "inverted mismatch",
+		eventType: "dev.knative.foo",
+		invert:    true,
+		inputType: "dev.knative.bar",
+		input:     `{"foo": "bar"}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewSelector(test.eventType, []byte(test.expression), test.invert)
+			if err != nil {
+				t.Fatalf("NewSelector() = %v", err)
+			}
+			var body interface{}
+			if err := json.Unmarshal([]byte(test.input), &body); err != nil {
+				t.Fatalf("Unmarshal() = %v", err)
+			}
+			if got := s.Skip(test.inputType, body); got != test.want {
+				t.Errorf("Skip() = %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectorErrors(t *testing.T) {
+	if _, err := NewSelector("", []byte(`{"foo": `), false); err == nil {
+		t.Error("NewSelector() = nil, wanted an invalid expression error")
+	}
+}
@@ -18,10 +18,13 @@ package kfilter
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 
+	"github.com/ghodss/yaml"
 	"github.com/knative/pkg/controller"
+	"github.com/knative/pkg/tracker"
 	servinginformers "github.com/knative/serving/pkg/client/informers/externalversions/serving/v1alpha1"
 	servinglisters "github.com/knative/serving/pkg/client/listers/serving/v1alpha1"
 	"github.com/knative/serving/pkg/reconciler"
@@ -31,16 +34,23 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	rbacv1informers "k8s.io/client-go/informers/rbac/v1"
 	"k8s.io/client-go/kubernetes/scheme"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
 	"k8s.io/client-go/tools/cache"
 
 	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/bundle"
 	clientset "github.com/mattmoor/kfilter/pkg/client/clientset/versioned"
 	kfilterscheme "github.com/mattmoor/kfilter/pkg/client/clientset/versioned/scheme"
 	informers "github.com/mattmoor/kfilter/pkg/client/informers/externalversions/kfilter/v1alpha1"
 	listers "github.com/mattmoor/kfilter/pkg/client/listers/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/dataplane"
 	"github.com/mattmoor/kfilter/pkg/reconciler/kfilter/resources"
 	"github.com/mattmoor/kfilter/pkg/reconciler/kfilter/resources/names"
+	"github.com/mattmoor/kfilter/pkg/spectest"
 )
 
 const controllerAgentName = "kfilter-controller"
@@ -53,8 +63,14 @@ type Reconciler struct {
 
 	filterImage string
 
-	serviceLister servinglisters.ServiceLister
-	filterLister  listers.FilterLister
+	serviceLister        servinglisters.ServiceLister
+	filterLister         listers.FilterLister
+	configMapLister      corev1listers.ConfigMapLister
+	serviceAccountLister corev1listers.ServiceAccountLister
+	roleLister           rbacv1listers.RoleLister
+	roleBindingLister    rbacv1listers.RoleBindingLister
+
+	tracker tracker.Interface
 }
 
 // Check that we implement the controller.Reconciler interface.
@@ -72,14 +88,22 @@ func NewController(
 	kfilterclientset clientset.Interface,
 	serviceInformer servinginformers.ServiceInformer,
 	filterInformer informers.FilterInformer,
+	configMapInformer corev1informers.ConfigMapInformer,
+	serviceAccountInformer corev1informers.ServiceAccountInformer,
+	roleInformer rbacv1informers.RoleInformer,
+	roleBindingInformer rbacv1informers.RoleBindingInformer,
 	filterImage string,
 ) *controller.Impl {
 	r := &Reconciler{
-		Base:             reconciler.NewBase(opt, controllerAgentName),
-		kfilterclientset: kfilterclientset,
-		serviceLister:    serviceInformer.Lister(),
-		filterLister:     filterInformer.Lister(),
-		filterImage:      filterImage,
+		Base:                 reconciler.NewBase(opt, controllerAgentName),
+		kfilterclientset:     kfilterclientset,
+		serviceLister:        serviceInformer.Lister(),
+		filterLister:         filterInformer.Lister(),
+		configMapLister:      configMapInformer.Lister(),
+		serviceAccountLister: serviceAccountInformer.Lister(),
+		roleLister:           roleInformer.Lister(),
+		roleBindingLister:    roleBindingInformer.Lister(),
+		filterImage:          filterImage,
 	}
 	impl := controller.NewImpl(r, r.Logger, "Filters",
 		reconciler.MustNewStatsReporter("Filters", r.Logger))
@@ -103,6 +127,40 @@ func NewController(
 		},
 	})
 
+	// Set up an event handler for when the resources of bundles that we own change.
+	for _, informer := range []cache.SharedIndexInformer{
+		configMapInformer.Informer(),
+		serviceAccountInformer.Informer(),
+		roleInformer.Informer(),
+		roleBindingInformer.Informer(),
+	} {
+		informer.AddEventHandler(cache.FilteringResourceEventHandler{
+			FilterFunc: controller.Filter(kfv1alpha1.SchemeGroupVersion.WithKind("Filter")),
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc:    impl.EnqueueControllerOf,
+				UpdateFunc: controller.PassNew(impl.EnqueueControllerOf),
+				DeleteFunc: impl.EnqueueControllerOf,
+			},
+		})
+	}
+
+	// Set up an event handler for when ConfigMaps referenced by Filters change.
+	r.tracker = tracker.New(impl.EnqueueKey, opt.GetTrackerLease())
+	configMapInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.EnsureTypeMeta(
+			r.tracker.OnChanged,
+			corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		),
+		UpdateFunc: controller.PassNew(controller.EnsureTypeMeta(
+			r.tracker.OnChanged,
+			corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		)),
+		DeleteFunc: controller.EnsureTypeMeta(
+			r.tracker.OnChanged,
+			corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		),
+	})
+
 	return impl
 }
 
@@ -145,12 +203,124 @@ func (c *Reconciler) Reconcile(ctx context.Context, key string) error {
 }
 
 func (c *Reconciler) reconcile(ctx context.Context, kf *kfv1alpha1.Filter) error {
+	kf.Status.InitializeConditions()
+
+	body, err := c.resolveBody(kf)
+	if err != nil {
+		return err
+	}
+
+	// Report Filters that are invalid here, rather than deploying a
+	// Service that will fail to start.
+	if _, err := dataplane.ParseFilter(resources.MakeArgs(kf, body)); err != nil {
+		kf.Status.MarkCompileFailed("CompileFailed", "%v", err)
+		return err
+	}
+	kf.Status.MarkCompiled()
+
+	// Don't deploy filters that fail their own tests.
+	if err := test(kf, body); err != nil {
+		return err
+	}
+
+	if err := c.reconcileBundle(ctx, kf, body); err != nil {
+		return err
+	}
 	if err := c.reconcileService(ctx, kf); err != nil {
 		return err
 	}
 	return nil
 }
 
+// resolveBody returns the filter expression that the Filter applies,
+// resolving it from the resource it references when necessary.
+func (c *Reconciler) resolveBody(kf *kfv1alpha1.Filter) (json.RawMessage, error) {
+	if kf.Spec.BodyFrom == nil || kf.Spec.BodyFrom.ConfigMapKeyRef == nil {
+		kf.Status.MarkReferencesResolved()
+		return kf.Spec.Body, nil
+	}
+	ref := kf.Spec.BodyFrom.ConfigMapKeyRef
+	optional := ref.Optional != nil && *ref.Optional
+
+	// Track the ConfigMap, so that we are requeued when it changes.
+	if err := c.tracker.Track(corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Namespace:  kf.Namespace,
+		Name:       ref.Name,
+	}, kf); err != nil {
+		return nil, err
+	}
+
+	cm, err := c.configMapLister.ConfigMaps(kf.Namespace).Get(ref.Name)
+	if apierrs.IsNotFound(err) {
+		if optional {
+			kf.Status.MarkReferencesResolved()
+			return nil, nil
+		}
+		kf.Status.MarkReferencesUnresolved("ConfigMapMissing",
+			"ConfigMap %q does not exist.", ref.Name)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	value, ok := cm.Data[ref.Key]
+	if !ok {
+		if optional {
+			kf.Status.MarkReferencesResolved()
+			return nil, nil
+		}
+		kf.Status.MarkReferencesUnresolved("KeyMissing",
+			"ConfigMap %q does not have the key %q.", ref.Name, ref.Key)
+		return nil, fmt.Errorf("configmap %q does not have key %q", ref.Name, ref.Key)
+	}
+
+	// Filters are authored as JSON, but accept YAML from ConfigMaps.
+	body, err := yaml.YAMLToJSON([]byte(value))
+	if err != nil {
+		kf.Status.MarkReferencesUnresolved("InvalidBody",
+			"ConfigMap %q key %q is not valid JSON or YAML: %v", ref.Name, ref.Key, err)
+		return nil, err
+	}
+	kf.Status.MarkReferencesResolved()
+	return body, nil
+}
+
+// test runs the tests embedded in the Filter's spec against the given
+// filter expression, and reports the outcome on its status.
+func test(kf *kfv1alpha1.Filter, body json.RawMessage) error {
+	if len(kf.Spec.Tests) == 0 {
+		kf.Status.MarkTestsPassed()
+		return nil
+	}
+	f, err := spectest.CompileFilter(kf.Spec, body)
+	if err != nil {
+		kf.Status.MarkTestsFailed("CompileFailed", "%v", err)
+		return err
+	}
+	if err := f.Test(kf.Spec.Tests); err != nil {
+		kf.Status.MarkTestsFailed("TestFailed", "%v", err)
+		return err
+	}
+	kf.Status.MarkTestsPassed()
+	return nil
+}
+
+// reconcileBundle ships the filter expression to the data plane.  Since the
+// data plane reloads its bundle, this doesn't touch the Knative Service.
+func (c *Reconciler) reconcileBundle(ctx context.Context, kf *kfv1alpha1.Filter, body json.RawMessage) error {
+	r := &bundle.Reconciler{
+		KubeClientSet:        c.KubeClientSet,
+		ConfigMapLister:      c.configMapLister,
+		ServiceAccountLister: c.serviceAccountLister,
+		RoleLister:           c.roleLister,
+		RoleBindingLister:    c.roleBindingLister,
+	}
+	return r.Reconcile(kf, resources.MakeConfigMap(kf, body),
+		resources.MakeServiceAccount(kf), resources.MakeRole(kf), resources.MakeRoleBinding(kf))
+}
+
 func (c *Reconciler) reconcileService(ctx context.Context, kf *kfv1alpha1.Filter) error {
 	svcName := names.KService(kf)
 	service, err := c.serviceLister.Services(kf.Namespace).Get(svcName)
@@ -20,12 +20,16 @@ import (
 	"testing"
 
 	"github.com/knative/pkg/controller"
+	"github.com/knative/pkg/tracker"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"github.com/knative/serving/pkg/reconciler"
 	. "github.com/knative/serving/pkg/reconciler/testing"
 	v1alpha1testing "github.com/knative/serving/pkg/reconciler/v1alpha1/testing"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	clientgotesting "k8s.io/client-go/testing"
 
 	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
 	clientset "github.com/mattmoor/kfilter/pkg/client/clientset/versioned"
@@ -37,6 +41,16 @@ const filterImage = "filter:image"
 
 // This is heavily based on the way the OpenShift Ingress controller tests its reconciliation method.
 func TestReconcile(t *testing.T) {
+	opened := kfv1alpha1.FilterTest{
+		Name:  "opened",
+		Input: []byte(`{"action": "opened"}`),
+		Keep:  true,
+	}
+	closed := kfv1alpha1.FilterTest{
+		Name:  "closed",
+		Input: []byte(`{"action": "closed"}`),
+	}
+
 	table := TableTest{{
 		Name: "bad workqueue key",
 		Key:  "too/many/parts",
@@ -51,7 +65,152 @@ func TestReconcile(t *testing.T) {
 		},
 		WantCreates: []metav1.Object{
 			svc(kf("bar", "foo")),
+			bundleCM(kf("bar", "foo")),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithInitFilterConditions, WithFilterReferencesResolved, WithFilterCompiled, WithFilterTestsPassed),
+		}},
+	}, {
+		Name: "create knative service with passing tests",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithBody(`{"action": "opened"}`), WithFilterTests(opened, closed)),
+		},
+		WantCreates: []metav1.Object{
+			svc(kf("bar", "foo", WithBody(`{"action": "opened"}`), WithFilterTests(opened, closed))),
+			bundleCM(kf("bar", "foo", WithBody(`{"action": "opened"}`), WithFilterTests(opened, closed))),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithBody(`{"action": "opened"}`), WithFilterTests(opened, closed),
+				WithInitFilterConditions, WithFilterReferencesResolved, WithFilterCompiled, WithFilterTestsPassed),
+		}},
+	}, {
+		Name: "failing test",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithBody(`{"action": "closed"}`), WithFilterTests(opened)),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithBody(`{"action": "closed"}`), WithFilterTests(opened),
+				WithInitFilterConditions, WithFilterReferencesResolved, WithFilterCompiled,
+				WithFilterTestsFailed("TestFailed", `test "opened": expected the event to be kept, but it was skipped`)),
+		}},
+	}, {
+		Name: "invalid throttle",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithFilterThrottle(&kfv1alpha1.ThrottleSpec{Limit: 10, Policy: "Queue"})),
 		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithFilterThrottle(&kfv1alpha1.ThrottleSpec{Limit: 10, Policy: "Queue"}),
+				WithInitFilterConditions, WithFilterReferencesResolved,
+				WithFilterCompileFailed("CompileFailed", `unsupported throttle policy: "Queue"`)),
+		}},
+	}, {
+		Name: "throttle without a limit",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithFilterThrottle(&kfv1alpha1.ThrottleSpec{Burst: 10})),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithFilterThrottle(&kfv1alpha1.ThrottleSpec{Burst: 10}),
+				WithInitFilterConditions, WithFilterReferencesResolved,
+				WithFilterCompileFailed("CompileFailed", "the throttle limit must be positive")),
+		}},
+	}, {
+		Name: "invalid filter expression",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithBody(`["foo"]`)),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithBody(`["foo"]`),
+				WithInitFilterConditions, WithFilterReferencesResolved,
+				WithFilterCompileFailed("CompileFailed", "invalid filter expression: json: cannot unmarshal array into Go value of type map[string]interface {}")),
+		}},
+	}, {
+		Name: "create knative service with body from configmap",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar")),
+			cm("patterns", "foo", map[string]string{
+				"bar": "foo: bar",
+			}),
+		},
+		WantCreates: []metav1.Object{
+			svc(kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar"))),
+			bundleCMWithBody(kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar")), `{"foo":"bar"}`),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar"),
+				WithInitFilterConditions, WithFilterReferencesResolved, WithFilterCompiled, WithFilterTestsPassed),
+		}},
+	}, {
+		Name: "update bundle when the configmap changes",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar"),
+				WithInitFilterConditions, WithFilterReferencesResolved, WithFilterCompiled, WithFilterTestsPassed),
+			svc(kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar"))),
+			bundleCMWithBody(kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar")), `{"foo":"bar"}`),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+			cm("patterns", "foo", map[string]string{
+				"bar": `{"foo": "baz"}`,
+			}),
+		},
+		// The data plane reloads its bundle, so the Knative Service (and
+		// with it the Revision) is left alone.
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: bundleCMWithBody(kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar")), `{"foo":"baz"}`),
+		}},
+	}, {
+		Name: "bundle name taken",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo"),
+			cm("bar-bundle", "foo", map[string]string{
+				"bar": "foo: bar",
+			}),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithInitFilterConditions, WithFilterReferencesResolved, WithFilterCompiled, WithFilterTestsPassed),
+		}},
+	}, {
+		Name: "missing configmap",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar"),
+				WithInitFilterConditions,
+				WithFilterReferencesUnresolved("ConfigMapMissing", `ConfigMap "patterns" does not exist.`)),
+		}},
+	}, {
+		Name: "missing configmap key",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar")),
+			cm("patterns", "foo", map[string]string{
+				"baz": "foo: bar",
+			}),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithBodyFromConfigMap("patterns", "bar"),
+				WithInitFilterConditions,
+				WithFilterReferencesUnresolved("KeyMissing", `ConfigMap "patterns" does not have the key "bar".`)),
+		}},
 	}}
 
 	// TODO(mattmoor): Correct the Knative Service
@@ -60,11 +219,16 @@ func TestReconcile(t *testing.T) {
 	table.Test(t, MakeFactory(func(listers *Listers, opt reconciler.Options,
 		kfClient clientset.Interface) controller.Reconciler {
 		return &Reconciler{
-			Base:             reconciler.NewBase(opt, controllerAgentName),
-			kfilterclientset: kfClient,
-			serviceLister:    listers.GetServiceLister(),
-			filterLister:     listers.GetFilterLister(),
-			filterImage:      filterImage,
+			Base:                 reconciler.NewBase(opt, controllerAgentName),
+			kfilterclientset:     kfClient,
+			serviceLister:        listers.GetServiceLister(),
+			filterLister:         listers.GetFilterLister(),
+			configMapLister:      listers.GetConfigMapLister(),
+			serviceAccountLister: listers.GetServiceAccountLister(),
+			roleLister:           listers.GetRoleLister(),
+			roleBindingLister:    listers.GetRoleBindingLister(),
+			filterImage:          filterImage,
+			tracker:              tracker.New(func(string) {}, 0),
 		}
 	}))
 }
@@ -93,3 +257,33 @@ func svc(kf *kfv1alpha1.Filter, opts ...v1alpha1testing.ServiceOption) *v1alpha1
 
 	return svc
 }
+
+func bundleCM(kf *kfv1alpha1.Filter) *corev1.ConfigMap {
+	return bundleCMWithBody(kf, string(kf.Spec.Body))
+}
+
+func bundleCMWithBody(kf *kfv1alpha1.Filter, body string) *corev1.ConfigMap {
+	return resources.MakeConfigMap(kf, []byte(body))
+}
+
+func serviceAccount(kf *kfv1alpha1.Filter) *corev1.ServiceAccount {
+	return resources.MakeServiceAccount(kf)
+}
+
+func role(kf *kfv1alpha1.Filter) *rbacv1.Role {
+	return resources.MakeRole(kf)
+}
+
+func binding(kf *kfv1alpha1.Filter) *rbacv1.RoleBinding {
+	return resources.MakeRoleBinding(kf)
+}
+
+func cm(name, namespace string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: data,
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/bundle"
+	"github.com/mattmoor/kfilter/pkg/reconciler/kfilter/resources/names"
+)
+
+// MakeConfigMap creates the ConfigMap that holds the args of the Filter's
+// data plane (see MakeArgs), with the given filter expression.
+func MakeConfigMap(kf *kfv1alpha1.Filter, body json.RawMessage) *corev1.ConfigMap {
+	return bundle.MakeConfigMap(kf, names.Bundle(kf), MakeArgs(kf, body))
+}
+
+// MakeServiceAccount creates the service account that the Filter's data
+// plane runs as.
+func MakeServiceAccount(kf *kfv1alpha1.Filter) *corev1.ServiceAccount {
+	return bundle.MakeServiceAccount(kf, names.Bundle(kf))
+}
+
+// MakeRole creates the Role that allows the Filter's data plane to read its
+// ConfigMap.
+func MakeRole(kf *kfv1alpha1.Filter) *rbacv1.Role {
+	return bundle.MakeRole(kf, names.Bundle(kf))
+}
+
+// MakeRoleBinding creates the RoleBinding that grants the Filter's Role
+// to its data plane.
+func MakeRoleBinding(kf *kfv1alpha1.Filter) *rbacv1.RoleBinding {
+	return bundle.MakeRoleBinding(kf, names.Bundle(kf))
+}
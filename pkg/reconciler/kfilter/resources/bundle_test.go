@@ -0,0 +1,67 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/bundle"
+)
+
+func TestMakeConfigMap(t *testing.T) {
+	kf := &kfv1alpha1.Filter{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "baz",
+		},
+		Spec: kfv1alpha1.FilterSpec{
+			EventType: "dev.knative.source.github.push",
+			Body:      []byte(`{"foo":"bar"}`),
+		},
+	}
+
+	cm := MakeConfigMap(kf, kf.Spec.Body)
+	if got, want := cm.Namespace+"/"+cm.Name, "baz/foo-bundle"; got != want {
+		t.Errorf("MakeConfigMap() = %v, wanted %v", got, want)
+	}
+	args, hash, err := bundle.Args(cm)
+	if err != nil {
+		t.Fatalf("Args() = %v", err)
+	}
+	want := MakeArgs(kf, kf.Spec.Body)
+	if diff := cmp.Diff(want, args); diff != "" {
+		t.Errorf("Unexpected args (-want +got): %v", diff)
+	}
+	if got, want := hash, bundle.Hash(want); got != want {
+		t.Errorf("Args() hash = %v, wanted %v", got, want)
+	}
+
+	// The service account, Role and RoleBinding share the ConfigMap's name.
+	if got, want := MakeServiceAccount(kf).Name, cm.Name; got != want {
+		t.Errorf("MakeServiceAccount() = %v, wanted %v", got, want)
+	}
+	if got, want := MakeRole(kf).Name, cm.Name; got != want {
+		t.Errorf("MakeRole() = %v, wanted %v", got, want)
+	}
+	if got, want := MakeRoleBinding(kf).RoleRef.Name, cm.Name; got != want {
+		t.Errorf("MakeRoleBinding() = %v, wanted %v", got, want)
+	}
+}
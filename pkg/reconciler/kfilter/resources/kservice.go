@@ -18,6 +18,8 @@ package resources
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"strconv"
 
 	"github.com/knative/pkg/kmeta"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
@@ -25,12 +27,60 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/bundle"
 	"github.com/mattmoor/kfilter/pkg/reconciler/kfilter/resources/names"
 )
 
-func MakeKService(kf *kfv1alpha1.Filter, image string) *v1alpha1.Service {
-	encodedFilter := base64.StdEncoding.EncodeToString(kf.Spec.Body)
+// MakeArgs returns the args with which the data plane applies the given
+// filter expression (either the Filter's Body, or the one it references)
+// on behalf of the Filter.
+func MakeArgs(kf *kfv1alpha1.Filter, body json.RawMessage) []string {
+	encodedFilter := base64.StdEncoding.EncodeToString(body)
 
+	args := []string{
+		"-type", kf.Spec.EventType,
+		"-filter", encodedFilter,
+	}
+	if kf.Spec.Invert {
+		args = append(args, "-invert")
+	}
+	if dd := kf.Spec.Deduplicate; dd != nil {
+		args = append(args, "-dedupe")
+		if dd.Key != "" {
+			args = append(args, "-dedupe-key", dd.Key)
+		}
+		if dd.TTL != nil {
+			args = append(args, "-dedupe-ttl", dd.TTL.Duration.String())
+		}
+		if dd.Size != 0 {
+			args = append(args, "-dedupe-size", strconv.Itoa(dd.Size))
+		}
+	}
+	if th := kf.Spec.Throttle; th != nil {
+		args = append(args, "-throttle-limit", strconv.Itoa(th.Limit))
+		if th.Period != nil {
+			args = append(args, "-throttle-period", th.Period.Duration.String())
+		}
+		if th.Burst != 0 {
+			args = append(args, "-throttle-burst", strconv.Itoa(th.Burst))
+		}
+		if th.Key != "" {
+			args = append(args, "-throttle-key", th.Key)
+		}
+		if th.Policy != "" {
+			args = append(args, "-throttle-policy", string(th.Policy))
+		}
+	}
+	if kf.Spec.Mode == kfv1alpha1.FilterModeDryRun {
+		args = append(args, "-dry-run")
+	}
+	return args
+}
+
+// MakeKService creates a Knative Service that applies the Filter on its
+// behalf.  The Service reads its args from the Filter's bundle (see
+// MakeConfigMap), so that they can change without creating a new Revision.
+func MakeKService(kf *kfv1alpha1.Filter, image string) *v1alpha1.Service {
 	return &v1alpha1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            names.KService(kf),
@@ -43,12 +93,13 @@ func MakeKService(kf *kfv1alpha1.Filter, image string) *v1alpha1.Service {
 				Configuration: v1alpha1.ConfigurationSpec{
 					RevisionTemplate: v1alpha1.RevisionTemplateSpec{
 						Spec: v1alpha1.RevisionSpec{
+							ServiceAccountName: names.Bundle(kf),
 							Container: corev1.Container{
 								Image: image,
 								Args: []string{
-									"-type", kf.Spec.EventType,
-									"-filter", encodedFilter,
+									"-bundle", kf.Namespace + "/" + names.Bundle(kf),
 								},
+								ReadinessProbe: bundle.MakeReadinessProbe(),
 							},
 						},
 					},
@@ -18,6 +18,7 @@ package resources
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
@@ -27,14 +28,11 @@ import (
 	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
 )
 
-func TestMakeVirtualService(t *testing.T) {
-	boolTrue := true
-
+func TestMakeArgs(t *testing.T) {
 	tests := []struct {
 		name string
 		kf   *kfv1alpha1.Filter
-		img  string
-		want *v1alpha1.Service
+		want []string
 	}{{
 		name: "test simple alias",
 		kf: &kfv1alpha1.Filter{
@@ -44,41 +42,155 @@ func TestMakeVirtualService(t *testing.T) {
 			},
 			// TODO(mattmoor): Spec
 		},
-		img: "foo",
-		want: &v1alpha1.Service{
+		want: []string{
+			"-type", "",
+			"-filter", "",
+		},
+	}, {
+		name: "test deduplication",
+		kf: &kfv1alpha1.Filter{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      "foo",
 				Namespace: "baz",
-				OwnerReferences: []metav1.OwnerReference{{
-					APIVersion:         "kfilter.mattmoor.io/v1alpha1",
-					Kind:               "Filter",
-					Name:               "foo",
-					Controller:         &boolTrue,
-					BlockOwnerDeletion: &boolTrue,
-				}},
 			},
-			Spec: v1alpha1.ServiceSpec{
-				RunLatest: &v1alpha1.RunLatestType{
-					Configuration: v1alpha1.ConfigurationSpec{
-						RevisionTemplate: v1alpha1.RevisionTemplateSpec{
-							Spec: v1alpha1.RevisionSpec{
-								Container: corev1.Container{
-									Image: "foo",
-								},
-							},
-						},
-					},
+			Spec: kfv1alpha1.FilterSpec{
+				EventType: "dev.knative.source.github.push",
+				Body:      []byte(`{"foo":"bar"}`),
+				Deduplicate: &kfv1alpha1.DeduplicateSpec{
+					Key:  "delivery.id",
+					TTL:  &metav1.Duration{Duration: 5 * time.Minute},
+					Size: 100,
+				},
+			},
+		},
+		want: []string{
+			"-type", "dev.knative.source.github.push",
+			"-filter", "eyJmb28iOiJiYXIifQ==",
+			"-dedupe",
+			"-dedupe-key", "delivery.id",
+			"-dedupe-ttl", "5m0s",
+			"-dedupe-size", "100",
+		},
+	}, {
+		name: "test throttling",
+		kf: &kfv1alpha1.Filter{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.FilterSpec{
+				Throttle: &kfv1alpha1.ThrottleSpec{
+					Limit:  10,
+					Period: &metav1.Duration{Duration: time.Minute},
+					Burst:  5,
+					Key:    "repository",
+					Policy: kfv1alpha1.ThrottlePolicyReject,
 				},
 			},
 		},
+		want: []string{
+			"-type", "",
+			"-filter", "",
+			"-throttle-limit", "10",
+			"-throttle-period", "1m0s",
+			"-throttle-burst", "5",
+			"-throttle-key", "repository",
+			"-throttle-policy", "Reject",
+		},
+	}, {
+		name: "test dry run",
+		kf: &kfv1alpha1.Filter{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.FilterSpec{
+				EventType: "dev.knative.source.github.issues",
+				Mode:      kfv1alpha1.FilterModeDryRun,
+			},
+		},
+		want: []string{
+			"-type", "dev.knative.source.github.issues",
+			"-filter", "",
+			"-dry-run",
+		},
+	}, {
+		name: "test invert",
+		kf: &kfv1alpha1.Filter{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.FilterSpec{
+				EventType: "dev.knative.source.github.issues",
+				Invert:    true,
+			},
+		},
+		want: []string{
+			"-type", "dev.knative.source.github.issues",
+			"-filter", "",
+			"-invert",
+		},
 	}}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := MakeKService(test.kf, test.img)
+			got := MakeArgs(test.kf, test.kf.Spec.Body)
 			if diff := cmp.Diff(test.want, got); diff != "" {
-				t.Errorf("Unexpected KService (-want +got): %v", diff)
+				t.Errorf("Unexpected args (-want +got): %v", diff)
 			}
 		})
 	}
 }
+
+func TestMakeKService(t *testing.T) {
+	boolTrue := true
+	kf := &kfv1alpha1.Filter{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "baz",
+		},
+		Spec: kfv1alpha1.FilterSpec{
+			EventType: "dev.knative.source.github.push",
+			Body:      []byte(`{"foo":"bar"}`),
+		},
+	}
+	want := &v1alpha1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "baz",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion:         "kfilter.mattmoor.io/v1alpha1",
+				Kind:               "Filter",
+				Name:               "foo",
+				Controller:         &boolTrue,
+				BlockOwnerDeletion: &boolTrue,
+			}},
+		},
+		Spec: v1alpha1.ServiceSpec{
+			RunLatest: &v1alpha1.RunLatestType{
+				Configuration: v1alpha1.ConfigurationSpec{
+					RevisionTemplate: v1alpha1.RevisionTemplateSpec{
+						Spec: v1alpha1.RevisionSpec{
+							ServiceAccountName: "foo-bundle",
+							Container: corev1.Container{
+								Image: "foo",
+								Args:  []string{"-bundle", "baz/foo-bundle"},
+								ReadinessProbe: &corev1.Probe{
+									Handler: corev1.Handler{
+										HTTPGet: &corev1.HTTPGetAction{Path: "/ready"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	got := MakeKService(kf, "foo")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected KService (-want +got): %v", diff)
+	}
+}
@@ -24,3 +24,10 @@ import (
 func KService(i *kfv1alpha1.Filter) string {
 	return i.Name
 }
+
+// Bundle returns the name of the ConfigMap (and of the Role and RoleBinding
+// that grant access to it) that holds the configuration of the data plane
+// of the given Filter.
+func Bundle(i *kfv1alpha1.Filter) string {
+	return i.Name + "-bundle"
+}
@@ -22,6 +22,7 @@ import (
 	"reflect"
 
 	"github.com/knative/pkg/controller"
+	"github.com/knative/pkg/tracker"
 	servinginformers "github.com/knative/serving/pkg/client/informers/externalversions/serving/v1alpha1"
 	servinglisters "github.com/knative/serving/pkg/client/listers/serving/v1alpha1"
 	"github.com/knative/serving/pkg/reconciler"
@@ -31,16 +32,22 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	rbacv1informers "k8s.io/client-go/informers/rbac/v1"
 	"k8s.io/client-go/kubernetes/scheme"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
 	"k8s.io/client-go/tools/cache"
 
 	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/bundle"
 	clientset "github.com/mattmoor/kfilter/pkg/client/clientset/versioned"
 	kfilterscheme "github.com/mattmoor/kfilter/pkg/client/clientset/versioned/scheme"
 	informers "github.com/mattmoor/kfilter/pkg/client/informers/externalversions/kfilter/v1alpha1"
 	listers "github.com/mattmoor/kfilter/pkg/client/listers/kfilter/v1alpha1"
 	"github.com/mattmoor/kfilter/pkg/reconciler/ktransform/resources"
 	"github.com/mattmoor/kfilter/pkg/reconciler/ktransform/resources/names"
+	"github.com/mattmoor/kfilter/pkg/spectest"
 )
 
 const controllerAgentName = "ktransform-controller"
@@ -53,8 +60,14 @@ type Reconciler struct {
 
 	transformImage string
 
-	serviceLister   servinglisters.ServiceLister
-	transformLister listers.TransformLister
+	serviceLister        servinglisters.ServiceLister
+	transformLister      listers.TransformLister
+	configMapLister      corev1listers.ConfigMapLister
+	serviceAccountLister corev1listers.ServiceAccountLister
+	roleLister           rbacv1listers.RoleLister
+	roleBindingLister    rbacv1listers.RoleBindingLister
+
+	tracker tracker.Interface
 }
 
 // Check that we implement the controller.Reconciler interface.
@@ -72,14 +85,22 @@ func NewController(
 	kfilterclientset clientset.Interface,
 	serviceInformer servinginformers.ServiceInformer,
 	transformInformer informers.TransformInformer,
+	configMapInformer corev1informers.ConfigMapInformer,
+	serviceAccountInformer corev1informers.ServiceAccountInformer,
+	roleInformer rbacv1informers.RoleInformer,
+	roleBindingInformer rbacv1informers.RoleBindingInformer,
 	transformImage string,
 ) *controller.Impl {
 	r := &Reconciler{
-		Base:             reconciler.NewBase(opt, controllerAgentName),
-		kfilterclientset: kfilterclientset,
-		serviceLister:    serviceInformer.Lister(),
-		transformLister:  transformInformer.Lister(),
-		transformImage:   transformImage,
+		Base:                 reconciler.NewBase(opt, controllerAgentName),
+		kfilterclientset:     kfilterclientset,
+		serviceLister:        serviceInformer.Lister(),
+		transformLister:      transformInformer.Lister(),
+		configMapLister:      configMapInformer.Lister(),
+		serviceAccountLister: serviceAccountInformer.Lister(),
+		roleLister:           roleInformer.Lister(),
+		roleBindingLister:    roleBindingInformer.Lister(),
+		transformImage:       transformImage,
 	}
 	impl := controller.NewImpl(r, r.Logger, "Transforms",
 		reconciler.MustNewStatsReporter("Transforms", r.Logger))
@@ -103,6 +124,40 @@ func NewController(
 		},
 	})
 
+	// Set up an event handler for when the resources of bundles that we own change.
+	for _, informer := range []cache.SharedIndexInformer{
+		configMapInformer.Informer(),
+		serviceAccountInformer.Informer(),
+		roleInformer.Informer(),
+		roleBindingInformer.Informer(),
+	} {
+		informer.AddEventHandler(cache.FilteringResourceEventHandler{
+			FilterFunc: controller.Filter(kfv1alpha1.SchemeGroupVersion.WithKind("Transform")),
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc:    impl.EnqueueControllerOf,
+				UpdateFunc: controller.PassNew(impl.EnqueueControllerOf),
+				DeleteFunc: impl.EnqueueControllerOf,
+			},
+		})
+	}
+
+	// Set up an event handler for when ConfigMaps referenced by Transforms change.
+	r.tracker = tracker.New(impl.EnqueueKey, opt.GetTrackerLease())
+	configMapInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.EnsureTypeMeta(
+			r.tracker.OnChanged,
+			corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		),
+		UpdateFunc: controller.PassNew(controller.EnsureTypeMeta(
+			r.tracker.OnChanged,
+			corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		)),
+		DeleteFunc: controller.EnsureTypeMeta(
+			r.tracker.OnChanged,
+			corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		),
+	})
+
 	return impl
 }
 
@@ -145,12 +200,97 @@ func (c *Reconciler) Reconcile(ctx context.Context, key string) error {
 }
 
 func (c *Reconciler) reconcile(ctx context.Context, kf *kfv1alpha1.Transform) error {
+	kf.Status.InitializeConditions()
+
+	libraries, err := c.resolveLibraries(kf)
+	if err != nil {
+		return err
+	}
+
+	// Report programs that don't compile here, rather than deploying a
+	// Service that will fail to start.
+	t, err := spectest.CompileTransform(kf, libraries)
+	if err != nil {
+		kf.Status.MarkCompileFailed("CompileFailed", "%v", err)
+		return err
+	}
+	kf.Status.MarkCompiled()
+
+	// Likewise, don't deploy programs that fail their own tests.
+	if err := t.Test(kf.Spec.Tests); err != nil {
+		kf.Status.MarkTestsFailed("TestFailed", "%v", err)
+		return err
+	}
+	kf.Status.MarkTestsPassed()
+
+	if err := c.reconcileBundle(ctx, kf, libraries); err != nil {
+		return err
+	}
 	if err := c.reconcileService(ctx, kf); err != nil {
 		return err
 	}
 	return nil
 }
 
+// resolveLibraries returns the templates in the ConfigMaps that the
+// Transform lists as libraries, keyed by name.
+func (c *Reconciler) resolveLibraries(kf *kfv1alpha1.Transform) (map[string]string, error) {
+	if len(kf.Spec.Libraries) == 0 {
+		kf.Status.MarkReferencesResolved()
+		return nil, nil
+	}
+
+	libraries := make(map[string]string)
+	definedBy := make(map[string]string)
+	for _, ref := range kf.Spec.Libraries {
+		// Track the ConfigMap, so that we are requeued when it changes.
+		if err := c.tracker.Track(corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Namespace:  kf.Namespace,
+			Name:       ref.Name,
+		}, kf); err != nil {
+			return nil, err
+		}
+
+		cm, err := c.configMapLister.ConfigMaps(kf.Namespace).Get(ref.Name)
+		if apierrs.IsNotFound(err) {
+			kf.Status.MarkReferencesUnresolved("ConfigMapMissing",
+				"ConfigMap %q does not exist.", ref.Name)
+			return nil, err
+		} else if err != nil {
+			return nil, err
+		}
+
+		for name, tmpl := range cm.Data {
+			if other, ok := definedBy[name]; ok {
+				kf.Status.MarkReferencesUnresolved("DuplicateLibrary",
+					"ConfigMaps %q and %q both have the key %q.", other, ref.Name, name)
+				return nil, fmt.Errorf("configmaps %q and %q both have key %q", other, ref.Name, name)
+			}
+			definedBy[name] = ref.Name
+			libraries[name] = tmpl
+		}
+	}
+	kf.Status.MarkReferencesResolved()
+	return libraries, nil
+}
+
+// reconcileBundle ships the template (along with its libraries) to the data
+// plane.  Since the data plane reloads its bundle, this doesn't touch the
+// Knative Service.
+func (c *Reconciler) reconcileBundle(ctx context.Context, kf *kfv1alpha1.Transform, libraries map[string]string) error {
+	r := &bundle.Reconciler{
+		KubeClientSet:        c.KubeClientSet,
+		ConfigMapLister:      c.configMapLister,
+		ServiceAccountLister: c.serviceAccountLister,
+		RoleLister:           c.roleLister,
+		RoleBindingLister:    c.roleBindingLister,
+	}
+	return r.Reconcile(kf, resources.MakeConfigMap(kf, libraries),
+		resources.MakeServiceAccount(kf), resources.MakeRole(kf), resources.MakeRoleBinding(kf))
+}
+
 func (c *Reconciler) reconcileService(ctx context.Context, kf *kfv1alpha1.Transform) error {
 	svcName := names.KService(kf)
 	service, err := c.serviceLister.Services(kf.Namespace).Get(svcName)
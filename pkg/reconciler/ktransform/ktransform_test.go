@@ -20,12 +20,16 @@ import (
 	"testing"
 
 	"github.com/knative/pkg/controller"
+	"github.com/knative/pkg/tracker"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	"github.com/knative/serving/pkg/reconciler"
 	. "github.com/knative/serving/pkg/reconciler/testing"
 	v1alpha1testing "github.com/knative/serving/pkg/reconciler/v1alpha1/testing"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	clientgotesting "k8s.io/client-go/testing"
 
 	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
 	clientset "github.com/mattmoor/kfilter/pkg/client/clientset/versioned"
@@ -37,6 +41,16 @@ const transformImage = "transform:image"
 
 // This is heavily based on the way the OpenShift Ingress controller tests its reconciliation method.
 func TestReconcile(t *testing.T) {
+	badRedaction := &kfv1alpha1.TransformRedaction{
+		Mask: []kfv1alpha1.MaskRule{{Pattern: "("}},
+	}
+	identity := "def transform(event):\n  return event\n"
+	issue := kfv1alpha1.TransformTest{
+		Name:   "issue",
+		Input:  []byte(`{"issue": {"number": 42}}`),
+		Output: []byte(`{"id": 42}`),
+	}
+
 	table := TableTest{{
 		Name: "bad workqueue key",
 		Key:  "too/many/parts",
@@ -51,7 +65,218 @@ func TestReconcile(t *testing.T) {
 		},
 		WantCreates: []metav1.Object{
 			svc(kf("bar", "foo")),
+			bundleCM(kf("bar", "foo")),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithInitTransformConditions, WithTransformReferencesResolved, WithTransformCompiled, WithTransformTestsPassed),
+		}},
+	}, {
+		Name: "create knative service with jq",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithJQ(".issue")),
+		},
+		WantCreates: []metav1.Object{
+			svc(kf("bar", "foo", WithJQ(".issue"))),
+			bundleCM(kf("bar", "foo", WithJQ(".issue"))),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithJQ(".issue"),
+				WithInitTransformConditions, WithTransformReferencesResolved, WithTransformCompiled, WithTransformTestsPassed),
+		}},
+	}, {
+		Name: "create knative service with passing tests",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithJQ("{id: .issue.number}"), WithTransformTests(issue)),
+		},
+		WantCreates: []metav1.Object{
+			svc(kf("bar", "foo", WithJQ("{id: .issue.number}"), WithTransformTests(issue))),
+			bundleCM(kf("bar", "foo", WithJQ("{id: .issue.number}"), WithTransformTests(issue))),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithJQ("{id: .issue.number}"), WithTransformTests(issue),
+				WithInitTransformConditions, WithTransformReferencesResolved, WithTransformCompiled, WithTransformTestsPassed),
+		}},
+	}, {
+		Name: "failing test",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithJQ("{id: .issue.id}"), WithTransformTests(issue)),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithJQ("{id: .issue.id}"), WithTransformTests(issue),
+				WithInitTransformConditions, WithTransformReferencesResolved, WithTransformCompiled,
+				WithTransformTestsFailed("TestFailed", `test "issue": expected {"id": 42}, got {"id":null}`)),
+		}},
+	}, {
+		Name: "invalid jq",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithJQ("{")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithJQ("{"), WithInitTransformConditions, WithTransformReferencesResolved,
+				WithTransformCompileFailed("CompileFailed", "invalid jq program: unexpected EOF")),
+		}},
+	}, {
+		Name: "create knative service with script",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithScript(identity)),
+		},
+		WantCreates: []metav1.Object{
+			svc(kf("bar", "foo", WithScript(identity))),
+			bundleCM(kf("bar", "foo", WithScript(identity))),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithScript(identity),
+				WithInitTransformConditions, WithTransformReferencesResolved, WithTransformCompiled, WithTransformTestsPassed),
+		}},
+	}, {
+		Name: "invalid script",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithScript("def f(event):\n  return event\n")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithScript("def f(event):\n  return event\n"), WithInitTransformConditions, WithTransformReferencesResolved,
+				WithTransformCompileFailed("CompileFailed", "invalid script: it must define a function transform(event)")),
+		}},
+	}, {
+		Name: "invalid output schema",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithJQ(".issue"), WithOutputSchema(`{"type": "thing"}`)),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithJQ(".issue"), WithOutputSchema(`{"type": "thing"}`), WithInitTransformConditions, WithTransformReferencesResolved,
+				WithTransformCompileFailed("CompileFailed", "invalid schema: has a primitive type that is NOT VALID -- given: /thing/ Expected valid values are:[array boolean integer number null object string]")),
+		}},
+	}, {
+		Name: "invalid redaction",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithRedaction(badRedaction)),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithRedaction(badRedaction), WithInitTransformConditions, WithTransformReferencesResolved,
+				WithTransformCompileFailed("CompileFailed", "mask rule 0: error parsing regexp: missing closing ): `(`")),
+		}},
+	}, {
+		Name: "dead letter policy without a sink",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithErrorPolicy(kfv1alpha1.ErrorPolicyDeadLetter, "")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithErrorPolicy(kfv1alpha1.ErrorPolicyDeadLetter, ""),
+				WithInitTransformConditions, WithTransformReferencesResolved,
+				WithTransformCompileFailed("CompileFailed", "the DeadLetter error policy requires a deadLetterSink")),
+		}},
+	}, {
+		Name: "invalid template",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithTemplate("{{ .foo")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithTemplate("{{ .foo"), WithInitTransformConditions, WithTransformReferencesResolved,
+				WithTransformCompileFailed("CompileFailed", "template: compiled:1: unclosed action")),
+		}},
+	}, {
+		Name: "create knative service with libraries",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`), WithLibraries("github")),
+			cm("github", "foo", map[string]string{
+				"github.tmpl": `{{ define "user" }}login: {{ .login }}{{ end }}`,
+			}),
+		},
+		WantCreates: []metav1.Object{
+			svc(kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`), WithLibraries("github"))),
+			bundleCMWithLibraries(kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`), WithLibraries("github")),
+				map[string]string{
+					"github.tmpl": `{{ define "user" }}login: {{ .login }}{{ end }}`,
+				}),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`), WithLibraries("github"),
+				WithInitTransformConditions, WithTransformReferencesResolved, WithTransformCompiled, WithTransformTestsPassed),
+		}},
+	}, {
+		Name: "update bundle when a library changes",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`), WithLibraries("github"),
+				WithInitTransformConditions, WithTransformReferencesResolved, WithTransformCompiled, WithTransformTestsPassed),
+			svc(kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`), WithLibraries("github"))),
+			bundleCMWithLibraries(kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`), WithLibraries("github")),
+				map[string]string{
+					"github.tmpl": `{{ define "user" }}login: {{ .login }}{{ end }}`,
+				}),
+			serviceAccount(kf("bar", "foo")),
+			role(kf("bar", "foo")),
+			binding(kf("bar", "foo")),
+			cm("github", "foo", map[string]string{
+				"github.tmpl": `{{ define "user" }}user: {{ .login }}{{ end }}`,
+			}),
+		},
+		// The data plane reloads its bundle, so the Knative Service (and
+		// with it the Revision) is left alone.
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: bundleCMWithLibraries(kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`), WithLibraries("github")),
+				map[string]string{
+					"github.tmpl": `{{ define "user" }}user: {{ .login }}{{ end }}`,
+				}),
+		}},
+	}, {
+		Name: "missing library",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithLibraries("github")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithLibraries("github"), WithInitTransformConditions,
+				WithTransformReferencesUnresolved("ConfigMapMissing", `ConfigMap "github" does not exist.`)),
+		}},
+	}, {
+		Name: "duplicate library",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithLibraries("github", "gitlab")),
+			cm("github", "foo", map[string]string{"user": "login"}),
+			cm("gitlab", "foo", map[string]string{"user": "username"}),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithLibraries("github", "gitlab"), WithInitTransformConditions,
+				WithTransformReferencesUnresolved("DuplicateLibrary", `ConfigMaps "github" and "gitlab" both have the key "user".`)),
+		}},
+	}, {
+		Name: "template invoking a missing library",
+		Key:  "foo/bar",
+		Objects: []runtime.Object{
+			kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`)),
 		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: kf("bar", "foo", WithTemplate(`{{ template "user" .sender }}`), WithInitTransformConditions, WithTransformReferencesResolved,
+				WithTransformCompileFailed("CompileFailed", `template: compiled: no such template "user"`)),
+		}},
 	}}
 
 	// TODO(mattmoor): Correct the Knative Service
@@ -60,11 +285,16 @@ func TestReconcile(t *testing.T) {
 	table.Test(t, MakeFactory(func(listers *Listers, opt reconciler.Options,
 		kfClient clientset.Interface) controller.Reconciler {
 		return &Reconciler{
-			Base:             reconciler.NewBase(opt, controllerAgentName),
-			kfilterclientset: kfClient,
-			serviceLister:    listers.GetServiceLister(),
-			transformLister:  listers.GetTransformLister(),
-			transformImage:   transformImage,
+			Base:                 reconciler.NewBase(opt, controllerAgentName),
+			kfilterclientset:     kfClient,
+			serviceLister:        listers.GetServiceLister(),
+			transformLister:      listers.GetTransformLister(),
+			configMapLister:      listers.GetConfigMapLister(),
+			serviceAccountLister: listers.GetServiceAccountLister(),
+			roleLister:           listers.GetRoleLister(),
+			roleBindingLister:    listers.GetRoleBindingLister(),
+			transformImage:       transformImage,
+			tracker:              tracker.New(func(string) {}, 0),
 		}
 	}))
 }
@@ -93,3 +323,33 @@ func svc(kf *kfv1alpha1.Transform, opts ...v1alpha1testing.ServiceOption) *v1alp
 
 	return svc
 }
+
+func bundleCM(kf *kfv1alpha1.Transform) *corev1.ConfigMap {
+	return bundleCMWithLibraries(kf, nil)
+}
+
+func bundleCMWithLibraries(kf *kfv1alpha1.Transform, libraries map[string]string) *corev1.ConfigMap {
+	return resources.MakeConfigMap(kf, libraries)
+}
+
+func serviceAccount(kf *kfv1alpha1.Transform) *corev1.ServiceAccount {
+	return resources.MakeServiceAccount(kf)
+}
+
+func role(kf *kfv1alpha1.Transform) *rbacv1.Role {
+	return resources.MakeRole(kf)
+}
+
+func binding(kf *kfv1alpha1.Transform) *rbacv1.RoleBinding {
+	return resources.MakeRoleBinding(kf)
+}
+
+func cm(name, namespace string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: data,
+	}
+}
@@ -18,19 +18,189 @@ package resources
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
 
 	"github.com/knative/pkg/kmeta"
+	"github.com/knative/serving/pkg/apis/autoscaling"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/bundle"
 	"github.com/mattmoor/kfilter/pkg/reconciler/ktransform/resources/names"
+	"github.com/mattmoor/kfilter/pkg/transform"
 )
 
-func MakeKService(kf *kfv1alpha1.Transform, image string) *v1alpha1.Service {
+// MakeArgs returns the args with which the data plane applies the
+// Transform's template (and the rest of its spec), with the given
+// (resolved) libraries.
+func MakeArgs(kf *kfv1alpha1.Transform, libraries map[string]string) []string {
 	encodedTransform := base64.StdEncoding.EncodeToString([]byte(kf.Spec.Template))
 
+	args := []string{
+		"-transform", encodedTransform,
+	}
+	if len(libraries) != 0 {
+		b, err := json.Marshal(libraries)
+		if err != nil {
+			panic(err.Error())
+		}
+		args = append(args, "-libraries", base64.StdEncoding.EncodeToString(b))
+	}
+	if len(kf.Spec.Mapping) != 0 {
+		b, err := json.Marshal(kf.Spec.Mapping)
+		if err != nil {
+			panic(err.Error())
+		}
+		args = append(args, "-mapping", base64.StdEncoding.EncodeToString(b))
+	}
+	if len(kf.Spec.Patch) != 0 {
+		b, err := json.Marshal(kf.Spec.Patch)
+		if err != nil {
+			panic(err.Error())
+		}
+		args = append(args, "-patch", base64.StdEncoding.EncodeToString(b))
+	}
+	if len(kf.Spec.MergePatch) != 0 {
+		args = append(args, "-merge-patch", base64.StdEncoding.EncodeToString(kf.Spec.MergePatch))
+	}
+	if kf.Spec.JQ != "" {
+		args = append(args, "-jq", base64.StdEncoding.EncodeToString([]byte(kf.Spec.JQ)))
+	}
+	if kf.Spec.Script != "" {
+		args = append(args, "-script", base64.StdEncoding.EncodeToString([]byte(kf.Spec.Script)))
+	}
+	if split := kf.Spec.Split; split != nil {
+		args = append(args, "-split-path", split.Path)
+		if split.Template != "" {
+			args = append(args, "-split-template", base64.StdEncoding.EncodeToString([]byte(split.Template)))
+		}
+		if split.Sink != "" {
+			args = append(args, "-split-sink", split.Sink)
+		}
+	}
+	if agg := kf.Spec.Aggregate; agg != nil {
+		args = append(args,
+			"-aggregate-size", agg.Window.Size.Duration.String(),
+			"-aggregate-template", base64.StdEncoding.EncodeToString([]byte(agg.Template)),
+			"-aggregate-type", agg.Type,
+			"-aggregate-source", AggregateSource(kf),
+			"-aggregate-sink", agg.Sink,
+		)
+		if agg.Window.Slide != nil {
+			args = append(args, "-aggregate-slide", agg.Window.Slide.Duration.String())
+		}
+		if agg.GroupBy != "" {
+			args = append(args, "-aggregate-group-by", agg.GroupBy)
+		}
+		if agg.MaxGroups != 0 {
+			args = append(args, "-aggregate-max-groups", strconv.Itoa(agg.MaxGroups))
+		}
+		if agg.MaxEvents != 0 {
+			args = append(args, "-aggregate-max-events", strconv.Itoa(agg.MaxEvents))
+		}
+	}
+	if redact := kf.Spec.Redact; redact != nil {
+		// The salt is passed via the environment (see makeEnv), to keep it out
+		// of the args.
+		rules := redact.DeepCopy()
+		rules.Salt = nil
+		b, err := json.Marshal(rules)
+		if err != nil {
+			panic(err.Error())
+		}
+		args = append(args, "-redact", base64.StdEncoding.EncodeToString(b))
+	}
+	if len(kf.Spec.Enrich) != 0 {
+		b, err := json.Marshal(EnrichSteps(kf))
+		if err != nil {
+			panic(err.Error())
+		}
+		args = append(args, "-enrich", base64.StdEncoding.EncodeToString(b))
+	}
+	// Values that templates may look up are passed via the environment (see
+	// makeEnv), to keep them out of the args.
+	if len(kf.Spec.Secrets) != 0 {
+		vars := make(map[string]map[string]string)
+		for i, sel := range kf.Spec.Secrets {
+			addVar(vars, sel.Name, sel.Key, secretVar(i))
+		}
+		b, err := json.Marshal(vars)
+		if err != nil {
+			panic(err.Error())
+		}
+		args = append(args, "-secrets", base64.StdEncoding.EncodeToString(b))
+	}
+	if len(kf.Spec.Config) != 0 {
+		vars := make(map[string]map[string]string)
+		for i, sel := range kf.Spec.Config {
+			addVar(vars, sel.Name, sel.Key, configVar(i))
+		}
+		b, err := json.Marshal(vars)
+		if err != nil {
+			panic(err.Error())
+		}
+		args = append(args, "-config", base64.StdEncoding.EncodeToString(b))
+	}
+	if kf.Spec.Format != "" {
+		args = append(args, "-format", string(kf.Spec.Format))
+	}
+	if kf.Spec.DataModel != "" {
+		args = append(args, "-data-model", string(kf.Spec.DataModel))
+	}
+	if kf.Spec.AutoEscape {
+		args = append(args, "-auto-escape")
+	}
+	if kf.Spec.OutputContentType != "" {
+		args = append(args, "-content-type", kf.Spec.OutputContentType)
+	}
+	if len(kf.Spec.OutputSchema) != 0 {
+		args = append(args, "-output-schema", base64.StdEncoding.EncodeToString(kf.Spec.OutputSchema))
+	}
+	if kf.Spec.Attributes != nil {
+		b, err := json.Marshal(kf.Spec.Attributes)
+		if err != nil {
+			panic(err.Error())
+		}
+		args = append(args, "-attributes", base64.StdEncoding.EncodeToString(b))
+	}
+
+	if onError := kf.Spec.OnError; onError != nil {
+		if onError.Policy != "" {
+			args = append(args, "-on-error", string(onError.Policy))
+		}
+		if onError.DeadLetterSink != "" {
+			args = append(args, "-dead-letter-sink", onError.DeadLetterSink)
+		}
+	}
+
+	if l := kf.Spec.Limits; l != nil {
+		if l.Timeout != nil {
+			args = append(args, "-timeout", l.Timeout.Duration.String())
+		}
+		if l.MaxOutputBytes != 0 {
+			args = append(args, "-max-output-bytes", strconv.Itoa(l.MaxOutputBytes))
+		}
+		if l.MaxDepth != 0 {
+			args = append(args, "-max-depth", strconv.Itoa(l.MaxDepth))
+		}
+		if l.MaxSteps != 0 {
+			args = append(args, "-max-steps", strconv.Itoa(l.MaxSteps))
+		}
+	}
+
+	return args
+}
+
+// MakeKService creates a Knative Service that applies the Transform's
+// template on its behalf.  The Service reads its args from the Transform's
+// bundle (see MakeConfigMap), so that they can change without creating a
+// new Revision, and only the values it reads from the environment are
+// part of its spec.
+func MakeKService(kf *kfv1alpha1.Transform, image string) *v1alpha1.Service {
 	return &v1alpha1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            names.KService(kf),
@@ -42,12 +212,18 @@ func MakeKService(kf *kfv1alpha1.Transform, image string) *v1alpha1.Service {
 			RunLatest: &v1alpha1.RunLatestType{
 				Configuration: v1alpha1.ConfigurationSpec{
 					RevisionTemplate: v1alpha1.RevisionTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: makeScale(kf),
+						},
 						Spec: v1alpha1.RevisionSpec{
+							ServiceAccountName: names.Bundle(kf),
 							Container: corev1.Container{
 								Image: image,
 								Args: []string{
-									"-transform", encodedTransform,
+									"-bundle", kf.Namespace + "/" + names.Bundle(kf),
 								},
+								Env:            makeEnv(kf),
+								ReadinessProbe: bundle.MakeReadinessProbe(),
 							},
 						},
 					},
@@ -56,3 +232,102 @@ func MakeKService(kf *kfv1alpha1.Transform, image string) *v1alpha1.Service {
 		},
 	}
 }
+
+// makeScale returns the annotations that scale the Transform's revisions.
+// Since windows are held in memory, a Transform that aggregates runs as
+// exactly one replica, so that each window sees all of its events.
+func makeScale(kf *kfv1alpha1.Transform) map[string]string {
+	if kf.Spec.Aggregate == nil {
+		return nil
+	}
+	return map[string]string{
+		autoscaling.MinScaleAnnotationKey: "1",
+		autoscaling.MaxScaleAnnotationKey: "1",
+	}
+}
+
+// makeEnv returns the environment variables through which the data plane
+// reads the Transform's salt, and the keys of Secrets and ConfigMaps that
+// its templates may look up.
+func makeEnv(kf *kfv1alpha1.Transform) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	if redact := kf.Spec.Redact; redact != nil && redact.Salt != nil {
+		env = append(env, corev1.EnvVar{
+			Name: "REDACT_SALT",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: redact.Salt.DeepCopy(),
+			},
+		})
+	}
+	for i, sel := range kf.Spec.Secrets {
+		env = append(env, corev1.EnvVar{
+			Name: secretVar(i),
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: sel.DeepCopy(),
+			},
+		})
+	}
+	for i, sel := range kf.Spec.Config {
+		env = append(env, corev1.EnvVar{
+			Name: configVar(i),
+			ValueFrom: &corev1.EnvVarSource{
+				ConfigMapKeyRef: sel.DeepCopy(),
+			},
+		})
+	}
+	return env
+}
+
+// secretVar returns the environment variable that holds the Transform's
+// i'th Secret key.
+func secretVar(i int) string {
+	return fmt.Sprintf("SECRET_%d", i)
+}
+
+// configVar returns the environment variable that holds the Transform's
+// i'th ConfigMap key.
+func configVar(i int) string {
+	return fmt.Sprintf("CONFIG_%d", i)
+}
+
+// addVar records that the environment variable holds the key of the named
+// object.
+func addVar(vars map[string]map[string]string, name, key, variable string) {
+	if vars[name] == nil {
+		vars[name] = make(map[string]string)
+	}
+	vars[name][key] = variable
+}
+
+// EnrichSteps returns the Transform's lookups as the data plane runs them.
+func EnrichSteps(kf *kfv1alpha1.Transform) []transform.EnrichStep {
+	steps := make([]transform.EnrichStep, 0, len(kf.Spec.Enrich))
+	for _, s := range kf.Spec.Enrich {
+		step := transform.EnrichStep{
+			Name:          s.Name,
+			URL:           s.URL,
+			Path:          s.Path,
+			Method:        s.Method,
+			Body:          s.Body,
+			FailurePolicy: transform.FailurePolicy(s.FailurePolicy),
+		}
+		if s.Timeout != nil {
+			step.Timeout = s.Timeout.Duration
+		}
+		if s.CacheTTL != nil {
+			step.CacheTTL = s.CacheTTL.Duration
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// AggregateSource returns the cloud event source of the events that the
+// Transform emits for its aggregation windows.
+func AggregateSource(kf *kfv1alpha1.Transform) string {
+	if kf.Spec.Aggregate != nil && kf.Spec.Aggregate.Source != "" {
+		return kf.Spec.Aggregate.Source
+	}
+	return fmt.Sprintf("/apis/%s/namespaces/%s/transforms/%s",
+		kfv1alpha1.SchemeGroupVersion.String(), kf.Namespace, kf.Name)
+}
@@ -18,6 +18,7 @@ package resources
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/knative/serving/pkg/apis/serving/v1alpha1"
@@ -27,14 +28,12 @@ import (
 	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
 )
 
-func TestMakeVirtualService(t *testing.T) {
-	boolTrue := true
-
+func TestMakeArgs(t *testing.T) {
 	tests := []struct {
-		name string
-		kf   *kfv1alpha1.Transform
-		img  string
-		want *v1alpha1.Service
+		name      string
+		kf        *kfv1alpha1.Transform
+		libraries map[string]string
+		want      []string
 	}{{
 		name: "test simple alias",
 		kf: &kfv1alpha1.Transform{
@@ -44,8 +43,355 @@ func TestMakeVirtualService(t *testing.T) {
 			},
 			// TODO(mattmoor): Spec
 		},
-		img: "foo",
-		want: &v1alpha1.Service{
+		want: []string{
+			"-transform", "",
+		},
+	}, {
+		name: "test json with auto-escaping and event data model",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Template:   `{"foo": {{ .bar }}}`,
+				Format:     kfv1alpha1.TemplateFormatJSON,
+				AutoEscape: true,
+				DataModel:  kfv1alpha1.DataModelEvent,
+			},
+		},
+		want: []string{
+			"-transform", "eyJmb28iOiB7eyAuYmFyIH19fQ==",
+			"-format", "JSON",
+			"-data-model", "Event",
+			"-auto-escape",
+		},
+	}, {
+		name: "test content type and attributes",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Template:          `action: {{ .action }}`,
+				OutputContentType: "text/plain",
+				Attributes: &kfv1alpha1.TransformAttributes{
+					Type: `com.acme.triage.{{ .action }}`,
+					Extensions: map[string]string{
+						"number": `{{ .issue.number }}`,
+					},
+				},
+			},
+		},
+		want: []string{
+			"-transform", "YWN0aW9uOiB7eyAuYWN0aW9uIH19",
+			"-content-type", "text/plain",
+			"-attributes", "eyJ0eXBlIjoiY29tLmFjbWUudHJpYWdlLnt7IC5hY3Rpb24gfX0iLCJleHRlbnNpb25zIjp7Im51bWJlciI6Int7IC5pc3N1ZS5udW1iZXIgfX0ifX0=",
+		},
+	}, {
+		name: "test error policy",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Template: `action: {{ .action }}`,
+				OnError: &kfv1alpha1.TransformErrorHandling{
+					Policy:         kfv1alpha1.ErrorPolicyDeadLetter,
+					DeadLetterSink: "http://dead.default.svc.cluster.local",
+				},
+			},
+		},
+		want: []string{
+			"-transform", "YWN0aW9uOiB7eyAuYWN0aW9uIH19",
+			"-on-error", "DeadLetter",
+			"-dead-letter-sink", "http://dead.default.svc.cluster.local",
+		},
+	}, {
+		name: "test limits",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Template: `action: {{ .action }}`,
+				Limits: &kfv1alpha1.TransformLimits{
+					Timeout:        &metav1.Duration{Duration: 100 * time.Millisecond},
+					MaxOutputBytes: 1024,
+					MaxDepth:       10,
+					MaxSteps:       500,
+				},
+			},
+		},
+		want: []string{
+			"-transform", "YWN0aW9uOiB7eyAuYWN0aW9uIH19",
+			"-timeout", "100ms",
+			"-max-output-bytes", "1024",
+			"-max-depth", "10",
+			"-max-steps", "500",
+		},
+	}, {
+		name: "test aggregation",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Aggregate: &kfv1alpha1.TransformAggregation{
+					GroupBy: "repository.name",
+					Window: kfv1alpha1.AggregationWindow{
+						Size:  metav1.Duration{Duration: time.Minute},
+						Slide: &metav1.Duration{Duration: 30 * time.Second},
+					},
+					Template:  `runs: {{ .count }}`,
+					Type:      "com.acme.checks.summary",
+					Sink:      "http://summaries.default.svc.cluster.local",
+					MaxGroups: 100,
+					MaxEvents: 1000,
+				},
+			},
+		},
+		want: []string{
+			"-transform", "",
+			"-aggregate-size", "1m0s",
+			"-aggregate-template", "cnVuczoge3sgLmNvdW50IH19",
+			"-aggregate-type", "com.acme.checks.summary",
+			"-aggregate-source", "/apis/kfilter.mattmoor.io/v1alpha1/namespaces/baz/transforms/foo",
+			"-aggregate-sink", "http://summaries.default.svc.cluster.local",
+			"-aggregate-slide", "30s",
+			"-aggregate-group-by", "repository.name",
+			"-aggregate-max-groups", "100",
+			"-aggregate-max-events", "1000",
+		},
+	}, {
+		name: "test mapping",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Mapping: []kfv1alpha1.MappingRule{{
+					From: "issue.number",
+					To:   "id",
+				}, {
+					To:      "kind",
+					Default: []byte(`"issue"`),
+				}, {
+					Drop: "secret",
+				}},
+			},
+		},
+		want: []string{
+			"-transform", "",
+			"-mapping", "W3siZnJvbSI6Imlzc3VlLm51bWJlciIsInRvIjoiaWQifSx7InRvIjoia2luZCIsImRlZmF1bHQiOiJpc3N1ZSJ9LHsiZHJvcCI6InNlY3JldCJ9XQ==",
+		},
+	}, {
+		name: "test patches",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Patch: []kfv1alpha1.PatchOperation{{
+					Op:   "remove",
+					Path: "/sender",
+				}},
+				MergePatch: []byte(`{"triaged":true}`),
+			},
+		},
+		want: []string{
+			"-transform", "",
+			"-patch", "W3sib3AiOiJyZW1vdmUiLCJwYXRoIjoiL3NlbmRlciJ9XQ==",
+			"-merge-patch", "eyJ0cmlhZ2VkIjp0cnVlfQ==",
+		},
+	}, {
+		name: "test jq",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				JQ: `{id: .issue.number}`,
+			},
+		},
+		want: []string{
+			"-transform", "",
+			"-jq", "e2lkOiAuaXNzdWUubnVtYmVyfQ==",
+		},
+	}, {
+		name: "test output schema",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				JQ:           `{id: .issue.number}`,
+				OutputSchema: []byte(`{"type":"object","required":["id"]}`),
+			},
+		},
+		want: []string{
+			"-transform", "",
+			"-jq", "e2lkOiAuaXNzdWUubnVtYmVyfQ==",
+			"-output-schema", "eyJ0eXBlIjoib2JqZWN0IiwicmVxdWlyZWQiOlsiaWQiXX0=",
+		},
+	}, {
+		name: "test script",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Script: "def transform(event):\n  return event\n",
+			},
+		},
+		want: []string{
+			"-transform", "",
+			"-script", "ZGVmIHRyYW5zZm9ybShldmVudCk6CiAgcmV0dXJuIGV2ZW50Cg==",
+		},
+	}, {
+		name: "test split",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Split: &kfv1alpha1.TransformSplit{
+					Path:     "commits",
+					Template: `commit: {{ .item.id }}`,
+					Sink:     "http://commits.default.svc.cluster.local",
+				},
+			},
+		},
+		want: []string{
+			"-transform", "",
+			"-split-path", "commits",
+			"-split-template", "Y29tbWl0OiB7eyAuaXRlbS5pZCB9fQ==",
+			"-split-sink", "http://commits.default.svc.cluster.local",
+		},
+	}, {
+		name: "test redaction",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Redact: &kfv1alpha1.TransformRedaction{
+					Remove: []string{"sender.email"},
+					Mask: []kfv1alpha1.MaskRule{{
+						Pattern: "ghp_[0-9a-f]+",
+					}},
+					Hash: []string{"sender.login"},
+					Salt: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "salts",
+						},
+						Key: "github",
+					},
+				},
+			},
+		},
+		want: []string{
+			"-transform", "",
+			"-redact", "eyJyZW1vdmUiOlsic2VuZGVyLmVtYWlsIl0sIm1hc2siOlt7InBhdHRlcm4iOiJnaHBfWzAtOWEtZl0rIn1dLCJoYXNoIjpbInNlbmRlci5sb2dpbiJdfQ==",
+		},
+	}, {
+		name: "test enrichment",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Template: "team: {{ .enrich.employee.team }}",
+				Enrich: []kfv1alpha1.EnrichStep{{
+					Name:          "employee",
+					URL:           "http://employees.default.svc.cluster.local",
+					Path:          "/{{ .sender.login | urlquery }}",
+					Timeout:       &metav1.Duration{Duration: 250 * time.Millisecond},
+					CacheTTL:      &metav1.Duration{Duration: 5 * time.Minute},
+					FailurePolicy: kfv1alpha1.EnrichFailurePolicyIgnore,
+				}},
+			},
+		},
+		want: []string{
+			"-transform", "dGVhbToge3sgLmVucmljaC5lbXBsb3llZS50ZWFtIH19",
+			"-enrich", "W3sibmFtZSI6ImVtcGxveWVlIiwidXJsIjoiaHR0cDovL2VtcGxveWVlcy5kZWZhdWx0LnN2Yy5jbHVzdGVyLmxvY2FsIiwicGF0aCI6Ii97eyAuc2VuZGVyLmxvZ2luIHwgdXJscXVlcnkgfX0iLCJ0aW1lb3V0IjoyNTAwMDAwMDAsImNhY2hlVFRMIjozMDAwMDAwMDAwMDAsImZhaWx1cmVQb2xpY3kiOiJJZ25vcmUifV0=",
+		},
+	}, {
+		name: "test libraries",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Template: `{{ template "user" .sender }}`,
+				Libraries: []corev1.LocalObjectReference{{
+					Name: "github",
+				}},
+			},
+		},
+		libraries: map[string]string{
+			"github.tmpl": `{{ define "user" }}login: {{ .login }}{{ end }}`,
+		},
+		want: []string{
+			"-transform", "e3sgdGVtcGxhdGUgInVzZXIiIC5zZW5kZXIgfX0=",
+			"-libraries", "eyJnaXRodWIudG1wbCI6Int7IGRlZmluZSBcInVzZXJcIiB9fWxvZ2luOiB7eyAubG9naW4gfX17eyBlbmQgfX0ifQ==",
+		},
+	}, {
+		name: "test secrets and config",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Template: `token: {{ secret "tokens" "github" }}`,
+				Secrets: []corev1.SecretKeySelector{{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "tokens"},
+					Key:                  "github",
+				}, {
+					LocalObjectReference: corev1.LocalObjectReference{Name: "tokens"},
+					Key:                  "slack",
+				}},
+				Config: []corev1.ConfigMapKeySelector{{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "tenant"},
+					Key:                  "id",
+				}},
+			},
+		},
+		want: []string{
+			"-transform", "dG9rZW46IHt7IHNlY3JldCAidG9rZW5zIiAiZ2l0aHViIiB9fQ==",
+			"-secrets", "eyJ0b2tlbnMiOnsiZ2l0aHViIjoiU0VDUkVUXzAiLCJzbGFjayI6IlNFQ1JFVF8xIn19",
+			"-config", "eyJ0ZW5hbnQiOnsiaWQiOiJDT05GSUdfMCJ9fQ==",
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := MakeArgs(test.kf, test.libraries)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Unexpected args (-want +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestMakeKService(t *testing.T) {
+	boolTrue := true
+	service := func(env ...corev1.EnvVar) *v1alpha1.Service {
+		return &v1alpha1.Service{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      "foo",
 				Namespace: "baz",
@@ -62,15 +408,149 @@ func TestMakeVirtualService(t *testing.T) {
 					Configuration: v1alpha1.ConfigurationSpec{
 						RevisionTemplate: v1alpha1.RevisionTemplateSpec{
 							Spec: v1alpha1.RevisionSpec{
+								ServiceAccountName: "foo-bundle",
 								Container: corev1.Container{
 									Image: "foo",
+									Args:  []string{"-bundle", "baz/foo-bundle"},
+									Env:   env,
+									ReadinessProbe: &corev1.Probe{
+										Handler: corev1.Handler{
+											HTTPGet: &corev1.HTTPGetAction{Path: "/ready"},
+										},
+									},
 								},
 							},
 						},
 					},
 				},
 			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		kf   *kfv1alpha1.Transform
+		img  string
+		want *v1alpha1.Service
+	}{{
+		name: "test simple",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Template: "foo: {{ .bar }}",
+			},
+		},
+		img:  "foo",
+		want: service(),
+	}, {
+		name: "test redaction salt",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Redact: &kfv1alpha1.TransformRedaction{
+					Hash: []string{"sender.login"},
+					Salt: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "salts",
+						},
+						Key: "github",
+					},
+				},
+			},
+		},
+		img: "foo",
+		want: service(corev1.EnvVar{
+			Name: "REDACT_SALT",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: "salts",
+					},
+					Key: "github",
+				},
+			},
+		}),
+	}, {
+		name: "test secrets and config",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Template: `token: {{ secret "tokens" "github" }}`,
+				Secrets: []corev1.SecretKeySelector{{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "tokens"},
+					Key:                  "github",
+				}, {
+					LocalObjectReference: corev1.LocalObjectReference{Name: "tokens"},
+					Key:                  "slack",
+				}},
+				Config: []corev1.ConfigMapKeySelector{{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "tenant"},
+					Key:                  "id",
+				}},
+			},
+		},
+		img: "foo",
+		want: service(corev1.EnvVar{
+			Name: "SECRET_0",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "tokens"},
+					Key:                  "github",
+				},
+			},
+		}, corev1.EnvVar{
+			Name: "SECRET_1",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "tokens"},
+					Key:                  "slack",
+				},
+			},
+		}, corev1.EnvVar{
+			Name: "CONFIG_0",
+			ValueFrom: &corev1.EnvVarSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "tenant"},
+					Key:                  "id",
+				},
+			},
+		}),
+	}, {
+		name: "test aggregation",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "baz",
+			},
+			Spec: kfv1alpha1.TransformSpec{
+				Aggregate: &kfv1alpha1.TransformAggregation{
+					Window: kfv1alpha1.AggregationWindow{
+						Size: metav1.Duration{Duration: time.Minute},
+					},
+					Template: "count: {{ .count }}",
+					Type:     "com.acme.summary",
+					Sink:     "http://summaries.default.svc.cluster.local",
+				},
+			},
 		},
+		img: "foo",
+		want: func() *v1alpha1.Service {
+			s := service()
+			s.Spec.RunLatest.Configuration.RevisionTemplate.Annotations = map[string]string{
+				"autoscaling.knative.dev/minScale": "1",
+				"autoscaling.knative.dev/maxScale": "1",
+			}
+			return s
+		}(),
 	}}
 
 	for _, test := range tests {
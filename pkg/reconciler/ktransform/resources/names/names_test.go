@@ -39,6 +39,15 @@ func TestNamer(t *testing.T) {
 		},
 		f:    KService,
 		want: "foo",
+	}, {
+		name: "Bundle",
+		kf: &kfv1alpha1.Transform{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "foo",
+			},
+		},
+		f:    Bundle,
+		want: "foo-bundle",
 	}}
 
 	for _, test := range tests {
@@ -43,19 +43,21 @@ type Ctor func(*Listers, reconciler.Options, clientset.Interface) controller.Rec
 
 // MakeFactory creates a reconciler factory with fake clients and controller created by `ctor`.
 func MakeFactory(ctor Ctor) Factory {
-	return func(t *testing.T, r *TableRow) (controller.Reconciler, ActionRecorderList, EventList) {
+	return func(t *testing.T, r *TableRow) (controller.Reconciler, ActionRecorderList, EventList, *FakeStatsReporter) {
 		ls := NewListers(r.Objects)
 
 		kubeClient := fakekubeclientset.NewSimpleClientset(ls.GetKubeObjects()...)
 		servingclient := fakeclientset.NewSimpleClientset(ls.GetServingObjects()...)
 		kfClient := fakekfclientset.NewSimpleClientset(ls.GetKFilterObjects()...)
 		eventRecorder := record.NewFakeRecorder(maxEventBufferSize)
+		statsReporter := &FakeStatsReporter{}
 
 		// Set up our Controller from the fakes.
 		c := ctor(&ls, reconciler.Options{
 			KubeClientSet:    kubeClient,
 			ServingClientSet: servingclient,
 			Recorder:         eventRecorder,
+			StatsReporter:    statsReporter,
 			Logger:           logtesting.TestLogger(t),
 		}, kfClient)
 
@@ -70,8 +72,8 @@ func MakeFactory(ctor Ctor) Factory {
 		servingclient.PrependReactor("update", "*", ValidateUpdates)
 
 		actionRecorderList := ActionRecorderList{servingclient, kubeClient, kfClient}
-		eventList := EventList{eventRecorder}
+		eventList := EventList{Recorder: eventRecorder}
 
-		return c, actionRecorderList, eventList
+		return c, actionRecorderList, eventList, statsReporter
 	}
 }
@@ -17,9 +17,192 @@ limitations under the License.
 package testing
 
 import (
+	corev1 "k8s.io/api/core/v1"
+
 	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
 )
 
 type FilterOption func(*kfv1alpha1.Filter)
 
+// WithBody sets the Filter's body.
+func WithBody(body string) FilterOption {
+	return func(kf *kfv1alpha1.Filter) {
+		kf.Spec.Body = []byte(body)
+	}
+}
+
+// WithBodyFromConfigMap sources the Filter's body from the given ConfigMap key.
+func WithBodyFromConfigMap(name, key string) FilterOption {
+	return func(kf *kfv1alpha1.Filter) {
+		kf.Spec.BodyFrom = &kfv1alpha1.FilterBodySource{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: name,
+				},
+				Key: key,
+			},
+		}
+	}
+}
+
+// WithInitFilterConditions initializes the Filter's conditions.
+func WithInitFilterConditions(kf *kfv1alpha1.Filter) {
+	kf.Status.InitializeConditions()
+}
+
+// WithFilterReferencesResolved marks the Filter's references as resolved.
+func WithFilterReferencesResolved(kf *kfv1alpha1.Filter) {
+	kf.Status.MarkReferencesResolved()
+}
+
+// WithFilterReferencesUnresolved marks the Filter's references as unresolved.
+func WithFilterReferencesUnresolved(reason, message string) FilterOption {
+	return func(kf *kfv1alpha1.Filter) {
+		kf.Status.MarkReferencesUnresolved(reason, "%s", message)
+	}
+}
+
+// WithFilterTests sets the tests embedded in the Filter's spec.
+func WithFilterTests(tests ...kfv1alpha1.FilterTest) FilterOption {
+	return func(kf *kfv1alpha1.Filter) {
+		kf.Spec.Tests = tests
+	}
+}
+
+// WithFilterThrottle sets the Filter's throttle.
+func WithFilterThrottle(th *kfv1alpha1.ThrottleSpec) FilterOption {
+	return func(kf *kfv1alpha1.Filter) {
+		kf.Spec.Throttle = th
+	}
+}
+
+// WithFilterCompiled marks the Filter as compiled.
+func WithFilterCompiled(kf *kfv1alpha1.Filter) {
+	kf.Status.MarkCompiled()
+}
+
+// WithFilterCompileFailed marks the Filter as failing to compile.
+func WithFilterCompileFailed(reason, message string) FilterOption {
+	return func(kf *kfv1alpha1.Filter) {
+		kf.Status.MarkCompileFailed(reason, "%s", message)
+	}
+}
+
+// WithFilterTestsPassed marks the Filter's tests as passing.
+func WithFilterTestsPassed(kf *kfv1alpha1.Filter) {
+	kf.Status.MarkTestsPassed()
+}
+
+// WithFilterTestsFailed marks the Filter's tests as failing.
+func WithFilterTestsFailed(reason, message string) FilterOption {
+	return func(kf *kfv1alpha1.Filter) {
+		kf.Status.MarkTestsFailed(reason, "%s", message)
+	}
+}
+
 type TransformOption func(*kfv1alpha1.Transform)
+
+// WithTemplate sets the Transform's template.
+func WithTemplate(tmpl string) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Spec.Template = tmpl
+	}
+}
+
+// WithJQ sets the Transform's jq program.
+func WithJQ(program string) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Spec.JQ = program
+	}
+}
+
+// WithScript sets the Transform's Starlark script.
+func WithScript(script string) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Spec.Script = script
+	}
+}
+
+// WithOutputSchema sets the JSON Schema of the Transform's results.
+func WithOutputSchema(schema string) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Spec.OutputSchema = []byte(schema)
+	}
+}
+
+// WithRedaction sets the Transform's redaction.
+func WithRedaction(rd *kfv1alpha1.TransformRedaction) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Spec.Redact = rd
+	}
+}
+
+// WithLibraries sets the ConfigMaps the Transform uses as libraries.
+func WithLibraries(names ...string) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		for _, name := range names {
+			kf.Spec.Libraries = append(kf.Spec.Libraries, corev1.LocalObjectReference{
+				Name: name,
+			})
+		}
+	}
+}
+
+// WithErrorPolicy sets what the Transform does with events that fail to
+// transform.
+func WithErrorPolicy(policy kfv1alpha1.ErrorPolicy, sink string) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Spec.OnError = &kfv1alpha1.TransformErrorHandling{
+			Policy:         policy,
+			DeadLetterSink: sink,
+		}
+	}
+}
+
+// WithTransformTests sets the tests embedded in the Transform's spec.
+func WithTransformTests(tests ...kfv1alpha1.TransformTest) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Spec.Tests = tests
+	}
+}
+
+// WithInitTransformConditions initializes the Transform's conditions.
+func WithInitTransformConditions(kf *kfv1alpha1.Transform) {
+	kf.Status.InitializeConditions()
+}
+
+// WithTransformReferencesResolved marks the Transform's references as resolved.
+func WithTransformReferencesResolved(kf *kfv1alpha1.Transform) {
+	kf.Status.MarkReferencesResolved()
+}
+
+// WithTransformReferencesUnresolved marks the Transform's references as unresolved.
+func WithTransformReferencesUnresolved(reason, message string) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Status.MarkReferencesUnresolved(reason, "%s", message)
+	}
+}
+
+// WithTransformCompiled marks the Transform's programs as compiled.
+func WithTransformCompiled(kf *kfv1alpha1.Transform) {
+	kf.Status.MarkCompiled()
+}
+
+// WithTransformCompileFailed marks the Transform's programs as failing to compile.
+func WithTransformCompileFailed(reason, message string) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Status.MarkCompileFailed(reason, "%s", message)
+	}
+}
+
+// WithTransformTestsPassed marks the Transform's tests as passing.
+func WithTransformTestsPassed(kf *kfv1alpha1.Transform) {
+	kf.Status.MarkTestsPassed()
+}
+
+// WithTransformTestsFailed marks the Transform's tests as failing.
+func WithTransformTestsFailed(reason, message string) TransformOption {
+	return func(kf *kfv1alpha1.Transform) {
+		kf.Status.MarkTestsFailed(reason, "%s", message)
+	}
+}
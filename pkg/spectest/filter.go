@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spectest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/knative/pkg/cloudevents"
+
+	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/filter"
+)
+
+// Filter is the compiled form of a Filter's event type, body and invert
+// settings.
+type Filter struct {
+	s *filter.Selector
+}
+
+// CompileFilter compiles the given Filter spec with the given filter
+// expression (either its Body, or the one it references).
+func CompileFilter(spec kfv1alpha1.FilterSpec, body json.RawMessage) (*Filter, error) {
+	s, err := filter.NewSelector(spec.EventType, body, spec.Invert)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{s: s}, nil
+}
+
+// Keep returns whether the Filter keeps the event with the given context
+// and decoded body.
+func (f *Filter) Keep(ctx *cloudevents.EventContext, body interface{}) bool {
+	return f.s.Skip(ctx.EventType, body) == ""
+}
+
+// Test runs the given tests, and returns an error describing the first
+// one that fails.
+func (f *Filter) Test(tests []kfv1alpha1.FilterTest) error {
+	for i, test := range tests {
+		name := testName(i, test.Name)
+		var body map[string]interface{}
+		if err := json.Unmarshal(test.Input, &body); err != nil {
+			return fmt.Errorf("test %s: invalid input: %v", name, err)
+		}
+		ctx := &cloudevents.EventContext{
+			EventID:     name,
+			EventType:   test.Type,
+			ContentType: "application/json",
+		}
+		if keep := f.Keep(ctx, body); keep != test.Keep {
+			if test.Keep {
+				return fmt.Errorf("test %s: expected the event to be kept, but it was skipped", name)
+			}
+			return fmt.Errorf("test %s: expected the event to be skipped, but it was kept", name)
+		}
+	}
+	return nil
+}
+
+// testName returns how failures refer to the test at the given index with
+// the given (optional) name.
+func testName(i int, name string) string {
+	if name == "" {
+		return fmt.Sprintf("#%d", i)
+	}
+	return fmt.Sprintf("%q", name)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spectest
+
+import (
+	"testing"
+
+	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+)
+
+func TestFilter(t *testing.T) {
+	opened := kfv1alpha1.FilterTest{
+		Name:  "opened",
+		Type:  "dev.knative.source.github.issues",
+		Input: []byte(`{"action": "opened", "issue": {"number": 42}}`),
+		Keep:  true,
+	}
+
+	tests := []struct {
+		name  string
+		spec  kfv1alpha1.FilterSpec
+		body  string
+		tests []kfv1alpha1.FilterTest
+		want  string
+	}{{
+		name:  "passing",
+		spec:  kfv1alpha1.FilterSpec{EventType: "dev.knative.source.github.issues"},
+		body:  `{"action": "opened"}`,
+		tests: []kfv1alpha1.FilterTest{opened},
+	}, {
+		name: "no body",
+		tests: []kfv1alpha1.FilterTest{{
+			Input: []byte(`{}`),
+			Keep:  true,
+		}},
+	}, {
+		name:  "wrong type",
+		spec:  kfv1alpha1.FilterSpec{EventType: "dev.knative.source.github.push"},
+		tests: []kfv1alpha1.FilterTest{opened},
+		want:  `test "opened": expected the event to be kept, but it was skipped`,
+	}, {
+		name:  "inverted",
+		spec:  kfv1alpha1.FilterSpec{Invert: true},
+		body:  `{"action": "opened"}`,
+		tests: []kfv1alpha1.FilterTest{opened},
+		want:  `test "opened": expected the event to be kept, but it was skipped`,
+	}, {
+		name: "unexpectedly kept",
+		body: `{"action": "opened"}`,
+		tests: []kfv1alpha1.FilterTest{{
+			Input: []byte(`{"action": "opened"}`),
+		}},
+		want: `test #0: expected the event to be skipped, but it was kept`,
+	}, {
+		name: "invalid input",
+		tests: []kfv1alpha1.FilterTest{{
+			Name:  "bad",
+			Input: []byte(`{`),
+		}},
+		want: `test "bad": invalid input: unexpected end of JSON input`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := CompileFilter(test.spec, []byte(test.body))
+			if err != nil {
+				t.Fatalf("CompileFilter() = %v", err)
+			}
+			err = f.Test(test.tests)
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("Test() = %v", err)
+			case test.want != "" && err == nil:
+				t.Errorf("Test() = nil, wanted %q", test.want)
+			case test.want != "" && err.Error() != test.want:
+				t.Errorf("Test() = %q, wanted %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilterError(t *testing.T) {
+	if _, err := CompileFilter(kfv1alpha1.FilterSpec{}, []byte(`[`)); err == nil {
+		t.Error("CompileFilter() = nil, wanted error")
+	}
+}
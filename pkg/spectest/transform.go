@@ -0,0 +1,201 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spectest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+
+	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+	"github.com/mattmoor/kfilter/pkg/dataplane"
+	"github.com/mattmoor/kfilter/pkg/reconciler/ktransform/resources"
+	"github.com/mattmoor/kfilter/pkg/transform"
+)
+
+// Transform is the compiled form of the programs in a Transform's spec.
+type Transform struct {
+	t *dataplane.Transform
+}
+
+// CompileTransform compiles the programs in the given Transform's spec with
+// the given libraries (keyed by name), from the args that configure its
+// data plane.  Since the values of Secrets and ConfigMaps aren't
+// available, the keys that the spec lists resolve to the empty string, and
+// redactions hash their values without a salt.  The limits that the spec
+// sets apply as they do in the data plane, up to the default limits, so
+// that tests can't pin whatever runs them.
+func CompileTransform(kf *kfv1alpha1.Transform, libraries map[string]string) (*Transform, error) {
+	t, err := dataplane.ParseTransform(resources.MakeArgs(kf, libraries),
+		dataplane.WithEnv(placeholder),
+		dataplane.WithMaxLimits(transform.Limits{
+			Timeout:        transform.DefaultTimeout,
+			MaxOutputBytes: transform.DefaultMaxOutputBytes,
+			MaxDepth:       transform.DefaultMaxDepth,
+			MaxSteps:       transform.DefaultMaxSteps,
+		}))
+	if err != nil {
+		return nil, err
+	}
+	return &Transform{t: t}, nil
+}
+
+// placeholder resolves every environment variable to the empty string.
+func placeholder(string) (string, bool) {
+	return "", true
+}
+
+// Apply returns the bodies that the Transform produces from the event
+// with the given context and body, which are empty when the event is
+// filtered.  Tests don't perform lookups (their inputs may include the
+// results under transform.EnrichKey instead), so the enrichment is not
+// applied.  When the Transform aggregates, the body may also be an array
+// of events, which are treated as a single window (of the group of the
+// first), starting at the Unix epoch.
+func (t *Transform) Apply(ctx *cloudevents.EventContext, body json.RawMessage) ([][]byte, error) {
+	if t.t.Aggregates() {
+		return t.aggregate(body)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	redacted := t.t.Redact(payload)
+	results, err := t.t.Apply(ctx, redacted)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != 0 {
+		if _, err := t.t.Rewrite(ctx, redacted); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// aggregate returns the body that the Transform produces from a window of
+// the given event(s).
+func (t *Transform) aggregate(body json.RawMessage) ([][]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	events, ok := v.([]interface{})
+	if !ok {
+		events = []interface{}{v}
+	}
+	for i, event := range events {
+		events[i] = t.t.Redact(event)
+	}
+
+	result, err := t.t.Summarize(time.Unix(0, 0).UTC(), events)
+	if err != nil || result == nil {
+		return nil, err
+	}
+	return [][]byte{result}, nil
+}
+
+// Test runs the given tests, and returns an error describing the first
+// one that fails.
+func (t *Transform) Test(tests []kfv1alpha1.TransformTest) error {
+	for i, test := range tests {
+		if err := t.run(test); err != nil {
+			return fmt.Errorf("test %s: %v", testName(i, test.Name), err)
+		}
+	}
+	return nil
+}
+
+// run runs a single test.
+func (t *Transform) run(test kfv1alpha1.TransformTest) error {
+	ctx := &cloudevents.EventContext{
+		EventID:     test.Name,
+		EventType:   test.Type,
+		Source:      test.Source,
+		ContentType: "application/json",
+	}
+	results, err := t.Apply(ctx, test.Input)
+	switch {
+	case test.Error != "" && err == nil:
+		return fmt.Errorf("expected an error containing %q", test.Error)
+	case test.Error != "" && !strings.Contains(err.Error(), test.Error):
+		return fmt.Errorf("expected an error containing %q, got: %v", test.Error, err)
+	case test.Error != "":
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if len(test.Output) == 0 || string(test.Output) == "null" {
+		if len(results) != 0 {
+			return fmt.Errorf("expected the event to be filtered, got: %s", results[0])
+		}
+		return nil
+	}
+
+	var want []json.RawMessage
+	if !t.t.Splits() {
+		want = []json.RawMessage{test.Output}
+	} else if err := json.Unmarshal(test.Output, &want); err != nil {
+		return fmt.Errorf("the output of a split must be an array: %v", err)
+	}
+	if len(results) != len(want) {
+		return fmt.Errorf("expected %d result(s), got %d", len(want), len(results))
+	}
+	for i := range want {
+		if err := t.compare(want[i], results[i]); err != nil {
+			if t.t.Splits() {
+				return fmt.Errorf("result %d: %v", i, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// compare checks that the given result is the expected output.  JSON
+// results are compared semantically, and others are compared as strings,
+// ignoring surrounding whitespace.
+func (t *Transform) compare(want json.RawMessage, got []byte) error {
+	if !transform.IsJSON(t.t.ContentType()) {
+		var s string
+		if err := json.Unmarshal(want, &s); err != nil {
+			return fmt.Errorf("the expected output must be a string: %v", err)
+		}
+		if strings.TrimSpace(s) != strings.TrimSpace(string(got)) {
+			return fmt.Errorf("expected %q, got %q", s, got)
+		}
+		return nil
+	}
+
+	var w, g interface{}
+	if err := json.Unmarshal(want, &w); err != nil {
+		return fmt.Errorf("invalid expected output: %v", err)
+	}
+	if err := json.Unmarshal(got, &g); err != nil {
+		return fmt.Errorf("invalid result %s: %v", got, err)
+	}
+	if !reflect.DeepEqual(w, g) {
+		return fmt.Errorf("expected %s, got %s", want, got)
+	}
+	return nil
+}
@@ -0,0 +1,399 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spectest
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kfv1alpha1 "github.com/mattmoor/kfilter/pkg/apis/kfilter/v1alpha1"
+)
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      kfv1alpha1.TransformSpec
+		libraries map[string]string
+		tests     []kfv1alpha1.TransformTest
+		want      string
+	}{{
+		name: "template",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `{{ if eq .action "opened" }}number: {{ .issue.number }}{{ end }}`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Name:   "opened",
+			Input:  []byte(`{"action": "opened", "issue": {"number": 42}}`),
+			Output: []byte(`{"number": 42}`),
+		}, {
+			Name:  "closed",
+			Input: []byte(`{"action": "closed", "issue": {"number": 42}}`),
+		}},
+	}, {
+		name: "wrong output",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `number: {{ .issue.number }}`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Name:   "opened",
+			Input:  []byte(`{"issue": {"number": 42}}`),
+			Output: []byte(`{"number": 43}`),
+		}},
+		want: `test "opened": expected {"number": 43}, got {"number":42}`,
+	}, {
+		name: "unexpectedly filtered",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `{{ if .issue }}number: {{ .issue.number }}{{ end }}`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input:  []byte(`{"pull_request": {"number": 42}}`),
+			Output: []byte(`{"number": 42}`),
+		}},
+		want: `test #0: expected 1 result(s), got 0`,
+	}, {
+		name: "unexpectedly kept",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `number: {{ .issue.number }}`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input:  []byte(`{"issue": {"number": 42}}`),
+			Output: []byte(`null`),
+		}},
+		want: `test #0: expected the event to be filtered, got: {"number":42}`,
+	}, {
+		name: "expected error",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `token: {{ secret "github" "token" }}`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input: []byte(`{}`),
+			Error: `secret "github" has no key "token"`,
+		}},
+	}, {
+		name: "missing error",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `number: {{ .issue.number }}`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input: []byte(`{"issue": {"number": 42}}`),
+			Error: "no issue",
+		}},
+		want: `test #0: expected an error containing "no issue"`,
+	}, {
+		name: "text",
+		spec: kfv1alpha1.TransformSpec{
+			OutputContentType: "text/plain",
+			Template: `{{ .sender.login }} opened #{{ .issue.number }}
+`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input:  []byte(`{"sender": {"login": "mattmoor"}, "issue": {"number": 42}}`),
+			Output: []byte(`"mattmoor opened #42"`),
+		}},
+	}, {
+		name: "split",
+		spec: kfv1alpha1.TransformSpec{
+			Split: &kfv1alpha1.TransformSplit{
+				Path:     "commits",
+				Template: `id: {{ .item.id }}`,
+			},
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input:  []byte(`{"commits": [{"id": "abc"}, {"id": "def"}]}`),
+			Output: []byte(`[{"id": "abc"}, {"id": "def"}]`),
+		}, {
+			Name:   "wrong",
+			Input:  []byte(`{"commits": [{"id": "abc"}, {"id": "def"}]}`),
+			Output: []byte(`[{"id": "abc"}, {"id": "ghi"}]`),
+		}},
+		want: `test "wrong": result 1: expected {"id": "ghi"}, got {"id":"def"}`,
+	}, {
+		name: "redaction",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `email: '{{ .email }}'`,
+			Redact: &kfv1alpha1.TransformRedaction{
+				Mask: []kfv1alpha1.MaskRule{{Pattern: `\S+@\S+`}},
+			},
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input:  []byte(`{"email": "matt@example.com"}`),
+			Output: []byte(`{"email": "[REDACTED]"}`),
+		}},
+	}, {
+		name: "enrichment results in the input",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `team: {{ .enrich.owner.team }}`,
+			Enrich: []kfv1alpha1.EnrichStep{{
+				Name: "owner",
+				URL:  "http://owners.default.svc.cluster.local",
+				Path: "/{{ .repository.name | urlquery }}",
+			}},
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input:  []byte(`{"repository": {"name": "kfilter"}, "enrich": {"owner": {"team": "eventing"}}}`),
+			Output: []byte(`{"team": "eventing"}`),
+		}},
+	}, {
+		name: "libraries and secrets",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `{{ template "user" .sender }}
+token: '{{ secret "github" "token" }}'`,
+			Secrets: []corev1.SecretKeySelector{{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "github"},
+				Key:                  "token",
+			}},
+		},
+		libraries: map[string]string{
+			"github.tmpl": `{{ define "user" }}login: {{ .login }}{{ end }}`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input:  []byte(`{"sender": {"login": "mattmoor"}}`),
+			Output: []byte(`{"login": "mattmoor", "token": ""}`),
+		}},
+	}, {
+		name: "aggregation",
+		spec: kfv1alpha1.TransformSpec{
+			Aggregate: &kfv1alpha1.TransformAggregation{
+				GroupBy: "repository.name",
+				Window: kfv1alpha1.AggregationWindow{
+					Size: metav1.Duration{Duration: time.Minute},
+				},
+				Template: `repo: {{ .group }}
+runs: {{ .count }}
+end: {{ .end }}
+failed: {{ range .events }}{{ if eq .conclusion "failure" }}true{{ end }}{{ end }}`,
+				Type: "com.acme.checks.summary",
+				Sink: "http://summaries.default.svc.cluster.local",
+			},
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Name: "window",
+			Input: []byte(`[
+				{"repository": {"name": "kfilter"}, "conclusion": "success"},
+				{"repository": {"name": "kfilter"}, "conclusion": "failure"}
+			]`),
+			Output: []byte(`{"repo": "kfilter", "runs": 2, "end": "1970-01-01T00:01:00Z", "failed": true}`),
+		}, {
+			Name:   "single event",
+			Input:  []byte(`{"repository": {"name": "kfilter"}, "conclusion": "success"}`),
+			Output: []byte(`{"repo": "kfilter", "runs": 1, "end": "1970-01-01T00:01:00Z", "failed": null}`),
+		}},
+	}, {
+		name: "output schema",
+		spec: kfv1alpha1.TransformSpec{
+			JQ:           `{id: .issue.number, title: .issue.title}`,
+			OutputSchema: []byte(`{"type": "object", "required": ["id", "title"], "properties": {"title": {"type": "string"}}}`),
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Name:   "valid",
+			Input:  []byte(`{"issue": {"number": 42, "title": "Crash"}}`),
+			Output: []byte(`{"id": 42, "title": "Crash"}`),
+		}, {
+			Name:  "untitled",
+			Input: []byte(`{"issue": {"number": 42}}`),
+			Error: `output violates its schema at "/title": Invalid type. Expected: string, given: null`,
+		}},
+	}, {
+		name: "script",
+		spec: kfv1alpha1.TransformSpec{
+			Script: `
+def transform(event):
+  if event["action"] != "opened":
+    return None
+  for i in range(event["spin"]):
+    pass
+  return {"id": event["issue"]["number"]}
+`,
+			Limits: &kfv1alpha1.TransformLimits{
+				MaxSteps: 1000,
+			},
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Name:   "opened",
+			Input:  []byte(`{"action": "opened", "issue": {"number": 42}, "spin": 0}`),
+			Output: []byte(`{"id": 42}`),
+		}, {
+			Name:  "closed",
+			Input: []byte(`{"action": "closed", "issue": {"number": 42}, "spin": 0}`),
+		}, {
+			Name:  "spinning",
+			Input: []byte(`{"action": "opened", "issue": {"number": 42}, "spin": 1000000}`),
+			Error: "transform exceeded its step limit",
+		}},
+	}, {
+		name: "limits",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `{{ template "loop" . }}`,
+			Limits: &kfv1alpha1.TransformLimits{
+				MaxDepth: 5,
+			},
+		},
+		libraries: map[string]string{
+			"loop.tmpl": `{{ define "loop" }}{{ template "loop" . }}{{ end }}`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input: []byte(`{}`),
+			Error: "transform exceeded its depth limit",
+		}},
+	}, {
+		name: "limits above the defaults",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `{{ template "loop" . }}`,
+			Limits: &kfv1alpha1.TransformLimits{
+				Timeout:  &metav1.Duration{},
+				MaxDepth: 1 << 30,
+			},
+		},
+		libraries: map[string]string{
+			"loop.tmpl": `{{ define "loop" }}{{ template "loop" . }}{{ end }}`,
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input: []byte(`{}`),
+			Error: "transform exceeded its depth limit",
+		}},
+	}, {
+		name: "attributes",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `number: {{ .issue.number }}`,
+			Attributes: &kfv1alpha1.TransformAttributes{
+				Type: `{{ config "types" "issue" }}`,
+			},
+		},
+		tests: []kfv1alpha1.TransformTest{{
+			Input:  []byte(`{"issue": {"number": 42}}`),
+			Output: []byte(`{"number": 42}`),
+		}},
+		want: `test #0: template: type:1:3: executing "type" at <config "types" "issue">: error calling config: config "types" has no key "issue" available`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kf := &kfv1alpha1.Transform{Spec: test.spec}
+			tr, err := CompileTransform(kf, test.libraries)
+			if err != nil {
+				t.Fatalf("CompileTransform() = %v", err)
+			}
+			err = tr.Test(test.tests)
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("Test() = %v", err)
+			case test.want != "" && err == nil:
+				t.Errorf("Test() = nil, wanted %q", test.want)
+			case test.want != "" && err.Error() != test.want:
+				t.Errorf("Test() = %q, wanted %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileTransformErrors(t *testing.T) {
+	window := kfv1alpha1.AggregationWindow{
+		Size: metav1.Duration{Duration: time.Minute},
+	}
+	tests := []struct {
+		name string
+		spec kfv1alpha1.TransformSpec
+		want string
+	}{{
+		name: "invalid template",
+		spec: kfv1alpha1.TransformSpec{
+			Template: `{{ .foo`,
+		},
+		want: "template: compiled:1: unclosed action",
+	}, {
+		name: "invalid output schema",
+		spec: kfv1alpha1.TransformSpec{
+			JQ:           `.`,
+			OutputSchema: []byte(`{"$ref": "http://schemas.example.com/issue.json"}`),
+		},
+		want: `invalid schema: references to other documents are not supported: "http://schemas.example.com/issue.json"`,
+	}, {
+		name: "output schema of text",
+		spec: kfv1alpha1.TransformSpec{
+			Template:          `{{ .title }}`,
+			OutputContentType: "text/plain",
+			OutputSchema:      []byte(`{"type": "string"}`),
+		},
+		want: "outputSchema requires a JSON outputContentType",
+	}, {
+		name: "aggregation without a type",
+		spec: kfv1alpha1.TransformSpec{
+			Aggregate: &kfv1alpha1.TransformAggregation{
+				Window:   window,
+				Template: `count: {{ .count }}`,
+				Sink:     "http://summaries.default.svc.cluster.local",
+			},
+		},
+		want: "aggregation requires a type",
+	}, {
+		name: "aggregation without a sink",
+		spec: kfv1alpha1.TransformSpec{
+			Aggregate: &kfv1alpha1.TransformAggregation{
+				Window:   window,
+				Template: `count: {{ .count }}`,
+				Type:     "com.acme.checks.summary",
+			},
+		},
+		want: "aggregation requires a sink",
+	}, {
+		name: "aggregation without a window",
+		spec: kfv1alpha1.TransformSpec{
+			Aggregate: &kfv1alpha1.TransformAggregation{
+				Template: `count: {{ .count }}`,
+				Type:     "com.acme.checks.summary",
+				Sink:     "http://summaries.default.svc.cluster.local",
+			},
+		},
+		want: "the window size must be positive",
+	}, {
+		name: "aggregation with too many windows",
+		spec: kfv1alpha1.TransformSpec{
+			Aggregate: &kfv1alpha1.TransformAggregation{
+				Window: kfv1alpha1.AggregationWindow{
+					Size:  metav1.Duration{Duration: time.Hour},
+					Slide: &metav1.Duration{Duration: time.Nanosecond},
+				},
+				Template: `count: {{ .count }}`,
+				Type:     "com.acme.checks.summary",
+				Sink:     "http://summaries.default.svc.cluster.local",
+			},
+		},
+		want: "the window size may be at most 100 times the slide",
+	}, {
+		name: "aggregation without a template",
+		spec: kfv1alpha1.TransformSpec{
+			Aggregate: &kfv1alpha1.TransformAggregation{
+				Window: window,
+				Type:   "com.acme.checks.summary",
+				Sink:   "http://summaries.default.svc.cluster.local",
+			},
+		},
+		want: "aggregation requires a template",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := CompileTransform(&kfv1alpha1.Transform{Spec: test.spec}, nil)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("CompileTransform() = %v, wanted %q", err, test.want)
+			}
+		})
+	}
+}
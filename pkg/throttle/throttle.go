@@ -0,0 +1,72 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"golang.org/x/time/rate"
+)
+
+// Limiter decides whether events may pass.
+type Limiter interface {
+	// Allow consumes a token from the bucket for the given group,
+	// and returns whether one was available.
+	Allow(group string) bool
+}
+
+// New returns a Limiter that refills each group's bucket with limit
+// tokens per period, holding at most burst tokens.  At most size groups
+// are tracked at a time, with the least recently used group's bucket
+// discarded to make room for new groups.
+func New(limit int, period time.Duration, burst, size int) (Limiter, error) {
+	cache, err := simplelru.NewLRU(size, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &buckets{
+		cache: cache,
+		rate:  rate.Every(period / time.Duration(limit)),
+		burst: burst,
+		now:   time.Now,
+	}, nil
+}
+
+type buckets struct {
+	m     sync.Mutex
+	cache *simplelru.LRU
+	rate  rate.Limit
+	burst int
+	now   func() time.Time
+}
+
+// buckets implements Limiter
+var _ Limiter = (*buckets)(nil)
+
+func (b *buckets) Allow(group string) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if v, ok := b.cache.Get(group); ok {
+		return v.(*rate.Limiter).AllowN(b.now(), 1)
+	}
+	l := rate.NewLimiter(b.rate, b.burst)
+	b.cache.Add(group, l)
+	return l.AllowN(b.now(), 1)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l, err := New(2, time.Minute, 2, 2)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	now := time.Now()
+	l.(*buckets).now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		group   string
+		want    bool
+	}{{
+		name:  "first event",
+		group: "foo",
+		want:  true,
+	}, {
+		name:  "second event uses the burst",
+		group: "foo",
+		want:  true,
+	}, {
+		name:  "third event is throttled",
+		group: "foo",
+		want:  false,
+	}, {
+		name:  "other groups have their own bucket",
+		group: "bar",
+		want:  true,
+	}, {
+		name:  "other group uses its burst",
+		group: "bar",
+		want:  true,
+	}, {
+		name:  "other group is throttled",
+		group: "bar",
+		want:  false,
+	}, {
+		name:    "not enough time to refill",
+		advance: 20 * time.Second,
+		group:   "foo",
+		want:    false,
+	}, {
+		name:    "bucket refills over the period",
+		advance: 10 * time.Second,
+		group:   "foo",
+		want:    true,
+	}, {
+		name:  "refilled token is consumed",
+		group: "foo",
+		want:  false,
+	}, {
+		name:  "new group evicts the least recently used bucket",
+		group: "baz",
+		want:  true,
+	}, {
+		name:  "recently used bucket is kept",
+		group: "foo",
+		want:  false,
+	}, {
+		name:  "evicted group starts with a full bucket",
+		group: "bar",
+		want:  true,
+	}, {
+		name:  "evicted group uses its burst",
+		group: "bar",
+		want:  true,
+	}}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if got := l.Allow(step.group); got != step.want {
+			t.Errorf("%s: Allow(%q) = %v, wanted %v", step.name, step.group, got, step.want)
+		}
+	}
+}
+
+func TestNewFailure(t *testing.T) {
+	if l, err := New(1, time.Minute, 1, 0); err == nil {
+		t.Errorf("New(size=0) = %v, wanted error", l)
+	}
+}
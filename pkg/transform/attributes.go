@@ -0,0 +1,168 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+// SubjectExtension is the extension through which the subject of an event
+// is conveyed, since version 0.1 of the cloud events specification has no
+// such attribute.
+const SubjectExtension = "subject"
+
+// AttributeTemplates are templates for the cloud event attributes of a
+// transformed event.  Each template renders plain text, and an empty
+// result leaves the attribute as it was.
+type AttributeTemplates struct {
+	Type       string            `json:"type,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Subject    string            `json:"subject,omitempty"`
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+// ContextMutator rewrites the attributes of a cloud event.
+type ContextMutator interface {
+	// MutateContext returns the new context for the event with the given
+	// context and decoded body.  The given context is not modified.
+	MutateContext(ctx *cloudevents.EventContext, body interface{}) (*cloudevents.EventContext, error)
+}
+
+// CompileAttributes compiles the given attribute templates.  Of the
+// options, the data model, libraries, functions and limits are relevant;
+// the templates share a single timeout.
+func CompileAttributes(at AttributeTemplates, opts ...Option) (ContextMutator, error) {
+	o := &options{model: Body}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cm := &contextMutator{
+		model:      o.model,
+		limits:     o.limits,
+		extensions: make(map[string]*template.Template, len(at.Extensions)),
+	}
+	var err error
+	if cm.eventType, err = compileAttribute("type", at.Type, o); err != nil {
+		return nil, err
+	}
+	if cm.source, err = compileAttribute("source", at.Source, o); err != nil {
+		return nil, err
+	}
+	if cm.subject, err = compileAttribute("subject", at.Subject, o); err != nil {
+		return nil, err
+	}
+	for name, tmpl := range at.Extensions {
+		t, err := compileAttribute("extensions."+name, tmpl, o)
+		if err != nil {
+			return nil, err
+		}
+		cm.extensions[name] = t
+	}
+	return cm, nil
+}
+
+func compileAttribute(name, tmpl string, o *options) (*template.Template, error) {
+	if tmpl == "" {
+		return nil, nil
+	}
+	t, err := newTemplate(name, tmpl, o)
+	if err != nil {
+		return nil, fmt.Errorf("attribute %s: %v", name, err)
+	}
+	if o.limits.instrumented() {
+		instrument(t)
+	}
+	return t, nil
+}
+
+type contextMutator struct {
+	model      DataModel
+	limits     Limits
+	eventType  *template.Template
+	source     *template.Template
+	subject    *template.Template
+	extensions map[string]*template.Template
+}
+
+// contextMutator implements ContextMutator
+var _ ContextMutator = (*contextMutator)(nil)
+
+func (cm *contextMutator) MutateContext(ctx *cloudevents.EventContext, body interface{}) (*cloudevents.EventContext, error) {
+	input := Input(cm.model, ctx, body)
+	r := &attributeRenderer{input: input, limits: cm.limits, deadline: cm.limits.deadline()}
+
+	result := *ctx
+	result.Extensions = make(map[string]interface{}, len(ctx.Extensions)+len(cm.extensions)+1)
+	for k, v := range ctx.Extensions {
+		result.Extensions[k] = v
+	}
+
+	if err := r.render(cm.eventType, func(v string) { result.EventType = v }); err != nil {
+		return nil, err
+	}
+	if err := r.render(cm.source, func(v string) { result.Source = v }); err != nil {
+		return nil, err
+	}
+	if err := r.render(cm.subject, func(v string) { result.Extensions[SubjectExtension] = v }); err != nil {
+		return nil, err
+	}
+	for name, t := range cm.extensions {
+		name := name
+		if err := r.render(t, func(v string) { result.Extensions[name] = v }); err != nil {
+			return nil, err
+		}
+	}
+	if len(result.Extensions) == 0 {
+		result.Extensions = nil
+	}
+	return &result, nil
+}
+
+// attributeRenderer executes the attribute templates for a single event,
+// subject to their shared limits.
+type attributeRenderer struct {
+	input    interface{}
+	limits   Limits
+	deadline time.Time
+}
+
+// render executes the template (if any) and passes a non-empty result to
+// set.
+func (r *attributeRenderer) render(t *template.Template, set func(string)) error {
+	if t == nil {
+		return nil
+	}
+	l, err := r.limits.within(r.deadline)
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := execute(t, buf, r.input, l); err != nil {
+		return err
+	}
+	if v := strings.TrimSpace(buf.String()); v != "" {
+		set(v)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestAttributes(t *testing.T) {
+	ctx := &cloudevents.EventContext{
+		CloudEventsVersion: "0.1",
+		EventID:            "1234",
+		EventType:          "dev.knative.source.github.issues",
+		Source:             "https://github.com/mattmoor/kfilter",
+		Extensions: map[string]interface{}{
+			"delivery": "abcd",
+		},
+	}
+	body := map[string]interface{}{
+		"action": "opened",
+		"issue": map[string]interface{}{
+			"number": float64(42),
+		},
+	}
+
+	tests := []struct {
+		name  string
+		at    AttributeTemplates
+		opts  []Option
+		input *cloudevents.EventContext
+		want  *cloudevents.EventContext
+	}{{
+		name:  "no templates",
+		input: ctx,
+		want:  ctx,
+	}, {
+		name: "rewrite type and source",
+		at: AttributeTemplates{
+			Type:   `com.acme.triage.{{ .action }}`,
+			Source: `https://acme.com/issues/{{ .issue.number }}`,
+		},
+		input: ctx,
+		want: &cloudevents.EventContext{
+			CloudEventsVersion: "0.1",
+			EventID:            "1234",
+			EventType:          "com.acme.triage.opened",
+			Source:             "https://acme.com/issues/42",
+			Extensions: map[string]interface{}{
+				"delivery": "abcd",
+			},
+		},
+	}, {
+		name: "subject and extensions",
+		at: AttributeTemplates{
+			Subject: `issue-{{ .issue.number }}`,
+			Extensions: map[string]string{
+				"action":   `{{ upper .action }}`,
+				"delivery": `{{ .action }}-override`,
+			},
+		},
+		input: ctx,
+		want: &cloudevents.EventContext{
+			CloudEventsVersion: "0.1",
+			EventID:            "1234",
+			EventType:          "dev.knative.source.github.issues",
+			Source:             "https://github.com/mattmoor/kfilter",
+			Extensions: map[string]interface{}{
+				"subject":  "issue-42",
+				"action":   "OPENED",
+				"delivery": "opened-override",
+			},
+		},
+	}, {
+		name: "empty results keep the original",
+		at: AttributeTemplates{
+			Type: `{{ if eq .action "closed" }}com.acme.closed{{ end }}`,
+			Extensions: map[string]string{
+				"delivery": `{{ if false }}nope{{ end }}`,
+			},
+		},
+		input: ctx,
+		want:  ctx,
+	}, {
+		name: "event data model",
+		at: AttributeTemplates{
+			Type: `{{ .ce.type }}.{{ .data.action }}`,
+		},
+		opts: []Option{WithDataModel(Event)},
+		input: &cloudevents.EventContext{
+			EventType: "dev.knative.source.github.issues",
+		},
+		want: &cloudevents.EventContext{
+			EventType: "dev.knative.source.github.issues.opened",
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cm, err := CompileAttributes(test.at, test.opts...)
+			if err != nil {
+				t.Fatalf("CompileAttributes() = %v", err)
+			}
+			got, err := cm.MutateContext(test.input, body)
+			if err != nil {
+				t.Fatalf("MutateContext() = %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("MutateContext() (-want +got): %v", diff)
+			}
+		})
+	}
+
+	// The input context should never be modified.
+	if got, want := ctx.EventType, "dev.knative.source.github.issues"; got != want {
+		t.Errorf("EventType = %v, wanted %v", got, want)
+	}
+	if got, want := len(ctx.Extensions), 1; got != want {
+		t.Errorf("len(Extensions) = %v, wanted %v", got, want)
+	}
+}
+
+func TestAttributeErrors(t *testing.T) {
+	if _, err := CompileAttributes(AttributeTemplates{Type: `{{ .foo`}); err == nil {
+		t.Error("CompileAttributes() = nil, wanted error")
+	}
+
+	cm, err := CompileAttributes(AttributeTemplates{Source: `{{ div 1 0 }}`})
+	if err != nil {
+		t.Fatalf("CompileAttributes() = %v", err)
+	}
+	if got, err := cm.MutateContext(&cloudevents.EventContext{}, nil); err == nil {
+		t.Errorf("MutateContext() = %v, wanted error", got)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+)
+
+func TestIsJSON(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"", true},
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"text/json", true},
+		{"application/cloudevents+json", true},
+		{"text/plain", false},
+		{"application/xml", false},
+		{"text/csv; charset=utf-8", false},
+		{"not a content type;;", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.contentType, func(t *testing.T) {
+			if got := IsJSON(test.contentType); got != test.want {
+				t.Errorf("IsJSON(%q) = %v, wanted %v", test.contentType, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/knative/pkg/cloudevents"
+)
+
+const (
+	// EnrichKey is the key of the event body under which the results of
+	// lookups are stored, by the name of their step.
+	EnrichKey = "enrich"
+
+	// DefaultEnrichTimeout is how long a lookup may take by default.
+	DefaultEnrichTimeout = time.Second
+
+	// DefaultEnrichCacheSize is how many responses are cached at once by
+	// default.
+	DefaultEnrichCacheSize = 1000
+)
+
+// FailurePolicy is what happens to an event when a step fails.
+type FailurePolicy string
+
+const (
+	// Reject fails the event, so that it may be redelivered.
+	Reject FailurePolicy = "Reject"
+
+	// Drop filters the event.
+	Drop FailurePolicy = "Drop"
+
+	// Ignore carries on, as if the step had produced null.
+	Ignore FailurePolicy = "Ignore"
+)
+
+// EnrichStep is an HTTP lookup whose (JSON) response is merged into the
+// event body as enrich.<Name>.  Path and Body are templates, which are
+// executed against the event (according to the data model) including the
+// results of the preceding steps.
+type EnrichStep struct {
+	Name string `json:"name"`
+
+	// URL is the absolute http(s) URL to look up, which events can't
+	// change: they only render the Path that is appended to it.
+	URL string `json:"url"`
+
+	// Path renders the path (starting with /) and/or query (starting
+	// with ?) to append to URL, as plain text.  Values should be escaped
+	// with urlquery, since auto-escaping doesn't apply to it.
+	Path string `json:"path,omitempty"`
+
+	// Method is GET (the default) or POST.
+	Method string `json:"method,omitempty"`
+
+	// Body renders the JSON body of POST requests, as the options dictate
+	// (e.g. from YAML).
+	Body string `json:"body,omitempty"`
+
+	// Timeout bounds how long the lookup may take (DefaultEnrichTimeout
+	// when it is zero).
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// CacheTTL is how long responses are reused for (they aren't cached
+	// when it is zero).
+	CacheTTL time.Duration `json:"cacheTTL,omitempty"`
+
+	// FailurePolicy is what happens to the event when the lookup fails
+	// (Reject when it is empty).
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// EnrichError is returned when a step fails under a policy other than
+// Ignore.
+type EnrichError struct {
+	Step   string
+	Policy FailurePolicy
+	Err    error
+}
+
+func (e *EnrichError) Error() string {
+	return fmt.Sprintf("enrich step %q: %v", e.Step, e.Err)
+}
+
+// Enricher adds the results of lookups to event bodies.
+type Enricher interface {
+	// Enrich returns a copy of the given decoded body (which must be an
+	// object) with the results of the lookups under EnrichKey.  Failed
+	// lookups return an *EnrichError, unless their policy is Ignore.
+	Enrich(ctx *cloudevents.EventContext, body interface{}) (interface{}, error)
+}
+
+// CompileEnrichment compiles the given steps into an Enricher, which
+// performs them in order, caching up to cacheSize responses (or
+// DefaultEnrichCacheSize when it is zero).  The options apply to the Path
+// and Body templates, except that Paths always render Text (and are never
+// auto-escaped), and Bodies never do (they render YAML instead).  Responses
+// may be at most as large as the MaxOutputBytes limit (or
+// DefaultMaxOutputBytes when it is zero), and lookups don't follow
+// redirects.
+func CompileEnrichment(steps []EnrichStep, cacheSize int, opts ...Option) (Enricher, error) {
+	o := &options{format: YAML}
+	for _, opt := range opts {
+		opt(o)
+	}
+	bodyFormat := o.format
+	if bodyFormat == Text {
+		bodyFormat = YAML
+	}
+
+	if len(steps) == 0 {
+		return nil, errors.New("enrichment has no steps")
+	}
+	if cacheSize == 0 {
+		cacheSize = DefaultEnrichCacheSize
+	}
+	cache, err := simplelru.NewLRU(cacheSize, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &enricher{
+		steps:            make([]step, 0, len(steps)),
+		maxResponseBytes: o.limits.MaxOutputBytes,
+		cache:            cache,
+	}
+	if e.maxResponseBytes == 0 {
+		e.maxResponseBytes = DefaultMaxOutputBytes
+	}
+	names := make(map[string]bool, len(steps))
+	for _, s := range steps {
+		if s.Name == "" {
+			return nil, errors.New("enrich steps must be named")
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("enrich step %q: duplicate name", s.Name)
+		}
+		names[s.Name] = true
+
+		compiled := step{
+			name:    s.Name,
+			method:  s.Method,
+			timeout: s.Timeout,
+			ttl:     s.CacheTTL,
+			policy:  s.FailurePolicy,
+		}
+		switch compiled.method {
+		case "":
+			compiled.method = http.MethodGet
+		case http.MethodGet, http.MethodPost:
+		default:
+			return nil, fmt.Errorf("enrich step %q: unsupported method: %q", s.Name, s.Method)
+		}
+		switch compiled.policy {
+		case "":
+			compiled.policy = Reject
+		case Reject, Drop, Ignore:
+		default:
+			return nil, fmt.Errorf("enrich step %q: unsupported failure policy: %q", s.Name, s.FailurePolicy)
+		}
+		if compiled.timeout == 0 {
+			compiled.timeout = DefaultEnrichTimeout
+		}
+
+		if s.URL == "" {
+			return nil, fmt.Errorf("enrich step %q: url is required", s.Name)
+		}
+		compiled.url, err = parseBaseURL(s.URL)
+		if err != nil {
+			return nil, fmt.Errorf("enrich step %q: url: %v", s.Name, err)
+		}
+		if s.Path != "" {
+			compiled.path, err = Compile(s.Path, append(opts, WithFormat(Text), withoutAutoEscape())...)
+			if err != nil {
+				return nil, fmt.Errorf("enrich step %q: path: %v", s.Name, err)
+			}
+		}
+		if s.Body != "" {
+			if compiled.method != http.MethodPost {
+				return nil, fmt.Errorf("enrich step %q: body requires method POST", s.Name)
+			}
+			compiled.body, err = Compile(s.Body, append(opts, WithFormat(bodyFormat))...)
+			if err != nil {
+				return nil, fmt.Errorf("enrich step %q: body: %v", s.Name, err)
+			}
+		}
+		e.steps = append(e.steps, compiled)
+	}
+	return e, nil
+}
+
+// withoutAutoEscape undoes WithAutoEscape, for templates (like paths)
+// whose results aren't JSON.
+func withoutAutoEscape() Option {
+	return func(o *options) {
+		o.autoEscape = false
+	}
+}
+
+// parseBaseURL parses the fixed URL of a step, to which paths are
+// appended.
+func parseBaseURL(s string) (*url.URL, error) {
+	if strings.Contains(s, "{{") {
+		return nil, errors.New("must not be a template (template the path instead)")
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return nil, fmt.Errorf("unsupported scheme: %q", u.Scheme)
+	case u.Host == "":
+		return nil, errors.New("must have a host")
+	case u.RawQuery != "" || u.Fragment != "":
+		return nil, errors.New("must not have a query or fragment (put them in the path)")
+	}
+	return u, nil
+}
+
+type step struct {
+	name    string
+	method  string
+	url     *url.URL
+	path    Mutator
+	body    Mutator
+	timeout time.Duration
+	ttl     time.Duration
+	policy  FailurePolicy
+}
+
+type cached struct {
+	value   interface{}
+	expires time.Time
+}
+
+type enricher struct {
+	steps            []step
+	maxResponseBytes int
+
+	m     sync.Mutex
+	cache *simplelru.LRU
+}
+
+// enricher implements Enricher
+var _ Enricher = (*enricher)(nil)
+
+func (e *enricher) Enrich(ctx *cloudevents.EventContext, body interface{}) (interface{}, error) {
+	obj, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object to enrich, got: %T", body)
+	}
+	// Copy the top level, so the body itself is left alone.
+	enriched := make(map[string]interface{}, len(obj)+1)
+	for k, v := range obj {
+		enriched[k] = v
+	}
+	results := make(map[string]interface{}, len(e.steps))
+	enriched[EnrichKey] = results
+
+	for _, s := range e.steps {
+		v, err := e.lookup(ctx, &s, enriched)
+		if err != nil {
+			if s.policy != Ignore {
+				return nil, &EnrichError{Step: s.name, Policy: s.policy, Err: err}
+			}
+			v = nil
+		}
+		results[s.name] = v
+	}
+	return enriched, nil
+}
+
+func (e *enricher) lookup(ctx *cloudevents.EventContext, s *step, body interface{}) (interface{}, error) {
+	target, err := s.target(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	var payload []byte
+	if s.body != nil {
+		payload, err = s.body.Mutate(ctx, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key := strings.Join([]string{s.method, target, string(payload)}, "\n")
+	if s.ttl > 0 {
+		if v, ok := e.get(key); ok {
+			return v, nil
+		}
+	}
+
+	req, err := http.NewRequest(s.method, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := &http.Client{
+		Timeout: s.timeout,
+		// Redirects could take the lookup to hosts other than the URL's,
+		// so they fail like any other unexpected status.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(e.maxResponseBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > e.maxResponseBytes {
+		return nil, fmt.Errorf("response exceeds %d bytes", e.maxResponseBytes)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+
+	if s.ttl > 0 {
+		e.add(key, v, s.ttl)
+	}
+	return v, nil
+}
+
+// target returns the URL to look up for the given event: the step's URL,
+// followed by its rendered path (if any).
+func (s *step) target(ctx *cloudevents.EventContext, body interface{}) (string, error) {
+	if s.path == nil {
+		return s.url.String(), nil
+	}
+	b, err := s.path.Mutate(ctx, body)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSpace(string(b))
+	base := s.url.String()
+	switch {
+	case path == "":
+		return base, nil
+	case strings.HasPrefix(path, "/"):
+		base = strings.TrimSuffix(base, "/")
+	case strings.HasPrefix(path, "?"):
+	default:
+		return "", fmt.Errorf("path must start with / or ?, got: %q", path)
+	}
+	target, err := url.Parse(base + path)
+	if err != nil {
+		return "", err
+	}
+	// The path can't redirect the lookup elsewhere.
+	if target.Scheme != s.url.Scheme || target.Host != s.url.Host || target.User != nil {
+		return "", fmt.Errorf("path changed the host of the url: %q", path)
+	}
+	return target.String(), nil
+}
+
+func (e *enricher) get(key string) (interface{}, bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	v, ok := e.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	c := v.(cached)
+	if !now().Before(c.expires) {
+		e.cache.Remove(key)
+		return nil, false
+	}
+	return c.value, true
+}
+
+func (e *enricher) add(key string, value interface{}, ttl time.Duration) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.cache.Add(key, cached{value: value, expires: now().Add(ttl)})
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestEnrich(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/employees/octocat":
+			w.Write([]byte(`{"name":"Mona","team":"hubbers"}`))
+		case "/employees":
+			if r.URL.Query().Get("login") != "octocat" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"name":"Mona","team":"hubbers"}`))
+		case "/teams":
+			b, _ := ioutil.ReadAll(r.Body)
+			var req map[string]interface{}
+			json.Unmarshal(b, &req)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"method": r.Method,
+				"team":   req["team"],
+				"oncall": "hubot",
+			})
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte(`{}`))
+		case "/text":
+			w.Write([]byte(`not json`))
+		case "/redirect":
+			http.Redirect(w, r, "/employees/octocat", http.StatusFound)
+		case "/large":
+			w.Write([]byte(`"` + strings.Repeat("x", 1000) + `"`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	input := map[string]interface{}{
+		"sender": map[string]interface{}{"login": "octocat"},
+	}
+	ctx := &cloudevents.EventContext{EventID: "1234"}
+
+	tests := []struct {
+		name    string
+		steps   []EnrichStep
+		opts    []Option
+		want    string
+		wantErr FailurePolicy
+	}{{
+		name: "get",
+		steps: []EnrichStep{{
+			Name: "employee",
+			URL:  server.URL,
+			Path: "/employees/{{ .sender.login }}",
+		}},
+		want: `{"enrich":{"employee":{"name":"Mona","team":"hubbers"}},"sender":{"login":"octocat"}}`,
+	}, {
+		name: "post using the preceding step",
+		steps: []EnrichStep{{
+			Name: "employee",
+			URL:  server.URL,
+			Path: "/employees/{{ .sender.login }}",
+		}, {
+			Name:   "team",
+			Method: http.MethodPost,
+			URL:    server.URL + "/teams",
+			Body:   `team: {{ .enrich.employee.team }}`,
+		}},
+		want: `{"enrich":{"employee":{"name":"Mona","team":"hubbers"},"team":{"method":"POST","oncall":"hubot","team":"hubbers"}},"sender":{"login":"octocat"}}`,
+	}, {
+		name: "event data model",
+		steps: []EnrichStep{{
+			Name: "employee",
+			URL:  server.URL,
+			Path: "/employees/{{ .data.sender.login }}",
+		}},
+		opts: []Option{WithDataModel(Event)},
+		want: `{"enrich":{"employee":{"name":"Mona","team":"hubbers"}},"sender":{"login":"octocat"}}`,
+	}, {
+		name: "auto-escaping doesn't apply to paths",
+		steps: []EnrichStep{{
+			Name: "employee",
+			URL:  server.URL + "/",
+			Path: "/employees/{{ .sender.login | urlquery }}",
+		}},
+		opts: []Option{WithAutoEscape()},
+		want: `{"enrich":{"employee":{"name":"Mona","team":"hubbers"}},"sender":{"login":"octocat"}}`,
+	}, {
+		name: "query",
+		steps: []EnrichStep{{
+			Name: "employee",
+			URL:  server.URL + "/employees",
+			Path: "?login={{ .sender.login | urlquery }}",
+		}},
+		want: `{"enrich":{"employee":{"name":"Mona","team":"hubbers"}},"sender":{"login":"octocat"}}`,
+	}, {
+		name: "path without a leading slash",
+		steps: []EnrichStep{{
+			Name: "employee",
+			URL:  server.URL,
+			Path: "{{ .sender.login }}",
+		}},
+		wantErr: Reject,
+	}, {
+		name: "ignored failure",
+		steps: []EnrichStep{{
+			Name:          "missing",
+			URL:           server.URL + "/nope",
+			FailurePolicy: Ignore,
+		}},
+		want: `{"enrich":{"missing":null},"sender":{"login":"octocat"}}`,
+	}, {
+		name: "rejected failure",
+		steps: []EnrichStep{{
+			Name: "missing",
+			URL:  server.URL + "/nope",
+		}},
+		wantErr: Reject,
+	}, {
+		name: "dropped invalid response",
+		steps: []EnrichStep{{
+			Name:          "text",
+			URL:           server.URL + "/text",
+			FailurePolicy: Drop,
+		}},
+		wantErr: Drop,
+	}, {
+		name: "timeout",
+		steps: []EnrichStep{{
+			Name:    "slow",
+			URL:     server.URL + "/slow",
+			Timeout: 10 * time.Millisecond,
+		}},
+		wantErr: Reject,
+	}, {
+		name: "redirect",
+		steps: []EnrichStep{{
+			Name: "employee",
+			URL:  server.URL + "/redirect",
+		}},
+		wantErr: Reject,
+	}, {
+		name: "response too large",
+		steps: []EnrichStep{{
+			Name: "large",
+			URL:  server.URL + "/large",
+		}},
+		opts:    []Option{WithLimits(Limits{MaxOutputBytes: 100})},
+		wantErr: Reject,
+	}, {
+		name: "response within limits",
+		steps: []EnrichStep{{
+			Name: "employee",
+			URL:  server.URL + "/employees/octocat",
+		}},
+		opts: []Option{WithLimits(Limits{MaxOutputBytes: 100})},
+		want: `{"enrich":{"employee":{"name":"Mona","team":"hubbers"}},"sender":{"login":"octocat"}}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := CompileEnrichment(test.steps, 0, test.opts...)
+			if err != nil {
+				t.Fatalf("CompileEnrichment() = %v", err)
+			}
+			got, err := e.Enrich(ctx, input)
+			if test.wantErr != "" {
+				ee, ok := err.(*EnrichError)
+				if !ok {
+					t.Fatalf("Enrich() = %v, wanted *EnrichError", err)
+				}
+				if ee.Policy != test.wantErr {
+					t.Errorf("Enrich() policy = %v, wanted %v", ee.Policy, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Enrich() = %v", err)
+			}
+			b, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("json.Marshal() = %v", err)
+			}
+			if string(b) != test.want {
+				t.Errorf("Enrich() = %s, wanted %s", b, test.want)
+			}
+		})
+	}
+
+	if _, ok := input[EnrichKey]; ok {
+		t.Errorf("Enrich() modified its input: %v", input)
+	}
+}
+
+func TestEnrichCache(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		json.NewEncoder(w).Encode(n)
+	}))
+	defer server.Close()
+
+	clock := time.Now()
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return clock }
+
+	e, err := CompileEnrichment([]EnrichStep{{
+		Name:     "n",
+		URL:      server.URL,
+		Path:     "/{{ .id }}",
+		CacheTTL: time.Minute,
+	}}, 0)
+	if err != nil {
+		t.Fatalf("CompileEnrichment() = %v", err)
+	}
+
+	lookup := func(id string) interface{} {
+		got, err := e.Enrich(nil, map[string]interface{}{"id": id})
+		if err != nil {
+			t.Fatalf("Enrich() = %v", err)
+		}
+		return got.(map[string]interface{})[EnrichKey].(map[string]interface{})["n"]
+	}
+
+	if got, want := lookup("a"), float64(1); got != want {
+		t.Errorf("lookup(a) = %v, wanted %v", got, want)
+	}
+	// Cached.
+	if got, want := lookup("a"), float64(1); got != want {
+		t.Errorf("lookup(a) = %v, wanted %v", got, want)
+	}
+	// A different URL.
+	if got, want := lookup("b"), float64(2); got != want {
+		t.Errorf("lookup(b) = %v, wanted %v", got, want)
+	}
+	// Expired.
+	clock = clock.Add(time.Minute)
+	if got, want := lookup("a"), float64(3); got != want {
+		t.Errorf("lookup(a) = %v, wanted %v", got, want)
+	}
+}
+
+func TestEnrichErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []EnrichStep
+	}{{
+		name: "no steps",
+	}, {
+		name:  "unnamed",
+		steps: []EnrichStep{{URL: "http://foo"}},
+	}, {
+		name:  "duplicate names",
+		steps: []EnrichStep{{Name: "a", URL: "http://foo"}, {Name: "a", URL: "http://bar"}},
+	}, {
+		name:  "no url",
+		steps: []EnrichStep{{Name: "a"}},
+	}, {
+		name:  "templated url",
+		steps: []EnrichStep{{Name: "a", URL: "http://{{ .foo }}"}},
+	}, {
+		name:  "relative url",
+		steps: []EnrichStep{{Name: "a", URL: "/foo"}},
+	}, {
+		name:  "unsupported scheme",
+		steps: []EnrichStep{{Name: "a", URL: "file:///etc/passwd"}},
+	}, {
+		name:  "url with a query",
+		steps: []EnrichStep{{Name: "a", URL: "http://foo?bar=baz"}},
+	}, {
+		name:  "bad path template",
+		steps: []EnrichStep{{Name: "a", URL: "http://foo", Path: "/{{ .foo"}},
+	}, {
+		name:  "bad method",
+		steps: []EnrichStep{{Name: "a", URL: "http://foo", Method: "DELETE"}},
+	}, {
+		name:  "body without post",
+		steps: []EnrichStep{{Name: "a", URL: "http://foo", Body: "a: b"}},
+	}, {
+		name:  "bad policy",
+		steps: []EnrichStep{{Name: "a", URL: "http://foo", FailurePolicy: "Retry"}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := CompileEnrichment(test.steps, 0); err == nil {
+				t.Error("CompileEnrichment() = nil, wanted error")
+			}
+		})
+	}
+}
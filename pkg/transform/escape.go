@@ -0,0 +1,81 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"text/template"
+	"text/template/parse"
+)
+
+// escapers are the functions after which the output of an action is
+// already safe to emit.
+var escapers = map[string]bool{
+	"toJson": true,
+	"quote":  true,
+	"raw":    true,
+}
+
+// autoEscape rewrites the actions in the template (and the templates it
+// defines) to pipe their result through toJson, so that interpolated
+// values are always emitted as well-formed scalars.
+func autoEscape(t *template.Template) {
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+			continue
+		}
+		escapeNode(tmpl.Tree.Root)
+	}
+}
+
+func escapeNode(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeNode(child)
+		}
+	case *parse.ActionNode:
+		escapePipe(n.Pipe)
+	case *parse.IfNode:
+		escapeNode(n.List)
+		escapeNode(n.ElseList)
+	case *parse.RangeNode:
+		escapeNode(n.List)
+		escapeNode(n.ElseList)
+	case *parse.WithNode:
+		escapeNode(n.List)
+		escapeNode(n.ElseList)
+	}
+}
+
+func escapePipe(p *parse.PipeNode) {
+	// Actions that declare or assign variables produce no output.
+	if len(p.Decl) != 0 || len(p.Cmds) == 0 {
+		return
+	}
+	last := p.Cmds[len(p.Cmds)-1]
+	if id, ok := last.Args[0].(*parse.IdentifierNode); ok && escapers[id.Ident] {
+		return
+	}
+	p.Cmds = append(p.Cmds, &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      last.Pos,
+		Args:     []parse.Node{parse.NewIdentifier("toJson").SetPos(last.Pos)},
+	})
+}
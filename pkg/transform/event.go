@@ -0,0 +1,81 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"strings"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+// DataModel determines what templates are executed against.
+type DataModel string
+
+const (
+	// Body templates are executed against the event body, so its fields
+	// are addressed at the top level (e.g. {{ .action }}).
+	Body DataModel = "Body"
+
+	// Event templates are executed against the whole event: the body is
+	// under "data" and the cloud event attributes are under "ce" (e.g.
+	// {{ .data.action }} or {{ .ce.type }}).
+	Event DataModel = "Event"
+)
+
+// Input returns what templates of the given data model are executed
+// against for the event with the given context and decoded body.
+func Input(m DataModel, ctx *cloudevents.EventContext, body interface{}) interface{} {
+	if m != Event {
+		return body
+	}
+	return map[string]interface{}{
+		"data": body,
+		"ce":   Attributes(ctx),
+	}
+}
+
+// Attributes returns the cloud event attributes of the given context, as
+// they are exposed to templates: specVersion, id, type, typeVersion,
+// source, time, schemaURL, contentType and extensions.
+//
+// The names of extensions are lowercased, since those that arrive as HTTP
+// headers have had their names canonicalized (e.g. CE-X-Delivery).
+func Attributes(ctx *cloudevents.EventContext) map[string]interface{} {
+	if ctx == nil {
+		ctx = &cloudevents.EventContext{}
+	}
+	extensions := make(map[string]interface{}, len(ctx.Extensions))
+	for k, v := range ctx.Extensions {
+		extensions[strings.ToLower(k)] = v
+	}
+	var eventTime string
+	if !ctx.EventTime.IsZero() {
+		eventTime = ctx.EventTime.Format(time.RFC3339Nano)
+	}
+	return map[string]interface{}{
+		"specVersion": ctx.CloudEventsVersion,
+		"id":          ctx.EventID,
+		"type":        ctx.EventType,
+		"typeVersion": ctx.EventTypeVersion,
+		"source":      ctx.Source,
+		"time":        eventTime,
+		"schemaURL":   ctx.SchemaURL,
+		"contentType": ctx.ContentType,
+		"extensions":  extensions,
+	}
+}
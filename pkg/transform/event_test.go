@@ -0,0 +1,55 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestAttributesFromRequest(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"action": "opened"}`))
+	req.Header.Set("CE-CloudEventsVersion", "0.1")
+	req.Header.Set("CE-EventID", "1234")
+	req.Header.Set("CE-EventType", "dev.knative.source.github.issues")
+	req.Header.Set("CE-Source", "https://github.com/mattmoor/kfilter")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("CE-X-Delivery", `"abc-123"`)
+	req.Header.Set("ce-x-githubEvent", `"issues"`)
+
+	var body map[string]interface{}
+	ctx, err := cloudevents.Binary.FromRequest(&body, req)
+	if err != nil {
+		t.Fatalf("FromRequest() = %v", err)
+	}
+
+	m, err := Compile(`{{ .data.action }}/{{ .ce.extensions.delivery }}/{{ .ce.extensions.githubevent }}`,
+		WithDataModel(Event), WithFormat(Text))
+	if err != nil {
+		t.Fatalf("Compile() = %v", err)
+	}
+	got, err := m.Mutate(ctx, body)
+	if err != nil {
+		t.Fatalf("Mutate() = %v", err)
+	}
+	if want := "opened/abc-123/issues"; string(got) != want {
+		t.Errorf("Mutate() = %v, wanted %v", string(got), want)
+	}
+}
@@ -0,0 +1,500 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// now is how the "now" function tells the time (replaced in tests).
+var now = time.Now
+
+// funcs are the functions available to templates, in addition to the
+// text/template builtins.  Templates are supplied by users, so these
+// are limited to pure functions of their arguments (and the clock):
+// nothing may touch the environment, filesystem or network.
+var funcs = template.FuncMap{
+	// Strings
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      title,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":      split,
+	"join":       join,
+	"repeat":     repeat,
+	"substr":     substr,
+	"quote":      quote,
+	"toString":   toString,
+	"default":    defaultValue,
+	"empty":      empty,
+	"coalesce":   coalesce,
+
+	// Math
+	"add":   arithmetic(func(a, b float64) (float64, error) { return a + b, nil }),
+	"sub":   arithmetic(func(a, b float64) (float64, error) { return a - b, nil }),
+	"mul":   arithmetic(func(a, b float64) (float64, error) { return a * b, nil }),
+	"div":   arithmetic(divide),
+	"mod":   arithmetic(modulo),
+	"max":   arithmetic(func(a, b float64) (float64, error) { return math.Max(a, b), nil }),
+	"min":   arithmetic(func(a, b float64) (float64, error) { return math.Min(a, b), nil }),
+	"floor": rounding(math.Floor),
+	"ceil":  rounding(math.Ceil),
+	"round": rounding(round),
+
+	// Lists
+	"list":   func(items ...interface{}) []interface{} { return items },
+	"first":  first,
+	"last":   last,
+	"rest":   rest,
+	"append": appendList,
+	"has":    has,
+
+	// Dictionaries
+	"dict":   dict,
+	"get":    get,
+	"set":    set,
+	"hasKey": hasKey,
+	"keys":   keys,
+	"omit":   omit,
+
+	// Encoding
+	"toJson":   toJSON,
+	"fromJson": fromJSON,
+	"toYaml":   toYAML,
+	"raw":      func(v interface{}) interface{} { return v },
+	"b64enc":   func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec":   b64dec,
+
+	// Dates
+	"now":      func() time.Time { return now() },
+	"date":     date,
+	"toDate":   func(layout, value string) (time.Time, error) { return time.Parse(layout, value) },
+	"unixTime": func(t time.Time) int64 { return t.Unix() },
+
+	// Hashing
+	"sha1":   func(s string) string { sum := sha1.Sum([]byte(s)); return hex.EncodeToString(sum[:]) },
+	"sha256": func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) },
+}
+
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if prev == ' ' || prev == '\t' || prev == '\n' || prev == '-' || prev == '_' {
+			return []rune(strings.ToUpper(string(r)))[0]
+		}
+		return r
+	}, s)
+}
+
+func split(sep, s string) []interface{} {
+	parts := strings.Split(s, sep)
+	result := make([]interface{}, 0, len(parts))
+	for _, p := range parts {
+		result = append(result, p)
+	}
+	return result
+}
+
+func join(sep string, list interface{}) (string, error) {
+	items, err := toList(list)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		parts = append(parts, toString(item))
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func repeat(count int, s string) (string, error) {
+	if count < 0 {
+		return "", fmt.Errorf("repeat: negative count %d", count)
+	}
+	return strings.Repeat(s, count), nil
+}
+
+func substr(start, end int, s string) string {
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > len(s) {
+		end = len(s)
+	}
+	if start > end {
+		return ""
+	}
+	return s[start:end]
+}
+
+// quote renders the value as a string and quotes it as JSON, which is
+// also a valid YAML scalar.
+func quote(v interface{}) (string, error) {
+	return toJSON(toString(v))
+}
+
+// toString renders the value as it would appear in the template's output.
+func toString(v interface{}) string {
+	switch o := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return o
+	case []byte:
+		return string(o)
+	case error:
+		return o.Error()
+	case fmt.Stringer:
+		return o.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func defaultValue(def, v interface{}) interface{} {
+	if empty(v) {
+		return def
+	}
+	return v
+}
+
+// empty returns whether the value is missing or the zero value of its type.
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+	}
+}
+
+func coalesce(vs ...interface{}) interface{} {
+	for _, v := range vs {
+		if !empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch o := v.(type) {
+	case float64:
+		return o, nil
+	case float32:
+		return float64(o), nil
+	case int:
+		return float64(o), nil
+	case int32:
+		return float64(o), nil
+	case int64:
+		return float64(o), nil
+	case json.Number:
+		return o.Float64()
+	case string:
+		f, err := strconv.ParseFloat(o, 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected a number, got: %q", o)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("expected a number, got: %T", v)
+	}
+}
+
+func arithmetic(op func(a, b float64) (float64, error)) func(a, b interface{}) (float64, error) {
+	return func(a, b interface{}) (float64, error) {
+		fa, err := toFloat(a)
+		if err != nil {
+			return 0, err
+		}
+		fb, err := toFloat(b)
+		if err != nil {
+			return 0, err
+		}
+		return op(fa, fb)
+	}
+}
+
+func rounding(op func(float64) float64) func(interface{}) (float64, error) {
+	return func(v interface{}) (float64, error) {
+		f, err := toFloat(v)
+		if err != nil {
+			return 0, err
+		}
+		return op(f), nil
+	}
+}
+
+func divide(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return a / b, nil
+}
+
+func modulo(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return math.Mod(a, b), nil
+}
+
+func round(f float64) float64 {
+	if f < 0 {
+		return math.Ceil(f - 0.5)
+	}
+	return math.Floor(f + 0.5)
+}
+
+func toList(v interface{}) ([]interface{}, error) {
+	switch o := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return o, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Slice:
+		result := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			result = append(result, rv.Index(i).Interface())
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("expected a list, got: %T", v)
+	}
+}
+
+func first(list interface{}) (interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func last(list interface{}) (interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+func rest(list interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[1:], nil
+}
+
+func appendList(list interface{}, vs ...interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	// Copy, so that we never modify the input.
+	result := make([]interface{}, 0, len(items)+len(vs))
+	result = append(result, items...)
+	return append(result, vs...), nil
+}
+
+func has(v, list interface{}) (bool, error) {
+	items, err := toList(list)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if reflect.DeepEqual(item, v) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func dict(kvs ...interface{}) (map[string]interface{}, error) {
+	if len(kvs)%2 != 0 {
+		return nil, errors.New("dict expects an even number of arguments")
+	}
+	result := make(map[string]interface{}, len(kvs)/2)
+	for i := 0; i < len(kvs); i += 2 {
+		k, ok := kvs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict keys must be strings, got: %T", kvs[i])
+		}
+		result[k] = kvs[i+1]
+	}
+	return result, nil
+}
+
+func toDict(v interface{}) (map[string]interface{}, error) {
+	switch o := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return o, nil
+	default:
+		return nil, fmt.Errorf("expected a dict, got: %T", v)
+	}
+}
+
+func get(d interface{}, key string) (interface{}, error) {
+	m, err := toDict(d)
+	if err != nil {
+		return nil, err
+	}
+	return m[key], nil
+}
+
+func set(d interface{}, key string, v interface{}) (map[string]interface{}, error) {
+	m, err := toDict(d)
+	if err != nil {
+		return nil, err
+	}
+	// Copy, so that we never modify the input.
+	result := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		result[k] = v
+	}
+	result[key] = v
+	return result, nil
+}
+
+func hasKey(d interface{}, key string) (bool, error) {
+	m, err := toDict(d)
+	if err != nil {
+		return false, err
+	}
+	_, ok := m[key]
+	return ok, nil
+}
+
+func keys(d interface{}) ([]interface{}, error) {
+	m, err := toDict(d)
+	if err != nil {
+		return nil, err
+	}
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	result := make([]interface{}, 0, len(ks))
+	for _, k := range ks {
+		result = append(result, k)
+	}
+	return result, nil
+}
+
+func omit(d interface{}, drop ...string) (map[string]interface{}, error) {
+	m, err := toDict(d)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	for _, k := range drop {
+		delete(result, k)
+	}
+	return result, nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func fromJSON(s string) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+func b64dec(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// date formats the given time (or RFC3339 string, or unix seconds) using
+// the Go reference time layout.
+func date(layout string, v interface{}) (string, error) {
+	switch o := v.(type) {
+	case time.Time:
+		return o.Format(layout), nil
+	case string:
+		t, err := time.Parse(time.RFC3339, o)
+		if err != nil {
+			return "", err
+		}
+		return t.Format(layout), nil
+	default:
+		secs, err := toFloat(v)
+		if err != nil {
+			return "", fmt.Errorf("expected a time, got: %T", v)
+		}
+		return time.Unix(int64(secs), 0).UTC().Format(layout), nil
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestFuncs(t *testing.T) {
+	defer func(old func() time.Time) { now = old }(now)
+	now = func() time.Time { return time.Date(2018, 11, 5, 13, 30, 0, 0, time.UTC) }
+
+	input := map[string]interface{}{
+		"name":   "  Knative  ",
+		"login":  "mattmoor",
+		"count":  float64(7),
+		"empty":  "",
+		"labels": []interface{}{"bug", "help wanted"},
+		"user": map[string]interface{}{
+			"login": "mattmoor",
+			"id":    float64(42),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		// Strings
+		{name: "upper", template: `{{ upper .login }}`, want: "MATTMOOR"},
+		{name: "lower", template: `{{ lower "KnAtIvE" }}`, want: "knative"},
+		{name: "title", template: `{{ title "hello big-world" }}`, want: "Hello Big-World"},
+		{name: "trim", template: `{{ trim .name }}`, want: "Knative"},
+		{name: "trimPrefix", template: `{{ trimPrefix "dev." "dev.knative" }}`, want: "knative"},
+		{name: "trimSuffix", template: `{{ trimSuffix ".push" "github.push" }}`, want: "github"},
+		{name: "replace", template: `{{ replace "." "/" "a.b.c" }}`, want: "a/b/c"},
+		{name: "contains", template: `{{ contains "moo" .login }}`, want: "true"},
+		{name: "hasPrefix", template: `{{ hasPrefix "matt" .login }}`, want: "true"},
+		{name: "hasSuffix", template: `{{ hasSuffix "matt" .login }}`, want: "false"},
+		{name: "split", template: `{{ index (split "/" "a/b/c") 1 }}`, want: "b"},
+		{name: "join", template: `{{ join ", " .labels }}`, want: "bug, help wanted"},
+		{name: "join non-list", template: `{{ join ", " .login }}`, wantErr: "expected a list"},
+		{name: "repeat", template: `{{ repeat 3 "ab" }}`, want: "ababab"},
+		{name: "substr", template: `{{ substr 0 4 .login }}`, want: "matt"},
+		{name: "substr past end", template: `{{ substr 4 100 .login }}`, want: "moor"},
+		{name: "quote", template: `{{ quote "a \"b\"" }}`, want: `"a \"b\""`},
+		{name: "quote newline", template: `{{ quote "a:\nb" }}`, want: `"a:\nb"`},
+		{name: "quote number", template: `{{ quote .count }}`, want: `"7"`},
+		{name: "toString", template: `{{ toString .count }}`, want: "7"},
+		{name: "default (missing)", template: `{{ default "none" .missing }}`, want: "none"},
+		{name: "default (empty)", template: `{{ default "none" .empty }}`, want: "none"},
+		{name: "default (present)", template: `{{ default "none" .login }}`, want: "mattmoor"},
+		{name: "empty", template: `{{ empty .empty }} {{ empty .labels }}`, want: "true false"},
+		{name: "coalesce", template: `{{ coalesce .missing .empty .login }}`, want: "mattmoor"},
+
+		// Math
+		{name: "add", template: `{{ add .count 1 }}`, want: "8"},
+		{name: "sub", template: `{{ sub .count 2 }}`, want: "5"},
+		{name: "mul", template: `{{ mul .count 2 }}`, want: "14"},
+		{name: "div", template: `{{ div .count 2 }}`, want: "3.5"},
+		{name: "div by zero", template: `{{ div .count 0 }}`, wantErr: "division by zero"},
+		{name: "mod", template: `{{ mod .count 4 }}`, want: "3"},
+		{name: "mod by zero", template: `{{ mod .count 0 }}`, wantErr: "division by zero"},
+		{name: "max", template: `{{ max .count 10 }}`, want: "10"},
+		{name: "min", template: `{{ min .count 10 }}`, want: "7"},
+		{name: "floor", template: `{{ floor 2.7 }}`, want: "2"},
+		{name: "ceil", template: `{{ ceil 2.1 }}`, want: "3"},
+		{name: "round", template: `{{ round 2.5 }} {{ round -2.5 }}`, want: "3 -3"},
+		{name: "non-numeric", template: `{{ add .login 1 }}`, wantErr: "expected a number"},
+
+		// Lists
+		{name: "list", template: `{{ toJson (list 1 "a" true) }}`, want: `[1,"a",true]`},
+		{name: "first", template: `{{ first .labels }}`, want: "bug"},
+		{name: "last", template: `{{ last .labels }}`, want: "help wanted"},
+		{name: "rest", template: `{{ toJson (rest .labels) }}`, want: `["help wanted"]`},
+		{name: "append", template: `{{ toJson (append .labels "triage") }}`, want: `["bug","help wanted","triage"]`},
+		{name: "has", template: `{{ has "bug" .labels }} {{ has "nope" .labels }}`, want: "true false"},
+
+		// Dictionaries
+		{name: "dict", template: `{{ toJson (dict "a" 1 "b" .login) }}`, want: `{"a":1,"b":"mattmoor"}`},
+		{name: "dict odd arguments", template: `{{ dict "a" }}`, wantErr: "even number of arguments"},
+		{name: "get", template: `{{ get .user "login" }}`, want: "mattmoor"},
+		{name: "set", template: `{{ toJson (set .user "admin" true) }}`, want: `{"admin":true,"id":42,"login":"mattmoor"}`},
+		{name: "hasKey", template: `{{ hasKey .user "id" }} {{ hasKey .user "email" }}`, want: "true false"},
+		{name: "keys", template: `{{ toJson (keys .user) }}`, want: `["id","login"]`},
+		{name: "omit", template: `{{ toJson (omit .user "id") }}`, want: `{"login":"mattmoor"}`},
+		{name: "get non-dict", template: `{{ get .labels "a" }}`, wantErr: "expected a dict"},
+
+		// Encoding
+		{name: "toJson", template: `{{ toJson .user }}`, want: `{"id":42,"login":"mattmoor"}`},
+		{name: "fromJson", template: `{{ (fromJson "{\"a\":[1,2]}").a }}`, want: "[1 2]"},
+		{name: "toYaml", template: `{{ toYaml .user }}`, want: "id: 42\nlogin: mattmoor"},
+		{name: "raw", template: `{{ raw .login }}`, want: "mattmoor"},
+		{name: "b64enc", template: `{{ b64enc .login }}`, want: "bWF0dG1vb3I="},
+		{name: "b64dec", template: `{{ b64dec "bWF0dG1vb3I=" }}`, want: "mattmoor"},
+		{name: "b64dec invalid", template: `{{ b64dec "!!!" }}`, wantErr: "illegal base64"},
+
+		// Dates
+		{name: "now", template: `{{ now.UTC.Year }}`, want: "2018"},
+		{name: "date", template: `{{ date "2006-01-02" now }}`, want: "2018-11-05"},
+		{name: "date from string", template: `{{ date "15:04" "2018-11-05T13:30:00Z" }}`, want: "13:30"},
+		{name: "date from unix", template: `{{ date "2006" 0 }}`, want: "1970"},
+		{name: "toDate", template: `{{ (toDate "2006-01-02" "2018-11-05").Weekday }}`, want: "Monday"},
+		{name: "unixTime", template: `{{ unixTime now }}`, want: "1541424600"},
+
+		// Hashing
+		{name: "sha1", template: `{{ sha1 "abc" }}`, want: "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{name: "sha256", template: `{{ sha256 "abc" }}`, want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := template.New("test").Funcs(funcs).Parse(test.template)
+			if err != nil {
+				t.Fatalf("Parse() = %v", err)
+			}
+			buf := bytes.NewBuffer(nil)
+			err = tmpl.Execute(buf, input)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("Execute() = %v, wanted error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() = %v", err)
+			}
+			if got := buf.String(); got != test.want {
+				t.Errorf("Execute() = %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
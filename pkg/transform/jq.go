@@ -0,0 +1,92 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/itchyny/gojq"
+	"github.com/knative/pkg/cloudevents"
+)
+
+// CompileJQ compiles the given jq program into a Mutator, which runs it
+// against the event (according to the data model).  A program that
+// produces no result (or null) filters the event, and one that produces
+// more than one result is an error.  Of the options, only the data model
+// and limits are relevant.
+//
+// Programs cannot read the environment, other inputs or modules.
+func CompileJQ(query string, opts ...Option) (Mutator, error) {
+	o := &options{model: Body}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	q, err := gojq.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq program: %v", err)
+	}
+	code, err := gojq.Compile(q)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq program: %v", err)
+	}
+	return &jq{model: o.model, code: code, limits: o.limits}, nil
+}
+
+type jq struct {
+	model  DataModel
+	code   *gojq.Code
+	limits Limits
+}
+
+// jq implements Mutator
+var _ Mutator = (*jq)(nil)
+
+func (j *jq) Mutate(ctx *cloudevents.EventContext, body interface{}) ([]byte, error) {
+	c := context.Background()
+	if j.limits.Timeout != 0 {
+		var cancel context.CancelFunc
+		c, cancel = context.WithTimeout(c, j.limits.Timeout)
+		defer cancel()
+	}
+	iter := j.code.RunWithContext(c, Input(j.model, ctx, body))
+
+	var result interface{}
+	for count := 0; ; count++ {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			if c.Err() == context.DeadlineExceeded {
+				return nil, &LimitError{Limit: TimeoutLimit}
+			}
+			return nil, err
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("jq program produced more than one result")
+		}
+		result = v
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return j.limits.checkOutput(b)
+}
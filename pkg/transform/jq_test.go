@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestJQ(t *testing.T) {
+	input := map[string]interface{}{
+		"action": "opened",
+		"issue": map[string]interface{}{
+			"number": float64(42),
+			"labels": []interface{}{
+				map[string]interface{}{"name": "bug"},
+				map[string]interface{}{"name": "p0"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		opts  []Option
+		ctx   *cloudevents.EventContext
+		want  string
+	}{{
+		name:  "identity",
+		query: `.`,
+		want:  `{"action":"opened","issue":{"labels":[{"name":"bug"},{"name":"p0"}],"number":42}}`,
+	}, {
+		name:  "reshape",
+		query: `{id: .issue.number, labels: [.issue.labels[].name], urgent: any(.issue.labels[]; .name == "p0")}`,
+		want:  `{"id":42,"labels":["bug","p0"],"urgent":true}`,
+	}, {
+		name:  "scalar",
+		query: `.issue.labels | length`,
+		want:  `2`,
+	}, {
+		name:  "select filters",
+		query: `select(.action == "closed")`,
+		want:  `null`,
+	}, {
+		name:  "empty filters",
+		query: `empty`,
+		want:  `null`,
+	}, {
+		name:  "event data model",
+		query: `{type: .ce.type, action: .data.action}`,
+		opts:  []Option{WithDataModel(Event)},
+		ctx: &cloudevents.EventContext{
+			EventType: "dev.knative.source.github.issues",
+		},
+		want: `{"action":"opened","type":"dev.knative.source.github.issues"}`,
+	}, {
+		name:  "no access to the environment",
+		query: `$ENV | length`,
+		want:  `0`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := CompileJQ(test.query, test.opts...)
+			if err != nil {
+				t.Fatalf("CompileJQ() = %v", err)
+			}
+			got, err := m.Mutate(test.ctx, input)
+			if err != nil {
+				t.Fatalf("m.Mutate() = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("m.Mutate() = %v, wanted %v", string(got), test.want)
+			}
+		})
+	}
+}
+
+func TestJQErrors(t *testing.T) {
+	for _, query := range []string{`{`, `undefined_function(1)`, `$undefined`, `input`} {
+		if m, err := CompileJQ(query); err == nil {
+			t.Errorf("CompileJQ(%q) = %v, wanted error", query, m)
+		}
+	}
+
+	for _, query := range []string{`.[]`, `error("boom")`, `.action + 1`} {
+		m, err := CompileJQ(query)
+		if err != nil {
+			t.Fatalf("CompileJQ(%q) = %v", query, err)
+		}
+		if got, err := m.Mutate(nil, map[string]interface{}{"action": "opened", "b": 1.0}); err == nil {
+			t.Errorf("m.Mutate(%q) = %s, wanted error", query, got)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// newTemplate parses the named template, along with the libraries of the
+// given options (in order of their names), and checks that the templates
+// it invokes exist.
+func newTemplate(name, tmpl string, o *options) (*template.Template, error) {
+	t := template.New(name).Funcs(funcs).Funcs(valueFuncs(o))
+	names := make([]string, 0, len(o.libraries))
+	for n := range o.libraries {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if _, err := t.New(n).Parse(o.libraries[n]); err != nil {
+			return nil, fmt.Errorf("library %q: %v", n, err)
+		}
+	}
+	if _, err := t.Parse(tmpl); err != nil {
+		return nil, err
+	}
+
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		if err := checkReferences(t, tmpl.Tree.Root); err != nil {
+			return nil, fmt.Errorf("template: %s: %v", tmpl.Name(), err)
+		}
+	}
+	return t, nil
+}
+
+// checkReferences returns an error if the given node invokes a template
+// that isn't associated with t.
+func checkReferences(t *template.Template, n parse.Node) error {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkReferences(t, child); err != nil {
+				return err
+			}
+		}
+	case *parse.TemplateNode:
+		if t.Lookup(n.Name) == nil {
+			return fmt.Errorf("no such template %q", n.Name)
+		}
+	case *parse.IfNode:
+		return checkBranches(t, &n.BranchNode)
+	case *parse.RangeNode:
+		return checkBranches(t, &n.BranchNode)
+	case *parse.WithNode:
+		return checkBranches(t, &n.BranchNode)
+	}
+	return nil
+}
+
+func checkBranches(t *template.Template, n *parse.BranchNode) error {
+	if err := checkReferences(t, n.List); err != nil {
+		return err
+	}
+	return checkReferences(t, n.ElseList)
+}
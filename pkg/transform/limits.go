@@ -0,0 +1,291 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	// DefaultTimeout is how long a transform may take per event by default.
+	DefaultTimeout = time.Second
+
+	// DefaultMaxOutputBytes is how large a transform's result may be by
+	// default.
+	DefaultMaxOutputBytes = 4 << 20
+
+	// DefaultMaxDepth is how deeply templates may invoke one another by
+	// default.
+	DefaultMaxDepth = 100
+
+	// DefaultMaxSteps is how many computation steps scripts may take by
+	// default.
+	DefaultMaxSteps = 1000000
+)
+
+// Limit identifies one of the limits on transforming an event.
+type Limit string
+
+const (
+	// TimeoutLimit bounds how long a transform may take.
+	TimeoutLimit Limit = "timeout"
+
+	// OutputLimit bounds how large a transform's result may be.
+	OutputLimit Limit = "output size"
+
+	// DepthLimit bounds how deeply templates may invoke one another.
+	DepthLimit Limit = "depth"
+
+	// StepLimit bounds how many computation steps a script may take.
+	StepLimit Limit = "step"
+)
+
+// LimitError is returned when transforming an event exceeds one of the
+// Limits it is compiled with.
+type LimitError struct {
+	Limit Limit
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("transform exceeded its %s limit", e.Limit)
+}
+
+// Limits bound the resources that transforming a single event may use.
+// Zero values are unlimited.
+type Limits struct {
+	// Timeout bounds how long the transform may take.  Templates check it
+	// as they write output, iterate and invoke other templates, so a
+	// single long-running function call isn't interrupted.
+	Timeout time.Duration
+
+	// MaxOutputBytes bounds how large the result may be.
+	MaxOutputBytes int
+
+	// MaxDepth bounds how deeply templates may invoke one another,
+	// e.g. recursively.
+	MaxDepth int
+
+	// MaxSteps bounds how many computation steps a script may take,
+	// which (unlike Timeout) doesn't depend upon how busy the process is.
+	MaxSteps int
+}
+
+// WithLimits bounds the resources that templates, jq programs and scripts
+// may use per event, failing with a *LimitError when they exceed them.
+// Only scripts are subject to MaxSteps, and only templates to MaxDepth.
+func WithLimits(l Limits) Option {
+	return func(o *options) {
+		o.limits = l
+	}
+}
+
+// within returns the limits of an execution that must finish by the given
+// deadline (when there is a timeout), so that the executions of several
+// templates that make up one transform share its timeout.
+func (l Limits) within(deadline time.Time) (Limits, error) {
+	if l.Timeout == 0 {
+		return l, nil
+	}
+	l.Timeout = time.Until(deadline)
+	if l.Timeout <= 0 {
+		return l, &LimitError{Limit: TimeoutLimit}
+	}
+	return l, nil
+}
+
+// checkOutput fails with a *LimitError when the given result exceeds the
+// output size limit.
+func (l Limits) checkOutput(result []byte) ([]byte, error) {
+	if l.MaxOutputBytes != 0 && len(result) > l.MaxOutputBytes {
+		return nil, &LimitError{Limit: OutputLimit}
+	}
+	return result, nil
+}
+
+// deadline returns when a transform that starts now must finish, or the
+// zero time when there is no timeout.
+func (l Limits) deadline() time.Time {
+	if l.Timeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(l.Timeout)
+}
+
+// Names of the functions that instrument injects.
+const (
+	checkFunc = "_check"
+	enterFunc = "_enter"
+	leaveFunc = "_leave"
+)
+
+// instrumented reports whether templates need instrumenting to enforce
+// the limits.
+func (l Limits) instrumented() bool {
+	return l.Timeout != 0 || l.MaxDepth != 0
+}
+
+// instrument injects calls to the functions through which executions
+// enforce their limits: at the start of each iteration of a range, and
+// around each invocation of a template.
+func instrument(t *template.Template) {
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+			continue
+		}
+		instrumentNode(tmpl.Tree.Root)
+	}
+}
+
+func instrumentNode(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		nodes := make([]parse.Node, 0, len(n.Nodes))
+		for _, child := range n.Nodes {
+			if tn, ok := child.(*parse.TemplateNode); ok {
+				nodes = append(nodes, call(enterFunc, tn.Pos), tn, call(leaveFunc, tn.Pos))
+				continue
+			}
+			instrumentNode(child)
+			nodes = append(nodes, child)
+		}
+		n.Nodes = nodes
+	case *parse.IfNode:
+		instrumentNode(n.List)
+		instrumentNode(n.ElseList)
+	case *parse.RangeNode:
+		instrumentNode(n.List)
+		instrumentNode(n.ElseList)
+		n.List.Nodes = append([]parse.Node{call(checkFunc, n.Pos)}, n.List.Nodes...)
+	case *parse.WithNode:
+		instrumentNode(n.List)
+		instrumentNode(n.ElseList)
+	}
+}
+
+// call returns an action that calls the named function, which takes no
+// arguments and outputs nothing.
+func call(name string, pos parse.Pos) *parse.ActionNode {
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      pos,
+				Args:     []parse.Node{parse.NewIdentifier(name).SetPos(pos)},
+			}},
+		},
+	}
+}
+
+// execute executes the template against data into w, subject to the
+// given limits.  A template compiled with limits that need instrumenting
+// must have been instrumented.
+func execute(t *template.Template, w io.Writer, data interface{}, l Limits) error {
+	e := &execution{Limits: l, w: w}
+	if l.Timeout != 0 {
+		e.deadline = time.Now().Add(l.Timeout)
+	}
+	if l.instrumented() || l.MaxOutputBytes != 0 {
+		// Each execution tracks its own limits.
+		c, err := t.Clone()
+		if err != nil {
+			return err
+		}
+		t = c.Funcs(template.FuncMap{
+			checkFunc: e.check,
+			enterFunc: e.enter,
+			leaveFunc: e.leave,
+			"repeat":  e.repeat,
+		})
+	}
+	err := t.Execute(e, data)
+	if e.err != nil {
+		return e.err
+	}
+	return err
+}
+
+// execution tracks a single execution of a template against its limits.
+type execution struct {
+	Limits
+
+	w        io.Writer
+	deadline time.Time
+	written  int
+	depth    int
+
+	// err is the first LimitError the execution encountered.
+	err error
+}
+
+// fail records that the execution exceeded the given limit.
+func (e *execution) fail(l Limit) error {
+	if e.err == nil {
+		e.err = &LimitError{Limit: l}
+	}
+	return e.err
+}
+
+func (e *execution) Write(p []byte) (int, error) {
+	if _, err := e.check(); err != nil {
+		return 0, err
+	}
+	if e.MaxOutputBytes != 0 && e.written+len(p) > e.MaxOutputBytes {
+		return 0, e.fail(OutputLimit)
+	}
+	e.written += len(p)
+	return e.w.Write(p)
+}
+
+func (e *execution) check() (string, error) {
+	if !e.deadline.IsZero() && time.Now().After(e.deadline) {
+		return "", e.fail(TimeoutLimit)
+	}
+	return "", nil
+}
+
+func (e *execution) enter() (string, error) {
+	e.depth++
+	if e.MaxDepth != 0 && e.depth > e.MaxDepth {
+		return "", e.fail(DepthLimit)
+	}
+	return e.check()
+}
+
+func (e *execution) leave() string {
+	e.depth--
+	return ""
+}
+
+// repeat is the "repeat" function, bounded by the output the execution
+// may still write so that it fails before building an oversized string.
+func (e *execution) repeat(count int, s string) (string, error) {
+	if e.MaxOutputBytes != 0 && len(s) != 0 && count > (e.MaxOutputBytes-e.written)/len(s) {
+		return "", e.fail(OutputLimit)
+	}
+	return repeat(count, s)
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestLimits(t *testing.T) {
+	items := make([]interface{}, 1000)
+	for i := range items {
+		items[i] = i
+	}
+	input := map[string]interface{}{"items": items}
+
+	tests := []struct {
+		name    string
+		compile func(...Option) (Mutator, error)
+		limits  Limits
+		want    Limit
+	}{{
+		name: "within limits",
+		compile: func(opts ...Option) (Mutator, error) {
+			return Compile(`{{ template "count" . }}`, append(opts, WithLibraries(map[string]string{
+				"count": `{{ define "count" }}count: {{ len .items }}{{ end }}`,
+			}))...)
+		},
+		limits: Limits{Timeout: time.Minute, MaxOutputBytes: 100, MaxDepth: 1},
+	}, {
+		name: "recursion",
+		compile: func(opts ...Option) (Mutator, error) {
+			return Compile(`{{ template "loop" . }}`, append(opts, WithLibraries(map[string]string{
+				"loop": `{{ define "loop" }}{{ template "loop" . }}{{ end }}`,
+			}))...)
+		},
+		limits: Limits{MaxDepth: 10},
+		want:   DepthLimit,
+	}, {
+		name: "output",
+		compile: func(opts ...Option) (Mutator, error) {
+			return Compile(`{{ range .items }}- {{ . }}
+{{ end }}`, opts...)
+		},
+		limits: Limits{MaxOutputBytes: 100},
+		want:   OutputLimit,
+	}, {
+		name: "repeat",
+		compile: func(opts ...Option) (Mutator, error) {
+			return Compile(`{{ repeat 10000000000 "x" }}`, opts...)
+		},
+		limits: Limits{MaxOutputBytes: 100},
+		want:   OutputLimit,
+	}, {
+		name: "silent range",
+		compile: func(opts ...Option) (Mutator, error) {
+			return Compile(`{{ range .items }}{{ range $.items }}{{ end }}{{ end }}`, opts...)
+		},
+		limits: Limits{Timeout: time.Nanosecond},
+		want:   TimeoutLimit,
+	}, {
+		name: "patch within limits",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompilePatch([]PatchOperation{{
+				Op:    "add",
+				Path:  "/count",
+				Value: []byte(`"{{ template \"count\" . }}"`),
+			}, {
+				Op:   "remove",
+				Path: "/items",
+			}}, append(opts, WithLibraries(map[string]string{
+				"count": `{{ define "count" }}{{ len .items }}{{ end }}`,
+			}))...)
+		},
+		limits: Limits{Timeout: time.Minute, MaxOutputBytes: 100, MaxDepth: 1},
+	}, {
+		name: "patch value output",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompilePatch([]PatchOperation{{
+				Op:    "replace",
+				Path:  "/items",
+				Value: []byte(`"{{ range .items }}{{ . }},{{ end }}"`),
+			}}, opts...)
+		},
+		limits: Limits{MaxOutputBytes: 100},
+		want:   OutputLimit,
+	}, {
+		name: "patch result output",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompilePatch([]PatchOperation{{
+				Op:   "copy",
+				From: "/items",
+				Path: "/copy",
+			}}, opts...)
+		},
+		limits: Limits{MaxOutputBytes: 100},
+		want:   OutputLimit,
+	}, {
+		name: "patch value timeout",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompilePatch([]PatchOperation{{
+				Op:    "add",
+				Path:  "/x",
+				Value: []byte(`"{{ range .items }}{{ range $.items }}{{ end }}{{ end }}"`),
+			}}, opts...)
+		},
+		limits: Limits{Timeout: time.Nanosecond},
+		want:   TimeoutLimit,
+	}, {
+		name: "patch library recursion",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompilePatch([]PatchOperation{{
+				Op:    "add",
+				Path:  "/x",
+				Value: []byte(`"{{ template \"loop\" . }}"`),
+			}}, append(opts, WithLibraries(map[string]string{
+				"loop": `{{ define "loop" }}{{ template "loop" . }}{{ end }}`,
+			}))...)
+		},
+		limits: Limits{MaxDepth: 10},
+		want:   DepthLimit,
+	}, {
+		name: "merge patch timeout",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompileMergePatch([]byte(`{"x": "{{ range .items }}{{ range $.items }}{{ end }}{{ end }}"}`), opts...)
+		},
+		limits: Limits{Timeout: time.Nanosecond},
+		want:   TimeoutLimit,
+	}, {
+		name: "jq within limits",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompileJQ(`{count: (.items | length)}`, opts...)
+		},
+		limits: Limits{Timeout: time.Minute, MaxOutputBytes: 100},
+	}, {
+		name: "jq output",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompileJQ(`.items`, opts...)
+		},
+		limits: Limits{MaxOutputBytes: 100},
+		want:   OutputLimit,
+	}, {
+		name: "jq timeout",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompileJQ(`def f: f; f`, opts...)
+		},
+		limits: Limits{Timeout: 10 * time.Millisecond},
+		want:   TimeoutLimit,
+	}, {
+		name: "script within limits",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompileScript("def transform(event):\n  return {'count': len(event['items'])}\n", opts...)
+		},
+		limits: Limits{Timeout: time.Minute, MaxOutputBytes: 100, MaxSteps: 1000},
+	}, {
+		name: "script output",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompileScript("def transform(event):\n  return event['items']\n", opts...)
+		},
+		limits: Limits{MaxOutputBytes: 100},
+		want:   OutputLimit,
+	}, {
+		name: "script steps",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompileScript("def transform(event):\n  for i in range(1 << 30):\n    pass\n", opts...)
+		},
+		limits: Limits{MaxSteps: 1000},
+		want:   StepLimit,
+	}, {
+		name: "script timeout",
+		compile: func(opts ...Option) (Mutator, error) {
+			return CompileScript("def transform(event):\n  for i in range(1 << 30):\n    pass\n", opts...)
+		},
+		limits: Limits{Timeout: 10 * time.Millisecond},
+		want:   TimeoutLimit,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := test.compile(WithLimits(test.limits))
+			if err != nil {
+				t.Fatalf("compile() = %v", err)
+			}
+			_, err = m.Mutate(&cloudevents.EventContext{}, input)
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("Mutate() = %v", err)
+				}
+				return
+			}
+			if le, ok := err.(*LimitError); !ok || le.Limit != test.want {
+				t.Errorf("Mutate() = %v, wanted the %s limit", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLimitsAreRepeatable(t *testing.T) {
+	// Each execution tracks its own depth.
+	m, err := Compile(`{{ template "one" . }}`, WithLimits(Limits{MaxDepth: 2}), WithLibraries(map[string]string{
+		"one": `{{ define "one" }}{{ template "two" . }}{{ end }}{{ define "two" }}count: 1{{ end }}`,
+	}))
+	if err != nil {
+		t.Fatalf("Compile() = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		got, err := m.Mutate(&cloudevents.EventContext{}, map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("Mutate() = %v", err)
+		}
+		if want := `{"count":1}`; string(got) != want {
+			t.Errorf("Mutate() = %s, wanted %s", got, want)
+		}
+	}
+}
+
+func TestAttributeLimits(t *testing.T) {
+	items := make([]interface{}, 1000)
+	for i := range items {
+		items[i] = i
+	}
+	input := map[string]interface{}{"items": items}
+
+	tests := []struct {
+		name   string
+		at     AttributeTemplates
+		limits Limits
+		want   Limit
+	}{{
+		name: "within limits",
+		at: AttributeTemplates{
+			Type: `count.{{ template "count" . }}`,
+		},
+		limits: Limits{Timeout: time.Minute, MaxOutputBytes: 100, MaxDepth: 1},
+	}, {
+		name: "output",
+		at: AttributeTemplates{
+			Source: `{{ range .items }}{{ . }},{{ end }}`,
+		},
+		limits: Limits{MaxOutputBytes: 100},
+		want:   OutputLimit,
+	}, {
+		name: "timeout",
+		at: AttributeTemplates{
+			Extensions: map[string]string{
+				"slow": `{{ range .items }}{{ range $.items }}{{ end }}{{ end }}`,
+			},
+		},
+		limits: Limits{Timeout: time.Nanosecond},
+		want:   TimeoutLimit,
+	}, {
+		name: "library recursion",
+		at: AttributeTemplates{
+			Subject: `{{ template "loop" . }}`,
+		},
+		limits: Limits{MaxDepth: 10},
+		want:   DepthLimit,
+	}}
+
+	libraries := WithLibraries(map[string]string{
+		"count": `{{ define "count" }}{{ len .items }}{{ end }}`,
+		"loop":  `{{ define "loop" }}{{ template "loop" . }}{{ end }}`,
+	})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cm, err := CompileAttributes(test.at, WithLimits(test.limits), libraries)
+			if err != nil {
+				t.Fatalf("CompileAttributes() = %v", err)
+			}
+			_, err = cm.MutateContext(&cloudevents.EventContext{}, input)
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("MutateContext() = %v", err)
+				}
+				return
+			}
+			if le, ok := err.(*LimitError); !ok || le.Limit != test.want {
+				t.Errorf("MutateContext() = %v, wanted the %s limit", err, test.want)
+			}
+		})
+	}
+}
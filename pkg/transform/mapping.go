@@ -0,0 +1,122 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/fieldpath"
+)
+
+// MappingRule is a single step of a mapping.  It either copies the value
+// at From (within the input) to To (within the result), or it removes the
+// value at Drop from the result.  Paths are dot-separated, and the empty
+// path selects the whole input (or result), except that a rule with a
+// Default but no From sets To to the Default.
+type MappingRule struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Default is the JSON value to use when nothing is found at From.  When
+	// it is omitted, To is left untouched.
+	Default json.RawMessage `json:"default,omitempty"`
+
+	Drop string `json:"drop,omitempty"`
+}
+
+// CompileMapping compiles the given rules into a Mutator, which applies
+// them in order to produce the result (starting from an empty object).
+// Values are copied as they are, so their JSON types are preserved.  Of
+// the options, only the data model is relevant.
+func CompileMapping(rules []MappingRule, opts ...Option) (Mutator, error) {
+	o := &options{model: Body}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	m := &mapping{
+		model: o.model,
+		rules: make([]rule, 0, len(rules)),
+	}
+	for i, r := range rules {
+		if r.Drop != "" {
+			if r.From != "" || r.To != "" || len(r.Default) != 0 {
+				return nil, fmt.Errorf("mapping rule %d: drop cannot be combined with from, to or default", i)
+			}
+			m.rules = append(m.rules, rule{drop: r.Drop})
+			continue
+		}
+		compiled := rule{from: r.From, to: r.To}
+		if len(r.Default) != 0 {
+			if err := json.Unmarshal(r.Default, &compiled.def); err != nil {
+				return nil, fmt.Errorf("mapping rule %d: invalid default: %v", i, err)
+			}
+			compiled.hasDefault = true
+		}
+		m.rules = append(m.rules, compiled)
+	}
+	if len(m.rules) == 0 {
+		return nil, errors.New("mapping has no rules")
+	}
+	return m, nil
+}
+
+type rule struct {
+	from       string
+	to         string
+	def        interface{}
+	hasDefault bool
+	drop       string
+}
+
+type mapping struct {
+	model DataModel
+	rules []rule
+}
+
+// mapping implements Mutator
+var _ Mutator = (*mapping)(nil)
+
+func (m *mapping) Mutate(ctx *cloudevents.EventContext, body interface{}) ([]byte, error) {
+	input := Input(m.model, ctx, body)
+
+	var result interface{} = map[string]interface{}{}
+	for _, r := range m.rules {
+		if r.drop != "" {
+			result = fieldpath.Delete(result, r.drop)
+			continue
+		}
+		v, ok := fieldpath.Get(input, r.from)
+		if !ok || (r.from == "" && r.hasDefault) {
+			if !r.hasDefault {
+				continue
+			}
+			v = r.def
+		}
+		// Copy the value, so that later rules can't modify the input.
+		var err error
+		if result, err = fieldpath.Set(result, r.to, fieldpath.Copy(v)); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(result)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestMapping(t *testing.T) {
+	newInput := func() map[string]interface{} {
+		return map[string]interface{}{
+			"action": "opened",
+			"issue": map[string]interface{}{
+				"number": float64(42),
+				"title":  "it: broke",
+				"locked": false,
+				"labels": []interface{}{"bug", "p0"},
+				"user": map[string]interface{}{
+					"login": "mattmoor",
+					"email": "matt@example.com",
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		rules []MappingRule
+		opts  []Option
+		ctx   *cloudevents.EventContext
+		want  string
+	}{{
+		name: "rename and project",
+		rules: []MappingRule{{
+			From: "issue.number",
+			To:   "id",
+		}, {
+			From: "issue.title",
+			To:   "summary.title",
+		}, {
+			From: "issue.user.login",
+			To:   "author",
+		}},
+		want: `{"author":"mattmoor","id":42,"summary":{"title":"it: broke"}}`,
+	}, {
+		name: "types are preserved",
+		rules: []MappingRule{{
+			From: "issue.locked",
+			To:   "locked",
+		}, {
+			From: "issue.labels",
+			To:   "labels",
+		}, {
+			From: "issue.labels.1",
+			To:   "priority",
+		}},
+		want: `{"labels":["bug","p0"],"locked":false,"priority":"p0"}`,
+	}, {
+		name: "defaults",
+		rules: []MappingRule{{
+			From:    "issue.assignee.login",
+			To:      "assignee",
+			Default: []byte(`"nobody"`),
+		}, {
+			From:    "issue.milestone",
+			To:      "milestone",
+			Default: []byte(`{"title":null}`),
+		}, {
+			From: "issue.closed_at",
+			To:   "closed",
+		}, {
+			From:    "action",
+			To:      "action",
+			Default: []byte(`"unknown"`),
+		}},
+		want: `{"action":"opened","assignee":"nobody","milestone":{"title":null}}`,
+	}, {
+		name: "constant",
+		rules: []MappingRule{{
+			To:      "kind",
+			Default: []byte(`"issue"`),
+		}},
+		want: `{"kind":"issue"}`,
+	}, {
+		name: "copy everything and drop",
+		rules: []MappingRule{{
+			From: "issue",
+		}, {
+			Drop: "user.email",
+		}, {
+			Drop: "labels.0",
+		}, {
+			Drop: "locked",
+		}},
+		want: `{"labels":["p0"],"number":42,"title":"it: broke","user":{"login":"mattmoor"}}`,
+	}, {
+		name: "drop everything",
+		rules: []MappingRule{{
+			From: "action",
+			To:   "action",
+		}, {
+			Drop: "action",
+		}},
+		want: `{}`,
+	}, {
+		name: "event data model",
+		rules: []MappingRule{{
+			From: "ce.type",
+			To:   "type",
+		}, {
+			From: "data.action",
+			To:   "action",
+		}},
+		opts: []Option{WithDataModel(Event)},
+		ctx: &cloudevents.EventContext{
+			EventType: "dev.knative.source.github.issues",
+		},
+		want: `{"action":"opened","type":"dev.knative.source.github.issues"}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := CompileMapping(test.rules, test.opts...)
+			if err != nil {
+				t.Fatalf("CompileMapping() = %v", err)
+			}
+			input := newInput()
+			got, err := m.Mutate(test.ctx, input)
+			if err != nil {
+				t.Fatalf("m.Mutate() = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("m.Mutate() = %v, wanted %v", string(got), test.want)
+			}
+			// The input should never be modified.
+			if diff := cmp.Diff(newInput(), input); diff != "" {
+				t.Errorf("input was modified (-want +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestMappingErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []MappingRule
+	}{{
+		name: "no rules",
+	}, {
+		name: "drop with from",
+		rules: []MappingRule{{
+			From: "foo",
+			Drop: "bar",
+		}},
+	}, {
+		name: "invalid default",
+		rules: []MappingRule{{
+			From:    "foo",
+			To:      "bar",
+			Default: []byte(`{not json`),
+		}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if m, err := CompileMapping(test.rules); err == nil {
+				t.Errorf("CompileMapping() = %v, wanted error", m)
+			}
+		})
+	}
+
+	// Mapping into a scalar fails at runtime.
+	m, err := CompileMapping([]MappingRule{{
+		From: "action",
+		To:   "action",
+	}, {
+		From: "action",
+		To:   "action.name",
+	}})
+	if err != nil {
+		t.Fatalf("CompileMapping() = %v", err)
+	}
+	if got, err := m.Mutate(nil, map[string]interface{}{"action": "opened"}); err == nil {
+		t.Errorf("m.Mutate() = %s, wanted error", got)
+	}
+}
@@ -0,0 +1,311 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/knative/pkg/cloudevents"
+)
+
+// PatchOperation is a single JSON Patch (RFC 6902) operation.  String
+// leaves of the Value may contain template actions, see CompilePatch.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// CompilePatch compiles the given JSON Patch (RFC 6902) into a Mutator,
+// which applies it to the event body.
+//
+// String leaves within the values of the operations are templates, which
+// are executed against the event (according to the data model).  A string
+// consisting of a single action (e.g. "{{ .issue.number }}") is replaced
+// by the value of that action, so its JSON type is preserved; any other
+// string is replaced by the text it renders.
+func CompilePatch(ops []PatchOperation, opts ...Option) (Mutator, error) {
+	o := &options{model: Body}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if len(ops) == 0 {
+		return nil, errors.New("patch has no operations")
+	}
+
+	p := &patch{
+		model:  o.model,
+		limits: o.limits,
+		ops:    make([]patchOp, 0, len(ops)),
+	}
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if len(op.Value) == 0 {
+				return nil, fmt.Errorf("patch operation %d: %q requires a value", i, op.Op)
+			}
+		case "move", "copy":
+			if op.From == "" {
+				return nil, fmt.Errorf("patch operation %d: %q requires from", i, op.Op)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("patch operation %d: unsupported op %q", i, op.Op)
+		}
+		compiled := patchOp{op: op.Op, path: op.Path, from: op.From}
+		if len(op.Value) != 0 {
+			v, err := compileValue(op.Value, o)
+			if err != nil {
+				return nil, fmt.Errorf("patch operation %d: %v", i, err)
+			}
+			compiled.value = v
+			compiled.hasValue = true
+		}
+		p.ops = append(p.ops, compiled)
+	}
+	return p, nil
+}
+
+type patchOp struct {
+	op    string
+	path  string
+	from  string
+	value interface{}
+	// hasValue is set when the operation has a value, which may be null.
+	hasValue bool
+}
+
+type patch struct {
+	model  DataModel
+	limits Limits
+	ops    []patchOp
+}
+
+// patch implements Mutator
+var _ Mutator = (*patch)(nil)
+
+func (p *patch) Mutate(ctx *cloudevents.EventContext, body interface{}) ([]byte, error) {
+	r := &valueRenderer{input: Input(p.model, ctx, body), limits: p.limits, deadline: p.limits.deadline()}
+
+	ops := make([]map[string]interface{}, 0, len(p.ops))
+	for _, op := range p.ops {
+		rendered := map[string]interface{}{
+			"op":   op.op,
+			"path": op.path,
+		}
+		if op.from != "" {
+			rendered["from"] = op.from
+		}
+		if op.hasValue {
+			v, err := r.render(op.value)
+			if err != nil {
+				return nil, err
+			}
+			rendered["value"] = v
+		}
+		ops = append(ops, rendered)
+	}
+
+	encoded, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	jp, err := jsonpatch.DecodePatch(encoded)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	result, err := jp.Apply(doc)
+	if err != nil {
+		return nil, err
+	}
+	return p.limits.checkOutput(result)
+}
+
+// CompileMergePatch compiles the given JSON Merge Patch (RFC 7386) into a
+// Mutator, which applies it to the event body.  String leaves of the patch
+// are templates, as with CompilePatch.
+func CompileMergePatch(mergePatch json.RawMessage, opts ...Option) (Mutator, error) {
+	o := &options{model: Body}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if len(mergePatch) == 0 {
+		return nil, errors.New("merge patch is empty")
+	}
+	v, err := compileValue(mergePatch, o)
+	if err != nil {
+		return nil, fmt.Errorf("merge patch: %v", err)
+	}
+	return &mergePatchMutator{model: o.model, limits: o.limits, patch: v}, nil
+}
+
+type mergePatchMutator struct {
+	model  DataModel
+	limits Limits
+	patch  interface{}
+}
+
+// mergePatchMutator implements Mutator
+var _ Mutator = (*mergePatchMutator)(nil)
+
+func (mp *mergePatchMutator) Mutate(ctx *cloudevents.EventContext, body interface{}) ([]byte, error) {
+	r := &valueRenderer{input: Input(mp.model, ctx, body), limits: mp.limits, deadline: mp.limits.deadline()}
+	v, err := r.render(mp.patch)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	result, err := jsonpatch.MergePatch(doc, encoded)
+	if err != nil {
+		return nil, err
+	}
+	return mp.limits.checkOutput(result)
+}
+
+// valueTemplate is a string leaf of a JSON value that contains actions.
+type valueTemplate struct {
+	t *template.Template
+	// typed is set when the template consists of a single action, whose
+	// value replaces the string (instead of the text it renders).
+	typed bool
+}
+
+// compileValue decodes the given JSON value, replacing its string leaves
+// that contain actions with valueTemplates.
+func compileValue(raw json.RawMessage, o *options) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return compileLeaves(v, o)
+}
+
+func compileLeaves(v interface{}, opts *options) (interface{}, error) {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		for k, elt := range o {
+			compiled, err := compileLeaves(elt, opts)
+			if err != nil {
+				return nil, err
+			}
+			o[k] = compiled
+		}
+		return o, nil
+	case []interface{}:
+		for i, elt := range o {
+			compiled, err := compileLeaves(elt, opts)
+			if err != nil {
+				return nil, err
+			}
+			o[i] = compiled
+		}
+		return o, nil
+	case string:
+		if !strings.Contains(o, "{{") {
+			return o, nil
+		}
+		t, err := newTemplate("value", o, opts)
+		if err != nil {
+			return nil, err
+		}
+		nodes := t.Tree.Root.Nodes
+		typed := len(nodes) == 1 && nodes[0].Type() == parse.NodeAction
+		if typed {
+			autoEscape(t)
+		}
+		if opts.limits.instrumented() {
+			instrument(t)
+		}
+		return &valueTemplate{t: t, typed: typed}, nil
+	default:
+		return v, nil
+	}
+}
+
+// valueRenderer executes the valueTemplates of a compiled value for a
+// single event, subject to their shared limits.
+type valueRenderer struct {
+	input    interface{}
+	limits   Limits
+	deadline time.Time
+}
+
+// render returns a copy of the given compiled value, with its
+// valueTemplates executed against the input.
+func (r *valueRenderer) render(v interface{}) (interface{}, error) {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(o))
+		for k, elt := range o {
+			rendered, err := r.render(elt)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = rendered
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, 0, len(o))
+		for _, elt := range o {
+			rendered, err := r.render(elt)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, rendered)
+		}
+		return result, nil
+	case *valueTemplate:
+		l, err := r.limits.within(r.deadline)
+		if err != nil {
+			return nil, err
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := execute(o.t, buf, r.input, l); err != nil {
+			return nil, err
+		}
+		if !o.typed {
+			return buf.String(), nil
+		}
+		var result interface{}
+		if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestPatch(t *testing.T) {
+	input := map[string]interface{}{
+		"action": "opened",
+		"issue": map[string]interface{}{
+			"number": float64(42),
+			"title":  "it: broke",
+			"labels": []interface{}{"bug"},
+		},
+		"sender": map[string]interface{}{
+			"login": "mattmoor",
+		},
+	}
+
+	tests := []struct {
+		name string
+		ops  []PatchOperation
+		opts []Option
+		ctx  *cloudevents.EventContext
+		want string
+	}{{
+		name: "add and remove",
+		ops: []PatchOperation{{
+			Op:    "add",
+			Path:  "/triaged",
+			Value: []byte(`true`),
+		}, {
+			Op:   "remove",
+			Path: "/sender",
+		}, {
+			Op:   "remove",
+			Path: "/action",
+		}},
+		want: `{"issue":{"labels":["bug"],"number":42,"title":"it: broke"},"triaged":true}`,
+	}, {
+		name: "replace, move, copy and test",
+		ops: []PatchOperation{{
+			Op:    "test",
+			Path:  "/action",
+			Value: []byte(`"opened"`),
+		}, {
+			Op:    "replace",
+			Path:  "/action",
+			Value: []byte(`"triage"`),
+		}, {
+			Op:   "move",
+			From: "/sender/login",
+			Path: "/author",
+		}, {
+			Op:   "copy",
+			From: "/issue/number",
+			Path: "/id",
+		}, {
+			Op:   "remove",
+			Path: "/issue",
+		}, {
+			Op:   "remove",
+			Path: "/sender",
+		}},
+		want: `{"action":"triage","author":"mattmoor","id":42}`,
+	}, {
+		name: "null values",
+		ops: []PatchOperation{{
+			Op:    "replace",
+			Path:  "/sender",
+			Value: []byte(`null`),
+		}, {
+			Op:    "test",
+			Path:  "/sender",
+			Value: []byte(`null`),
+		}, {
+			Op:    "add",
+			Path:  "/assignee",
+			Value: []byte(`null`),
+		}, {
+			Op:   "remove",
+			Path: "/issue",
+		}},
+		want: `{"action":"opened","assignee":null,"sender":null}`,
+	}, {
+		name: "templated values",
+		ops: []PatchOperation{{
+			Op:    "add",
+			Path:  "/issue/labels/-",
+			Value: []byte(`"{{ .sender.login | upper }}"`),
+		}, {
+			Op:    "add",
+			Path:  "/summary",
+			Value: []byte(`{"text": "#{{ .issue.number }}: {{ .issue.title }}", "number": "{{ .issue.number }}", "labels": "{{ .issue.labels }}", "fixed": "as is"}`),
+		}, {
+			Op:   "remove",
+			Path: "/sender",
+		}},
+		want: `{"action":"opened","issue":{"labels":["bug","MATTMOOR"],"number":42,"title":"it: broke"},"summary":{"fixed":"as is","labels":["bug"],"number":42,"text":"#42: it: broke"}}`,
+	}, {
+		name: "event data model",
+		ops: []PatchOperation{{
+			Op:    "replace",
+			Path:  "/action",
+			Value: []byte(`"{{ .ce.type }}/{{ .data.action }}"`),
+		}, {
+			Op:   "remove",
+			Path: "/issue",
+		}, {
+			Op:   "remove",
+			Path: "/sender",
+		}},
+		opts: []Option{WithDataModel(Event)},
+		ctx: &cloudevents.EventContext{
+			EventType: "issues",
+		},
+		want: `{"action":"issues/opened"}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := CompilePatch(test.ops, test.opts...)
+			if err != nil {
+				t.Fatalf("CompilePatch() = %v", err)
+			}
+			got, err := m.Mutate(test.ctx, input)
+			if err != nil {
+				t.Fatalf("m.Mutate() = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("m.Mutate() = %v, wanted %v", string(got), test.want)
+			}
+		})
+	}
+}
+
+func TestPatchErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []PatchOperation
+	}{{
+		name: "no operations",
+	}, {
+		name: "unsupported op",
+		ops: []PatchOperation{{
+			Op:   "frobnicate",
+			Path: "/foo",
+		}},
+	}, {
+		name: "add without value",
+		ops: []PatchOperation{{
+			Op:   "add",
+			Path: "/foo",
+		}},
+	}, {
+		name: "move without from",
+		ops: []PatchOperation{{
+			Op:   "move",
+			Path: "/foo",
+		}},
+	}, {
+		name: "invalid value",
+		ops: []PatchOperation{{
+			Op:    "add",
+			Path:  "/foo",
+			Value: []byte(`{not json`),
+		}},
+	}, {
+		name: "invalid template",
+		ops: []PatchOperation{{
+			Op:    "add",
+			Path:  "/foo",
+			Value: []byte(`"{{ .foo"`),
+		}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if m, err := CompilePatch(test.ops); err == nil {
+				t.Errorf("CompilePatch() = %v, wanted error", m)
+			}
+		})
+	}
+
+	// Failing tests and missing paths fail at runtime.
+	for _, op := range []PatchOperation{{
+		Op:    "test",
+		Path:  "/action",
+		Value: []byte(`"closed"`),
+	}, {
+		Op:   "remove",
+		Path: "/nope",
+	}} {
+		m, err := CompilePatch([]PatchOperation{op})
+		if err != nil {
+			t.Fatalf("CompilePatch() = %v", err)
+		}
+		if got, err := m.Mutate(nil, map[string]interface{}{"action": "opened"}); err == nil {
+			t.Errorf("m.Mutate() = %s, wanted error", got)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	input := map[string]interface{}{
+		"action": "opened",
+		"issue": map[string]interface{}{
+			"number": float64(42),
+			"title":  "it: broke",
+		},
+		"sender": map[string]interface{}{
+			"login": "mattmoor",
+		},
+	}
+
+	tests := []struct {
+		name  string
+		patch string
+		opts  []Option
+		ctx   *cloudevents.EventContext
+		want  string
+	}{{
+		name:  "add, replace and remove",
+		patch: `{"triaged": true, "issue": {"title": "fixed"}, "sender": null}`,
+		want:  `{"action":"opened","issue":{"number":42,"title":"fixed"},"triaged":true}`,
+	}, {
+		name:  "templated values",
+		patch: `{"issue": {"id": "{{ .issue.number }}", "title": "{{ .issue.title | upper }}"}, "sender": null}`,
+		want:  `{"action":"opened","issue":{"id":42,"number":42,"title":"IT: BROKE"}}`,
+	}, {
+		name:  "event data model",
+		patch: `{"type": "{{ .ce.type }}", "issue": null, "sender": null}`,
+		opts:  []Option{WithDataModel(Event)},
+		ctx: &cloudevents.EventContext{
+			EventType: "issues",
+		},
+		want: `{"action":"opened","type":"issues"}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := CompileMergePatch([]byte(test.patch), test.opts...)
+			if err != nil {
+				t.Fatalf("CompileMergePatch() = %v", err)
+			}
+			got, err := m.Mutate(test.ctx, input)
+			if err != nil {
+				t.Fatalf("m.Mutate() = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("m.Mutate() = %v, wanted %v", string(got), test.want)
+			}
+		})
+	}
+}
+
+func TestMergePatchErrors(t *testing.T) {
+	for _, patch := range []string{``, `{not json`, `{"foo": "{{ .foo"}`} {
+		if m, err := CompileMergePatch([]byte(patch)); err == nil {
+			t.Errorf("CompileMergePatch(%q) = %v, wanted error", patch, m)
+		}
+	}
+}
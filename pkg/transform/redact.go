@@ -0,0 +1,174 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/fieldpath"
+)
+
+// DefaultMask is what masked text is replaced with when a MaskRule has no
+// Replacement.
+const DefaultMask = "[REDACTED]"
+
+// Redaction describes how to strip sensitive values from an event body.
+// Paths are dot-separated, and the element "*" matches every key of an
+// object or element of an array (e.g. "commits.*.author.email").
+type Redaction struct {
+	// Remove lists the paths of values to remove.
+	Remove []string `json:"remove,omitempty"`
+
+	// Mask lists regular expressions to mask within string values.
+	Mask []MaskRule `json:"mask,omitempty"`
+
+	// Hash lists the paths of values to replace with their (salted) hash.
+	Hash []string `json:"hash,omitempty"`
+}
+
+// MaskRule replaces the text matching Pattern with Replacement (which may
+// refer to submatches, e.g. "$1").  When Paths is empty, every string in
+// the body is masked; otherwise only the strings at (or within) Paths.
+type MaskRule struct {
+	Pattern     string   `json:"pattern"`
+	Replacement string   `json:"replacement,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+}
+
+// Redactor strips sensitive values from event bodies.  As a Mutator, it
+// returns the redacted body (regardless of the data model).
+type Redactor interface {
+	Mutator
+
+	// Redact returns a redacted copy of the given decoded body.
+	Redact(body interface{}) interface{}
+}
+
+// CompileRedaction compiles the given redaction into a Redactor.  Values are
+// removed first, then hashed, then masked.  Hashes are the hex encoded
+// HMAC-SHA256 of the value (strings as they are, other values as JSON)
+// keyed by the salt, so that equal values can still be correlated without
+// revealing them.
+func CompileRedaction(r Redaction, salt []byte) (Redactor, error) {
+	if len(r.Remove) == 0 && len(r.Mask) == 0 && len(r.Hash) == 0 {
+		return nil, errors.New("redaction has no rules")
+	}
+	rd := &redactor{
+		remove: r.Remove,
+		hash:   r.Hash,
+		salt:   salt,
+		masks:  make([]mask, 0, len(r.Mask)),
+	}
+	for i, m := range r.Mask {
+		re, err := regexp.Compile(m.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("mask rule %d: %v", i, err)
+		}
+		replacement := m.Replacement
+		if replacement == "" {
+			replacement = DefaultMask
+		}
+		paths := m.Paths
+		if len(paths) == 0 {
+			paths = []string{""}
+		}
+		rd.masks = append(rd.masks, mask{re: re, replacement: replacement, paths: paths})
+	}
+	return rd, nil
+}
+
+type mask struct {
+	re          *regexp.Regexp
+	replacement string
+	paths       []string
+}
+
+type redactor struct {
+	remove []string
+	hash   []string
+	salt   []byte
+	masks  []mask
+}
+
+// redactor implements Redactor
+var _ Redactor = (*redactor)(nil)
+
+func (r *redactor) Mutate(ctx *cloudevents.EventContext, body interface{}) ([]byte, error) {
+	return json.Marshal(r.Redact(body))
+}
+
+func (r *redactor) Redact(body interface{}) interface{} {
+	result := fieldpath.Copy(body)
+	for _, path := range r.remove {
+		result = fieldpath.Update(result, path, func(interface{}) (interface{}, bool) {
+			return nil, false
+		})
+	}
+	for _, path := range r.hash {
+		result = fieldpath.Update(result, path, func(v interface{}) (interface{}, bool) {
+			return r.hashOf(v), true
+		})
+	}
+	for _, m := range r.masks {
+		for _, path := range m.paths {
+			result = fieldpath.Update(result, path, func(v interface{}) (interface{}, bool) {
+				return m.apply(v), true
+			})
+		}
+	}
+	return result
+}
+
+func (r *redactor) hashOf(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		// Values decoded from JSON can always be encoded again.
+		b, _ := json.Marshal(v)
+		s = string(b)
+	}
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// apply masks every string within v.
+func (m *mask) apply(v interface{}) interface{} {
+	switch o := v.(type) {
+	case string:
+		return m.re.ReplaceAllString(o, m.replacement)
+	case map[string]interface{}:
+		for k, e := range o {
+			o[k] = m.apply(e)
+		}
+		return o
+	case []interface{}:
+		for i, e := range o {
+			o[i] = m.apply(e)
+		}
+		return o
+	default:
+		return v
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestRedaction(t *testing.T) {
+	newInput := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sender": map[string]interface{}{
+				"login": "octocat",
+				"id":    float64(42),
+				"email": "octocat@github.com",
+			},
+			"commits": []interface{}{
+				map[string]interface{}{
+					"id":      "abc",
+					"message": "Fix the thing (reported by bob@acme.com from 10.0.0.1)",
+					"author":  map[string]interface{}{"name": "Bob", "email": "bob@acme.com"},
+				},
+				map[string]interface{}{
+					"id":      "def",
+					"message": "Rotate token ghp_0123456789abcdef",
+					"author":  map[string]interface{}{"name": "Alice", "email": "alice@acme.com"},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		redaction Redaction
+		salt      string
+		want      string
+	}{{
+		name: "remove",
+		redaction: Redaction{
+			Remove: []string{"sender.email", "commits.*.author", "commits.1"},
+		},
+		want: `{"commits":[{"id":"abc","message":"Fix the thing (reported by bob@acme.com from 10.0.0.1)"}],"sender":{"id":42,"login":"octocat"}}`,
+	}, {
+		name: "mask everywhere",
+		redaction: Redaction{
+			Remove: []string{"commits"},
+			Mask: []MaskRule{{
+				Pattern: `[a-z]+@[a-z.]+`,
+			}},
+		},
+		want: `{"sender":{"email":"[REDACTED]","id":42,"login":"octocat"}}`,
+	}, {
+		name: "mask paths with replacements",
+		redaction: Redaction{
+			Remove: []string{"sender", "commits.*.author"},
+			Mask: []MaskRule{{
+				Pattern:     `([a-z]+)@[a-z.]+`,
+				Replacement: "$1@…",
+				Paths:       []string{"commits.*.message"},
+			}, {
+				Pattern:     `\b\d{1,3}(\.\d{1,3}){3}\b`,
+				Replacement: "x.x.x.x",
+			}, {
+				Pattern: `ghp_[0-9a-f]+`,
+				Paths:   []string{"commits"},
+			}},
+		},
+		want: `{"commits":[{"id":"abc","message":"Fix the thing (reported by bob@… from x.x.x.x)"},{"id":"def","message":"Rotate token [REDACTED]"}]}`,
+	}, {
+		name: "hash with salt",
+		redaction: Redaction{
+			Remove: []string{"sender.email", "commits"},
+			Hash:   []string{"sender.login", "sender.id"},
+		},
+		salt: "pepper",
+		want: `{"sender":{"id":"05072a49e7c724c2ac3638d3a54eb8848d39fb952094ee45037176152e15d416","login":"0cbf5a0d338cc7129712cd841a293ce51b658c69d214f2afd80261cb63d11dd1"}}`,
+	}, {
+		name: "hash without salt",
+		redaction: Redaction{
+			Remove: []string{"sender.email", "sender.id", "commits"},
+			Hash:   []string{"sender.login"},
+		},
+		want: `{"sender":{"login":"bc8f48719b808d216e0d1a6d2f45ce52939db39ce3b673b1f8d1c8e6817a92e7"}}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := CompileRedaction(test.redaction, []byte(test.salt))
+			if err != nil {
+				t.Fatalf("CompileRedaction() = %v", err)
+			}
+			input := newInput()
+			got, err := r.Mutate(&cloudevents.EventContext{}, input)
+			if err != nil {
+				t.Fatalf("Mutate() = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("Mutate() = %s, wanted %s", got, test.want)
+			}
+			// The input must be left untouched.
+			if email := input["sender"].(map[string]interface{})["email"]; email != "octocat@github.com" {
+				t.Errorf("Mutate() modified its input: %v", input)
+			}
+		})
+	}
+}
+
+func TestRedactionErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		redaction Redaction
+	}{{
+		name: "no rules",
+	}, {
+		name: "bad pattern",
+		redaction: Redaction{
+			Mask: []MaskRule{{Pattern: `(`}},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := CompileRedaction(test.redaction, nil); err == nil {
+				t.Error("CompileRedaction() = nil, wanted error")
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/aggregate"
+)
+
+// Reducer reduces the events of a window to the body of a single event.
+type Reducer interface {
+	// Reduce returns the body of the event with the given context that
+	// summarizes the given window.  As with Mutate, an empty (or null)
+	// result means no event should be emitted.
+	Reduce(ctx *cloudevents.EventContext, r aggregate.Result) ([]byte, error)
+}
+
+// CompileReducer compiles a Reducer, which executes the template for each
+// window against an object with the window's group under "group", its
+// bounds under "start" and "end" (as RFC 3339 timestamps), its decoded
+// events under "events" and their number under "count" (e.g.
+// {{ .count }} or {{ range .events }}...{{ end }}).  Of the options, the
+// data model is ignored.
+func CompileReducer(tmpl string, opts ...Option) (Reducer, error) {
+	if tmpl == "" {
+		return nil, fmt.Errorf("aggregation requires a template")
+	}
+	m, err := Compile(tmpl, append(opts, WithDataModel(Body))...)
+	if err != nil {
+		return nil, err
+	}
+	return &reducer{m: m}, nil
+}
+
+type reducer struct {
+	m Mutator
+}
+
+// reducer implements Reducer
+var _ Reducer = (*reducer)(nil)
+
+func (r *reducer) Reduce(ctx *cloudevents.EventContext, res aggregate.Result) ([]byte, error) {
+	events := res.Events
+	if events == nil {
+		events = []interface{}{}
+	}
+	return r.m.Mutate(ctx, map[string]interface{}{
+		"group":  res.Group,
+		"start":  res.Start.UTC().Format(time.RFC3339Nano),
+		"end":    res.End.UTC().Format(time.RFC3339Nano),
+		"count":  len(events),
+		"events": events,
+	})
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/aggregate"
+)
+
+func TestReduce(t *testing.T) {
+	start := time.Date(2019, time.January, 1, 12, 0, 0, 0, time.UTC)
+	window := aggregate.Result{
+		Window: aggregate.Window{
+			Group: "kfilter",
+			Start: start,
+			End:   start.Add(time.Minute),
+		},
+		Events: []interface{}{
+			map[string]interface{}{"conclusion": "success"},
+			map[string]interface{}{"conclusion": "failure"},
+			map[string]interface{}{"conclusion": "success"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		opts     []Option
+		want     string
+	}{{
+		name: "summary",
+		template: `repo: {{ .group }}
+runs: {{ .count }}
+from: {{ .start }}
+to: {{ .end }}`,
+		want: `{"from":"2019-01-01T12:00:00Z","repo":"kfilter","runs":3,"to":"2019-01-01T12:01:00Z"}`,
+	}, {
+		name: "over the events",
+		template: `failures:
+{{ range .events }}{{ if eq .conclusion "failure" }}- {{ .conclusion }}
+{{ end }}{{ end }}`,
+		want: `{"failures":["failure"]}`,
+	}, {
+		name:     "data model is ignored",
+		template: `runs: {{ .count }}`,
+		opts:     []Option{WithDataModel(Event)},
+		want:     `{"runs":3}`,
+	}, {
+		name:     "filtered",
+		template: `{{ if gt .count 5 }}runs: {{ .count }}{{ end }}`,
+		want:     `null`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := CompileReducer(test.template, test.opts...)
+			if err != nil {
+				t.Fatalf("CompileReducer() = %v", err)
+			}
+			got, err := r.Reduce(&cloudevents.EventContext{}, window)
+			if err != nil {
+				t.Fatalf("Reduce() = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("Reduce() = %s, wanted %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileReducerErrors(t *testing.T) {
+	for _, tmpl := range []string{"", "{{ .count"} {
+		if _, err := CompileReducer(tmpl); err == nil {
+			t.Errorf("CompileReducer(%q) = nil, wanted error", tmpl)
+		}
+	}
+}
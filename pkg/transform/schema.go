@@ -0,0 +1,175 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonreference"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Schema is a compiled JSON Schema, against which the results of
+// transforms may be validated.  Schemas follow draft 7 unless their
+// $schema says otherwise (draft 4 and 6 are also supported), and may $ref
+// their own definitions, but not other documents.
+type Schema struct {
+	s *gojsonschema.Schema
+}
+
+// CompileSchema compiles the given JSON Schema.
+func CompileSchema(schema json.RawMessage) (*Schema, error) {
+	s, err := compileSchema(schema, false)
+	if err != nil {
+		return nil, err
+	}
+	// Validating the schema against its meta-schema makes gojsonschema
+	// resolve references with its default loader, so this only happens
+	// once the schema is known not to refer to other documents.
+	if _, err := compileSchema(schema, true); err != nil {
+		return nil, err
+	}
+	return &Schema{s: s}, nil
+}
+
+func compileSchema(schema json.RawMessage, validate bool) (*gojsonschema.Schema, error) {
+	sl := gojsonschema.NewSchemaLoader()
+	sl.Draft = gojsonschema.Draft7
+	sl.AutoDetect = true
+	sl.Validate = validate
+	s, err := sl.Compile(localLoader{gojsonschema.NewBytesLoader(schema)})
+	if err != nil {
+		// Violations of the meta-schema are listed a line each.
+		lines := strings.Split(strings.TrimSpace(err.Error()), "\n")
+		return nil, fmt.Errorf("invalid schema: %s", strings.Join(lines, "; "))
+	}
+	return s, nil
+}
+
+// localLoader loads a schema without loading the documents (e.g. URLs or
+// files) that it refers to, which would let a Transform make the
+// controller and data plane fetch them.
+type localLoader struct {
+	gojsonschema.JSONLoader
+}
+
+func (localLoader) LoaderFactory() gojsonschema.JSONLoaderFactory {
+	return localLoader{}
+}
+
+func (localLoader) New(source string) gojsonschema.JSONLoader {
+	return externalLoader(source)
+}
+
+// externalLoader refuses to load the document that a schema refers to.
+type externalLoader string
+
+func (l externalLoader) JsonSource() interface{} {
+	return string(l)
+}
+
+func (l externalLoader) LoadJSON() (interface{}, error) {
+	return nil, fmt.Errorf("references to other documents are not supported: %q", string(l))
+}
+
+func (l externalLoader) JsonReference() (gojsonreference.JsonReference, error) {
+	return gojsonreference.NewJsonReference(string(l))
+}
+
+func (l externalLoader) LoaderFactory() gojsonschema.JSONLoaderFactory {
+	return localLoader{}
+}
+
+// keywords maps the types of gojsonschema's errors to the schema keywords
+// that they violate (where they differ).
+var keywords = map[string]string{
+	"false":                           "false",
+	"invalid_type":                    "type",
+	"number_any_of":                   "anyOf",
+	"number_one_of":                   "oneOf",
+	"number_all_of":                   "allOf",
+	"number_not":                      "not",
+	"missing_dependency":              "dependencies",
+	"array_no_additional_items":       "additionalItems",
+	"array_min_items":                 "minItems",
+	"array_max_items":                 "maxItems",
+	"unique":                          "uniqueItems",
+	"array_min_properties":            "minProperties",
+	"array_max_properties":            "maxProperties",
+	"additional_property_not_allowed": "additionalProperties",
+	"invalid_property_pattern":        "patternProperties",
+	"invalid_property_name":           "propertyNames",
+	"string_gte":                      "minLength",
+	"string_lte":                      "maxLength",
+	"multiple_of":                     "multipleOf",
+	"number_gte":                      "minimum",
+	"number_gt":                       "exclusiveMinimum",
+	"number_lte":                      "maximum",
+	"number_lt":                       "exclusiveMaximum",
+	"condition_then":                  "then",
+	"condition_else":                  "else",
+}
+
+// SchemaError is returned when the result of a transform violates its
+// schema.
+type SchemaError struct {
+	// Path is the JSON Pointer to the offending value within the result.
+	Path string
+
+	// Keyword is the schema keyword that the value violates.
+	Keyword string
+
+	// Reason describes the violation.
+	Reason string
+}
+
+func (e *SchemaError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("output violates its schema: %s", e.Reason)
+	}
+	return fmt.Sprintf("output violates its schema at %q: %s", e.Path, e.Reason)
+}
+
+// Validate checks that the given JSON result conforms to the schema,
+// returning a *SchemaError describing the first violation it finds.
+func (s *Schema) Validate(result []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(result, &v); err != nil {
+		return &SchemaError{Keyword: "type", Reason: fmt.Sprintf("output is not JSON: %v", err)}
+	}
+	r, err := s.s.Validate(gojsonschema.NewGoLoader(v))
+	if err != nil {
+		return err
+	}
+	if r.Valid() {
+		return nil
+	}
+	e := r.Errors()[0]
+	keyword, ok := keywords[e.Type()]
+	if !ok {
+		keyword = e.Type()
+	}
+	return &SchemaError{
+		// The context is e.g. (root)/labels/1, which we report as the
+		// JSON Pointer /labels/1.
+		Path:    strings.TrimPrefix(e.Context().String("/"), gojsonschema.STRING_CONTEXT_ROOT),
+		Keyword: keyword,
+		Reason:  e.Description(),
+	}
+}
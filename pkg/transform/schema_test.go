@@ -0,0 +1,266 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	schema := `{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "issue",
+		"type": "object",
+		"required": ["id", "labels"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"title": {"type": "string", "minLength": 1, "maxLength": 10},
+			"labels": {
+				"type": "array",
+				"items": {"type": "string", "pattern": "^[a-z0-9]+$"},
+				"uniqueItems": true,
+				"maxItems": 3
+			},
+			"state": {"enum": ["open", "closed"]},
+			"score": {"type": ["number", "null"], "exclusiveMaximum": 1, "multipleOf": 0.25},
+			"kind": {"const": "issue"},
+			"assignee": {
+				"oneOf": [
+					{"type": "null"},
+					{"type": "object", "required": ["login"]}
+				]
+			}
+		},
+		"patternProperties": {
+			"^x-": {"type": "string"}
+		},
+		"additionalProperties": false
+	}`
+
+	tests := []struct {
+		name    string
+		result  string
+		path    string
+		keyword string
+		want    string
+	}{{
+		name:   "valid",
+		result: `{"id": 42, "title": "Crash", "labels": ["bug", "p0"], "state": "open", "score": 0.5, "kind": "issue", "assignee": null, "x-team": "eventing"}`,
+	}, {
+		name:    "not an object",
+		result:  `[42]`,
+		keyword: "type",
+		want:    "output violates its schema: Invalid type. Expected: object, given: array",
+	}, {
+		name:    "not JSON",
+		result:  `id: 42`,
+		keyword: "type",
+		want:    "output violates its schema: output is not JSON: invalid character 'i' looking for beginning of value",
+	}, {
+		name:    "missing property",
+		result:  `{"id": 42}`,
+		keyword: "required",
+		want:    "output violates its schema: labels is required",
+	}, {
+		name:    "wrong type",
+		result:  `{"id": "42", "labels": []}`,
+		path:    "/id",
+		keyword: "type",
+		want:    `output violates its schema at "/id": Invalid type. Expected: integer, given: string`,
+	}, {
+		name:    "not an integer",
+		result:  `{"id": 4.2, "labels": []}`,
+		path:    "/id",
+		keyword: "type",
+		want:    `output violates its schema at "/id": Invalid type. Expected: integer, given: number`,
+	}, {
+		name:    "too small",
+		result:  `{"id": 0, "labels": []}`,
+		path:    "/id",
+		keyword: "minimum",
+	}, {
+		name:    "too long",
+		result:  `{"id": 42, "title": "Crash on startup", "labels": []}`,
+		path:    "/title",
+		keyword: "maxLength",
+	}, {
+		name:    "bad item",
+		result:  `{"id": 42, "labels": ["bug", "P0"]}`,
+		path:    "/labels/1",
+		keyword: "pattern",
+		want:    `output violates its schema at "/labels/1": Does not match pattern '^[a-z0-9]+$'`,
+	}, {
+		name:    "duplicate items",
+		result:  `{"id": 42, "labels": ["bug", "bug"]}`,
+		path:    "/labels",
+		keyword: "uniqueItems",
+	}, {
+		name:    "too many items",
+		result:  `{"id": 42, "labels": ["a", "b", "c", "d"]}`,
+		path:    "/labels",
+		keyword: "maxItems",
+	}, {
+		name:    "not in enum",
+		result:  `{"id": 42, "labels": [], "state": "merged"}`,
+		path:    "/state",
+		keyword: "enum",
+		want:    `output violates its schema at "/state": state must be one of the following: "open", "closed"`,
+	}, {
+		name:    "exclusive maximum",
+		result:  `{"id": 42, "labels": [], "score": 1}`,
+		path:    "/score",
+		keyword: "exclusiveMaximum",
+	}, {
+		name:    "not a multiple",
+		result:  `{"id": 42, "labels": [], "score": 0.3}`,
+		path:    "/score",
+		keyword: "multipleOf",
+	}, {
+		name:    "not the constant",
+		result:  `{"id": 42, "labels": [], "kind": "pull"}`,
+		path:    "/kind",
+		keyword: "const",
+	}, {
+		name:    "one of",
+		result:  `{"id": 42, "labels": [], "assignee": {"name": "Matt"}}`,
+		path:    "/assignee",
+		keyword: "oneOf",
+	}, {
+		name:    "pattern property",
+		result:  `{"id": 42, "labels": [], "x-team": 1}`,
+		path:    "/x-team",
+		keyword: "type",
+	}, {
+		name:    "additional property",
+		result:  `{"id": 42, "labels": [], "body": "..."}`,
+		keyword: "additionalProperties",
+		want:    "output violates its schema: Additional property body is not allowed",
+	}}
+
+	s, err := CompileSchema([]byte(schema))
+	if err != nil {
+		t.Fatalf("CompileSchema() = %v", err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := s.Validate([]byte(test.result))
+			if test.keyword == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			se, ok := err.(*SchemaError)
+			if !ok {
+				t.Fatalf("Validate() = %v, wanted a *SchemaError", err)
+			}
+			if se.Path != test.path || se.Keyword != test.keyword {
+				t.Errorf("Validate() = %#v, wanted path %q and keyword %q", se, test.path, test.keyword)
+			}
+			if test.want != "" && se.Error() != test.want {
+				t.Errorf("Validate() = %q, wanted %q", se.Error(), test.want)
+			}
+		})
+	}
+}
+
+func TestSchemaCombinators(t *testing.T) {
+	s, err := CompileSchema([]byte(`{
+		"allOf": [{"type": "object"}, {"maxProperties": 2}],
+		"anyOf": [{"required": ["id"]}, {"required": ["name"]}],
+		"not": {"required": ["secret"]},
+		"propertyNames": {"maxLength": 6},
+		"additionalProperties": {"type": ["string", "integer"]}
+	}`))
+	if err != nil {
+		t.Fatalf("CompileSchema() = %v", err)
+	}
+	for result, want := range map[string]string{
+		`{"id": 1}`:                     "",
+		`{"name": "kf"}`:                "",
+		`[]`:                            "type",
+		`{"id": 1, "a": "b", "c": "d"}`: "maxProperties",
+		`{"type": "x"}`:                 "anyOf",
+		`{"id": 1, "secret": "x"}`:      "not",
+		`{"id": 1, "assignee": 1}`:      "propertyNames",
+		`{"id": 1.5}`:                   "type",
+		`{"name": true, "id": "1"}`:     "type",
+	} {
+		err := s.Validate([]byte(result))
+		switch se, _ := err.(*SchemaError); {
+		case want == "" && err != nil:
+			t.Errorf("Validate(%s) = %v", result, err)
+		case want != "" && se == nil:
+			t.Errorf("Validate(%s) = %v, wanted a violation of %s", result, err, want)
+		case want != "" && se.Keyword != want:
+			t.Errorf("Validate(%s) = %v, wanted a violation of %s", result, err, want)
+		}
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	for schema, want := range map[string]string{
+		`[]`:                                   "invalid schema: schema is invalid",
+		`{"$ref": "#/definitions/issue"}`:      "invalid schema: Object has no key 'definitions'",
+		`{"$ref": "http://example.com/issue"}`: `invalid schema: references to other documents are not supported: "http://example.com/issue"`,
+		`{"$ref": "/etc/passwd"}`:              "invalid schema: Reference /etc/passwd must be canonical",
+		`{"type": "thing"}`:                    "invalid schema: has a primitive type that is NOT VALID -- given: /thing/ Expected valid values are:[array boolean integer number null object string]",
+		`{"pattern": "("}`:                     "invalid schema: pattern must be a valid regex",
+		`{"multipleOf": 0}`:                    "invalid schema: multipleOf must be strictly greater than 0",
+		`{"minItems": -1}`:                     "invalid schema: minItems must be greater than or equal to 0",
+		`{"anyOf": []}`:                        "invalid schema: anyOf: Array must have at least 1 items",
+		`{"additionalProperties": {"not": 1}}`: "invalid schema: not must be of an object",
+	} {
+		if _, err := CompileSchema([]byte(schema)); err == nil || err.Error() != want {
+			t.Errorf("CompileSchema(%s) = %v, wanted %q", schema, err, want)
+		}
+	}
+}
+
+func TestSchemaReferences(t *testing.T) {
+	s, err := CompileSchema([]byte(`{
+		"definitions": {
+			"user": {"type": "object", "required": ["login"]}
+		},
+		"type": "object",
+		"properties": {
+			"sender": {"$ref": "#/definitions/user"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("CompileSchema() = %v", err)
+	}
+	if err := s.Validate([]byte(`{"sender": {"login": "mattmoor"}}`)); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	err = s.Validate([]byte(`{"sender": {}}`))
+	if se, ok := err.(*SchemaError); !ok || se.Path != "/sender" || se.Keyword != "required" {
+		t.Errorf("Validate() = %#v, wanted a violation of required at /sender", err)
+	}
+}
+
+func TestBooleanSchemas(t *testing.T) {
+	for schema, valid := range map[string]bool{`true`: true, `false`: false, `{}`: true} {
+		s, err := CompileSchema([]byte(schema))
+		if err != nil {
+			t.Fatalf("CompileSchema(%s) = %v", schema, err)
+		}
+		if err := s.Validate([]byte(`{"id": 42}`)); (err == nil) != valid {
+			t.Errorf("Validate() with %s = %v, wanted valid: %v", schema, err, valid)
+		}
+	}
+}
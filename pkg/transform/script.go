@@ -0,0 +1,258 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// scriptFunc is the function that scripts must define.
+const scriptFunc = "transform"
+
+// maxNesting bounds how deeply the values that scripts return may nest,
+// since Starlark lists and dicts may contain themselves.
+const maxNesting = 1000
+
+// CompileScript compiles the given Starlark script into a Mutator.  The
+// script must define a function transform(event), which is called with
+// the event (according to the data model, so typically a dict), and whose
+// result becomes the new body.  Returning None filters the event.  Of the
+// options, only the data model and limits are relevant.
+//
+// Whole numbers in the event are ints, and other numbers floats.  Scripts
+// cannot load modules, and the top level of the script runs once, when it
+// is compiled, after which its globals are frozen.
+func CompileScript(script string, opts ...Option) (Mutator, error) {
+	o := &options{model: Body}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	s := &starlarkScript{model: o.model, limits: o.limits}
+	var globals starlark.StringDict
+	err := s.run(func(thread *starlark.Thread) (err error) {
+		globals, err = starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "script", script, nil)
+		return err
+	})
+	if err != nil {
+		if _, ok := err.(*LimitError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid script: %v", err)
+	}
+	fn, ok := globals[scriptFunc].(*starlark.Function)
+	if !ok || fn.NumParams() != 1 {
+		return nil, fmt.Errorf("invalid script: it must define a function %s(event)", scriptFunc)
+	}
+	s.fn = fn
+	return s, nil
+}
+
+type starlarkScript struct {
+	model  DataModel
+	fn     *starlark.Function
+	limits Limits
+}
+
+// starlarkScript implements Mutator
+var _ Mutator = (*starlarkScript)(nil)
+
+func (s *starlarkScript) Mutate(ctx *cloudevents.EventContext, body interface{}) ([]byte, error) {
+	event, err := toStarlark(Input(s.model, ctx, body))
+	if err != nil {
+		return nil, err
+	}
+	var result starlark.Value
+	err = s.run(func(thread *starlark.Thread) (err error) {
+		result, err = starlark.Call(thread, s.fn, starlark.Tuple{event}, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	v, err := fromStarlark(result, 0)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return s.limits.checkOutput(b)
+}
+
+// run runs f in a new thread, which cannot print or load modules, subject
+// to the timeout and step limits.
+func (s *starlarkScript) run(f func(*starlark.Thread) error) error {
+	thread := &starlark.Thread{
+		Name:  "transform",
+		Print: func(*starlark.Thread, string) {},
+	}
+	if s.limits.MaxSteps != 0 {
+		thread.SetMaxExecutionSteps(uint64(s.limits.MaxSteps))
+	}
+	timedOut := make(chan struct{})
+	if s.limits.Timeout != 0 {
+		timer := time.AfterFunc(s.limits.Timeout, func() {
+			close(timedOut)
+			thread.Cancel(string(TimeoutLimit))
+		})
+		defer timer.Stop()
+	}
+
+	err := f(thread)
+	if err == nil {
+		return nil
+	}
+	select {
+	case <-timedOut:
+		return &LimitError{Limit: TimeoutLimit}
+	default:
+	}
+	if s.limits.MaxSteps != 0 && thread.ExecutionSteps() >= uint64(s.limits.MaxSteps) {
+		return &LimitError{Limit: StepLimit}
+	}
+	return err
+}
+
+// toStarlark converts a decoded JSON value into its Starlark equivalent.
+func toStarlark(v interface{}) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return starlark.MakeInt64(int64(v)), nil
+		}
+		return starlark.Float(v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Float(f), nil
+	case []interface{}:
+		elems := make([]starlark.Value, 0, len(v))
+		for _, e := range v {
+			sv, err := toStarlark(e)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, sv)
+		}
+		return starlark.NewList(elems), nil
+	case map[string]interface{}:
+		// Insert the keys in order, so that scripts iterate over them
+		// deterministically.
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := starlark.NewDict(len(v))
+		for _, k := range keys {
+			sv, err := toStarlark(v[k])
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(starlark.String(k), sv); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	default:
+		// Anything else (e.g. extensions) is converted via its JSON form.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			return nil, err
+		}
+		return toStarlark(decoded)
+	}
+}
+
+// fromStarlark converts the value a script returned into its JSON
+// equivalent.
+func fromStarlark(v starlark.Value, depth int) (interface{}, error) {
+	if depth > maxNesting {
+		return nil, fmt.Errorf("script returned a value nested more than %d deep", maxNesting)
+	}
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return i, nil
+		}
+		return json.Number(v.String()), nil
+	case starlark.Float:
+		f := float64(v)
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("script returned %v, which isn't valid JSON", v)
+		}
+		return f, nil
+	case *starlark.List, starlark.Tuple:
+		seq := v.(starlark.Indexable)
+		result := make([]interface{}, 0, seq.Len())
+		for i := 0; i < seq.Len(); i++ {
+			e, err := fromStarlark(seq.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, e)
+		}
+		return result, nil
+	case *starlark.Dict:
+		result := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			k, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("script returned a dict with the non-string key %v", item[0])
+			}
+			e, err := fromStarlark(item[1], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result[string(k)] = e
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("script returned a %s, which isn't valid JSON", v.Type())
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestScript(t *testing.T) {
+	input := map[string]interface{}{
+		"action": "opened",
+		"issue": map[string]interface{}{
+			"number": float64(42),
+			"score":  0.5,
+			"labels": []interface{}{
+				map[string]interface{}{"name": "bug"},
+				map[string]interface{}{"name": "p0"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		opts   []Option
+		ctx    *cloudevents.EventContext
+		want   string
+	}{{
+		name: "identity",
+		script: `
+def transform(event):
+  return event
+`,
+		want: `{"action":"opened","issue":{"labels":[{"name":"bug"},{"name":"p0"}],"number":42,"score":0.5}}`,
+	}, {
+		name: "reshape",
+		script: `
+URGENT = ["p0", "p1"]
+
+def transform(event):
+  labels = [l["name"] for l in event["issue"]["labels"]]
+  return {
+    "id": event["issue"]["number"],
+    "labels": labels,
+    "urgent": any([l in URGENT for l in labels]),
+  }
+`,
+		want: `{"id":42,"labels":["bug","p0"],"urgent":true}`,
+	}, {
+		name: "mutate",
+		script: `
+def transform(event):
+  event.pop("issue")
+  event["next"] = 43
+  return event
+`,
+		want: `{"action":"opened","next":43}`,
+	}, {
+		name: "arithmetic",
+		script: `
+def transform(event):
+  issue = event["issue"]
+  return [issue["number"] // 5, issue["score"] * 3, 1 << 70]
+`,
+		want: `[8,1.5,1180591620717411303424]`,
+	}, {
+		name: "none filters",
+		script: `
+def transform(event):
+  if event["action"] != "closed":
+    return None
+  return event
+`,
+		want: `null`,
+	}, {
+		name: "scalar",
+		script: `
+def transform(event):
+  return "issue %d was %s" % (event["issue"]["number"], event["action"])
+`,
+		want: `"issue 42 was opened"`,
+	}, {
+		name: "event data model",
+		script: `
+def transform(event):
+  return {"type": event["ce"]["type"], "action": event["data"]["action"]}
+`,
+		opts: []Option{WithDataModel(Event)},
+		ctx: &cloudevents.EventContext{
+			EventType: "dev.knative.source.github.issues",
+		},
+		want: `{"action":"opened","type":"dev.knative.source.github.issues"}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := CompileScript(test.script, test.opts...)
+			if err != nil {
+				t.Fatalf("CompileScript() = %v", err)
+			}
+			got, err := m.Mutate(test.ctx, input)
+			if err != nil {
+				t.Fatalf("m.Mutate() = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("m.Mutate() = %v, wanted %v", string(got), test.want)
+			}
+		})
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	for _, script := range []string{
+		`def transform(event):`,
+		`x = 1`,
+		`transform = 1`,
+		"def transform(a, b):\n  return a\n",
+		"load('other.star', 'f')\ndef transform(event):\n  return f(event)\n",
+		"def transform(event):\n  return undefined\n",
+		"fail('boom')\ndef transform(event):\n  return event\n",
+	} {
+		if m, err := CompileScript(script); err == nil {
+			t.Errorf("CompileScript(%q) = %v, wanted error", script, m)
+		}
+	}
+
+	for _, script := range []string{
+		"def transform(event):\n  fail('boom')\n",
+		"def transform(event):\n  return event['action'] + 1\n",
+		"def transform(event):\n  return event['missing']\n",
+		"def transform(event):\n  return {1: 'one'}\n",
+		"def transform(event):\n  return float('nan')\n",
+		"def transform(event):\n  return transform\n",
+		"def transform(event):\n  l = []\n  l.append(l)\n  return l\n",
+	} {
+		m, err := CompileScript(script)
+		if err != nil {
+			t.Fatalf("CompileScript(%q) = %v", script, err)
+		}
+		if got, err := m.Mutate(nil, map[string]interface{}{"action": "opened"}); err == nil {
+			t.Errorf("m.Mutate(%q) = %s, wanted error", script, got)
+		}
+	}
+}
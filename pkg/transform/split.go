@@ -0,0 +1,106 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/knative/pkg/cloudevents"
+
+	"github.com/mattmoor/kfilter/pkg/fieldpath"
+)
+
+// Splitter transforms a cloud event into many.
+type Splitter interface {
+	// Split returns the bodies of the events that the event with the given
+	// context and decoded body is split into, in order.  Elements whose
+	// bodies are filtered are omitted.
+	Split(ctx *cloudevents.EventContext, body interface{}) ([][]byte, error)
+}
+
+// CompileSplit compiles a Splitter that produces an event for each element
+// of the array at the given path within the event body.  When the template
+// is empty, the elements are emitted as they are.  Otherwise the template is
+// executed for each element against an object with the element under
+// "item", its position under "index", the whole body under "data" and the
+// cloud event attributes under "ce" (e.g. {{ .item.id }} or
+// {{ .data.repository.name }}).  Of the options, the data model is ignored.
+func CompileSplit(path, tmpl string, opts ...Option) (Splitter, error) {
+	o := &options{format: YAML}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("split requires the path of an array")
+	}
+	s := &splitter{path: path, format: o.format}
+	if tmpl == "" {
+		return s, nil
+	}
+	m, err := Compile(tmpl, append(opts, WithDataModel(Body))...)
+	if err != nil {
+		return nil, err
+	}
+	s.m = m
+	return s, nil
+}
+
+type splitter struct {
+	path   string
+	format Format
+	m      Mutator
+}
+
+// splitter implements Splitter
+var _ Splitter = (*splitter)(nil)
+
+func (s *splitter) Split(ctx *cloudevents.EventContext, body interface{}) ([][]byte, error) {
+	v, ok := fieldpath.Get(body, s.path)
+	if !ok || v == nil {
+		// There is nothing to split.
+		return nil, nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array at %q, got: %T", s.path, v)
+	}
+
+	var results [][]byte
+	for i, item := range items {
+		var b []byte
+		var err error
+		if s.m == nil {
+			b, err = json.Marshal(item)
+		} else {
+			b, err = s.m.Mutate(ctx, map[string]interface{}{
+				"item":  item,
+				"index": i,
+				"data":  body,
+				"ce":    Attributes(ctx),
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %v", i, err)
+		}
+		if len(b) == 0 || (s.format != Text && string(b) == "null") {
+			continue
+		}
+		results = append(results, b)
+	}
+	return results, nil
+}
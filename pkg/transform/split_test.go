@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/knative/pkg/cloudevents"
+)
+
+func TestSplit(t *testing.T) {
+	input := map[string]interface{}{
+		"ref": "refs/heads/master",
+		"repository": map[string]interface{}{
+			"name": "kfilter",
+		},
+		"commits": []interface{}{
+			map[string]interface{}{"id": "abc", "message": "Fix: things"},
+			map[string]interface{}{"id": "def", "message": "Add stuff"},
+			map[string]interface{}{"id": "ghi", "message": "WIP"},
+		},
+	}
+	ctx := &cloudevents.EventContext{
+		EventID:   "1234",
+		EventType: "dev.knative.source.github.push",
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		template string
+		opts     []Option
+		want     []string
+	}{{
+		name: "elements as they are",
+		path: "commits",
+		want: []string{
+			`{"id":"abc","message":"Fix: things"}`,
+			`{"id":"def","message":"Add stuff"}`,
+			`{"id":"ghi","message":"WIP"}`,
+		},
+	}, {
+		name: "per element template",
+		path: "commits",
+		template: `commit: {{ .item.id }}
+index: {{ .index }}
+repo: {{ .data.repository.name }}
+type: {{ .ce.type }}`,
+		want: []string{
+			`{"commit":"abc","index":0,"repo":"kfilter","type":"dev.knative.source.github.push"}`,
+			`{"commit":"def","index":1,"repo":"kfilter","type":"dev.knative.source.github.push"}`,
+			`{"commit":"ghi","index":2,"repo":"kfilter","type":"dev.knative.source.github.push"}`,
+		},
+	}, {
+		name:     "auto escaped",
+		path:     "commits",
+		template: `message: {{ .item.message }}`,
+		opts:     []Option{WithAutoEscape()},
+		want: []string{
+			`{"message":"Fix: things"}`,
+			`{"message":"Add stuff"}`,
+			`{"message":"WIP"}`,
+		},
+	}, {
+		name:     "filtered elements",
+		path:     "commits",
+		template: `{{ if ne .item.message "WIP" }}id: {{ .item.id }}{{ end }}`,
+		want: []string{
+			`{"id":"abc"}`,
+			`{"id":"def"}`,
+		},
+	}, {
+		name:     "text",
+		path:     "commits",
+		template: `{{ .item.id }}`,
+		opts:     []Option{WithFormat(Text)},
+		want:     []string{`abc`, `def`, `ghi`},
+	}, {
+		name:     "ignores data model",
+		path:     "commits",
+		template: `{{ .item.id }}`,
+		opts:     []Option{WithFormat(JSON), WithAutoEscape(), WithDataModel(Event)},
+		want:     []string{`"abc"`, `"def"`, `"ghi"`},
+	}, {
+		name: "missing path",
+		path: "pull_request.commits",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := CompileSplit(test.path, test.template, test.opts...)
+			if err != nil {
+				t.Fatalf("CompileSplit() = %v", err)
+			}
+			results, err := s.Split(ctx, input)
+			if err != nil {
+				t.Fatalf("Split() = %v", err)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, string(r))
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("Split() = %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	if _, err := CompileSplit("commits", "{{ .item"); err == nil {
+		t.Error("CompileSplit() = nil, wanted error")
+	}
+	if _, err := CompileSplit("", ""); err == nil {
+		t.Error("CompileSplit() = nil, wanted error")
+	}
+
+	s, err := CompileSplit("ref", "")
+	if err != nil {
+		t.Fatalf("CompileSplit() = %v", err)
+	}
+	_, err = s.Split(nil, map[string]interface{}{"ref": "refs/heads/master"})
+	if err == nil || !strings.Contains(err.Error(), "expected an array") {
+		t.Errorf("Split() = %v, wanted expected an array", err)
+	}
+}
@@ -19,40 +19,149 @@ package transform
 import (
 	"bytes"
 	"encoding/json"
-	"github.com/ghodss/yaml"
+	"fmt"
 	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/knative/pkg/cloudevents"
 )
 
+// Mutator transforms the body of a cloud event.
 type Mutator interface {
-	Mutate(interface{}) ([]byte, error)
+	// Mutate returns the new body for the event with the given context and
+	// decoded body.  Unless the template renders Text, the body is JSON, and
+	// a result of "null" means the event should be filtered.  An empty
+	// result always means the event should be filtered.
+	Mutate(ctx *cloudevents.EventContext, body interface{}) ([]byte, error)
+}
+
+// Format is the syntax that a template renders.
+type Format string
+
+const (
+	// YAML templates render YAML, which is converted to JSON.
+	YAML Format = "YAML"
+
+	// JSON templates render JSON directly.
+	JSON Format = "JSON"
+
+	// Text templates render the body verbatim, e.g. plain text or XML.
+	Text Format = "Text"
+)
+
+type options struct {
+	format     Format
+	autoEscape bool
+	model      DataModel
+	libraries  map[string]string
+	secrets    Lookup
+	config     Lookup
+	limits     Limits
+}
+
+// Option configures how a template is compiled.
+type Option func(*options)
+
+// WithFormat sets the syntax the template renders (YAML by default).
+func WithFormat(f Format) Option {
+	return func(o *options) {
+		o.format = f
+	}
+}
+
+// WithAutoEscape makes every action in the template emit its value as a
+// properly escaped JSON scalar (which is also valid YAML), unless its
+// pipeline already ends in toJson, quote or raw.
+func WithAutoEscape() Option {
+	return func(o *options) {
+		o.autoEscape = true
+	}
+}
+
+// WithDataModel sets what the template is executed against (the event
+// Body by default).
+func WithDataModel(m DataModel) Option {
+	return func(o *options) {
+		o.model = m
+	}
+}
+
+// WithLibraries makes the given templates (keyed by name) available to
+// the template, e.g. via {{ template "name" . }}, along with any templates
+// they define.  Invoking a template that doesn't exist is a compile error.
+func WithLibraries(libraries map[string]string) Option {
+	return func(o *options) {
+		o.libraries = libraries
+	}
 }
 
-func Compile(tmpl string) (Mutator, error) {
+func Compile(tmpl string, opts ...Option) (Mutator, error) {
+	o := &options{format: YAML, model: Body}
+	for _, opt := range opts {
+		opt(o)
+	}
+	switch o.format {
+	case YAML, JSON, Text:
+	default:
+		return nil, fmt.Errorf("unsupported template format: %q", o.format)
+	}
+	switch o.model {
+	case Body, Event:
+	default:
+		return nil, fmt.Errorf("unsupported data model: %q", o.model)
+	}
+
 	// Create a new template and parse the letter into it.
-	t, err := template.New("compiled").Parse(tmpl)
+	t, err := newTemplate("compiled", tmpl, o)
 	if err != nil {
 		return nil, err
 	}
+	if o.autoEscape {
+		autoEscape(t)
+	}
+	if o.limits.instrumented() {
+		instrument(t)
+	}
 
-	return &blah{t: t}, nil
+	return &blah{t: t, format: o.format, model: o.model, limits: o.limits}, nil
 }
 
 type blah struct {
-	t *template.Template
+	t      *template.Template
+	format Format
+	model  DataModel
+	limits Limits
 }
 
 // blah implements Mutator
 var _ Mutator = (*blah)(nil)
 
-func (b *blah) Mutate(body interface{}) ([]byte, error) {
+func (b *blah) Mutate(ctx *cloudevents.EventContext, body interface{}) ([]byte, error) {
 	buf := bytes.NewBuffer(nil)
-	if err := b.t.Execute(buf, body); err != nil {
+	if err := execute(b.t, buf, Input(b.model, ctx, body), b.limits); err != nil {
 		return nil, err
 	}
 
-	var newBody map[string]interface{}
-	if err := yaml.Unmarshal(buf.Bytes(), &newBody); err != nil {
-		return nil, err
+	var newBody interface{}
+	switch b.format {
+	case Text:
+		// An empty (or blank) result filters the event.
+		if len(bytes.TrimSpace(buf.Bytes())) == 0 {
+			return nil, nil
+		}
+		return buf.Bytes(), nil
+	case JSON:
+		// An empty result filters the event, as it does for YAML.
+		if len(bytes.TrimSpace(buf.Bytes())) == 0 {
+			break
+		}
+		if err := json.Unmarshal(buf.Bytes(), &newBody); err != nil {
+			return nil, err
+		}
+	default:
+		if err := yaml.Unmarshal(buf.Bytes(), &newBody); err != nil {
+			return nil, err
+		}
 	}
 
 	// Return the final result as serialized JSON
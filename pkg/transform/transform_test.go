@@ -18,12 +18,17 @@ package transform
 
 import (
 	"testing"
+	"time"
+
+	"github.com/knative/pkg/cloudevents"
 )
 
 func TestTransforms(t *testing.T) {
 	tests := []struct {
 		name     string
 		template string
+		opts     []Option
+		ctx      *cloudevents.EventContext
 		input    interface{}
 		want     string
 	}{{
@@ -107,15 +112,217 @@ comments:
 			},
 		},
 		want: `null`,
+	}, {
+		name: "template functions",
+		template: `
+login: {{ upper .login }}
+tags: {{ toJson (list "a" "b") }}
+encoded: {{ b64enc .login }}`,
+		input: map[string]interface{}{
+			"login": "mattmoor",
+		},
+		want: `{"encoded":"bWF0dG1vb3I=","login":"MATTMOOR","tags":["a","b"]}`,
+	}, {
+		name:     "auto-escaped special characters",
+		template: `foo: {{ .asdf }}`,
+		opts:     []Option{WithAutoEscape()},
+		input: map[string]interface{}{
+			"asdf": "bar: baz\n- qux # not a comment",
+		},
+		want: `{"foo":"bar: baz\n- qux # not a comment"}`,
+	}, {
+		name: "auto-escaped types are preserved",
+		template: `
+str: {{ .str }}
+num: {{ .num }}
+list: {{ .list }}
+nil: {{ .missing }}`,
+		opts: []Option{WithAutoEscape()},
+		input: map[string]interface{}{
+			"str":  "007",
+			"num":  float64(7),
+			"list": []interface{}{"yes", true},
+		},
+		want: `{"list":["yes",true],"nil":null,"num":7,"str":"007"}`,
+	}, {
+		name: "auto-escaped control structures and definitions",
+		template: `
+{{ define "author" }}{{ .author }}{{ end }}
+{{ if .comments }}
+first: {{ template "author" index .comments 0 }}
+comments:
+{{ range .comments }}
+- {{ .body }}
+{{ end }}
+{{ end }}`,
+		opts: []Option{WithAutoEscape()},
+		input: map[string]interface{}{
+			"comments": []interface{}{
+				map[string]interface{}{
+					"author": "mattmoor",
+					"body":   "yes: no",
+				},
+			},
+		},
+		want: `{"comments":["yes: no"],"first":"mattmoor"}`,
+	}, {
+		name:     "auto-escape skips escaped pipelines",
+		template: `{ "a": {{ .a | toJson }}, "b": {{ quote .b }}, "c": {{ .c | raw }} }`,
+		opts:     []Option{WithAutoEscape()},
+		input: map[string]interface{}{
+			"a": "x",
+			"b": 1,
+			"c": "[1, 2]",
+		},
+		want: `{"a":"x","b":"1","c":[1,2]}`,
+	}, {
+		name:     "json format",
+		template: `{"foo": {{ toJson .asdf }}, "bar": [{{ .num }}]}`,
+		opts:     []Option{WithFormat(JSON)},
+		input: map[string]interface{}{
+			"asdf": "a: b",
+			"num":  float64(3),
+		},
+		want: `{"bar":[3],"foo":"a: b"}`,
+	}, {
+		name:     "json format with auto-escaping",
+		template: `{"foo": {{ .asdf }}}`,
+		opts:     []Option{WithFormat(JSON), WithAutoEscape()},
+		input: map[string]interface{}{
+			"asdf": "\"quoted\"\n",
+		},
+		want: `{"foo":"\"quoted\"\n"}`,
+	}, {
+		name:     "json format filter",
+		template: `{{ if .keep }}{"foo": "bar"}{{ end }}`,
+		opts:     []Option{WithFormat(JSON)},
+		input:    map[string]interface{}{},
+		want:     `null`,
+	}, {
+		name: "event data model",
+		template: `
+id: {{ .ce.id | quote }}
+type: {{ .ce.type }}
+source: {{ .ce.source }}
+time: {{ .ce.time | quote }}
+delivery: {{ .ce.extensions.delivery }}
+action: {{ .data.action }}`,
+		opts: []Option{WithDataModel(Event)},
+		ctx: &cloudevents.EventContext{
+			CloudEventsVersion: "0.1",
+			EventID:            "1234",
+			EventType:          "dev.knative.source.github.issues",
+			EventTime:          time.Date(2018, 11, 5, 13, 30, 0, 0, time.UTC),
+			Source:             "https://github.com/mattmoor/kfilter",
+			Extensions: map[string]interface{}{
+				"delivery": "abcd",
+			},
+		},
+		input: map[string]interface{}{
+			"action": "opened",
+		},
+		want: `{"action":"opened","delivery":"abcd","id":"1234","source":"https://github.com/mattmoor/kfilter","time":"2018-11-05T13:30:00Z","type":"dev.knative.source.github.issues"}`,
+	}, {
+		name:     "event data model without context",
+		template: `{"type": {{ .ce.type }}, "body": {{ .data }}}`,
+		opts:     []Option{WithDataModel(Event), WithFormat(JSON), WithAutoEscape()},
+		input: map[string]interface{}{
+			"action": "opened",
+		},
+		want: `{"body":{"action":"opened"},"type":""}`,
+	}, {
+		name:     "body data model ignores the context",
+		template: `action: {{ .action }}`,
+		opts:     []Option{WithDataModel(Body)},
+		ctx: &cloudevents.EventContext{
+			EventType: "dev.knative.source.github.issues",
+		},
+		input: map[string]interface{}{
+			"action": "opened",
+		},
+		want: `{"action":"opened"}`,
+	}, {
+		name: "list result",
+		template: `
+{{ range .comments }}
+- {{ .author }}
+{{ end }}`,
+		input: map[string]interface{}{
+			"comments": []interface{}{
+				map[string]interface{}{"author": "mattmoor"},
+				map[string]interface{}{"author": "jonjohnsonjr"},
+			},
+		},
+		want: `["mattmoor","jonjohnsonjr"]`,
+	}, {
+		name:     "string result",
+		template: `{{ .action | quote }}`,
+		input: map[string]interface{}{
+			"action": "opened",
+		},
+		want: `"opened"`,
+	}, {
+		name:     "number result",
+		template: `[{{ .number }}]`,
+		opts:     []Option{WithFormat(JSON)},
+		input: map[string]interface{}{
+			"number": float64(42),
+		},
+		want: `[42]`,
+	}, {
+		name:     "text result",
+		template: `Issue #{{ .number }}: {{ .title }}`,
+		opts:     []Option{WithFormat(Text)},
+		input: map[string]interface{}{
+			"number": float64(42),
+			"title":  "it: broke",
+		},
+		want: `Issue #42: it: broke`,
+	}, {
+		name:     "text filter",
+		template: `{{ if .keep }}kept{{ end }}`,
+		opts:     []Option{WithFormat(Text)},
+		input:    map[string]interface{}{},
+		want:     ``,
+	}, {
+		name:     "library definitions",
+		template: `user: {{ template "user" .sender }}`,
+		opts: []Option{WithLibraries(map[string]string{
+			"github": `{{ define "user" }}{{ .login | upper }}{{ end }}`,
+		})},
+		input: map[string]interface{}{
+			"sender": map[string]interface{}{"login": "octocat"},
+		},
+		want: `{"user":"OCTOCAT"}`,
+	}, {
+		name:     "library by name",
+		template: `{{ template "header" . }}number: {{ .number }}`,
+		opts: []Option{WithLibraries(map[string]string{
+			"header": "kind: issue\n",
+		})},
+		input: map[string]interface{}{
+			"number": float64(42),
+		},
+		want: `{"kind":"issue","number":42}`,
+	}, {
+		name:     "auto-escaped library",
+		template: `title: {{ template "title" . }}`,
+		opts: []Option{WithAutoEscape(), WithLibraries(map[string]string{
+			"title": `{{ .title }}`,
+		})},
+		input: map[string]interface{}{
+			"title": "it: broke",
+		},
+		want: `{"title":"it: broke"}`,
 	}}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			m, err := Compile(test.template)
+			m, err := Compile(test.template, test.opts...)
 			if err != nil {
 				t.Fatalf("Compile() = %v", err)
 			}
-			got, err := m.Mutate(test.input)
+			got, err := m.Mutate(test.ctx, test.input)
 			if err != nil {
 				t.Fatalf("m.Mutate() = %v", err)
 			}
@@ -125,3 +332,72 @@ comments:
 		})
 	}
 }
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		opts     []Option
+	}{{
+		name:     "bad template",
+		template: `{{ .foo`,
+	}, {
+		name:     "unknown function",
+		template: `{{ env "HOME" }}`,
+	}, {
+		name:     "unsupported format",
+		template: `foo: bar`,
+		opts:     []Option{WithFormat("TOML")},
+	}, {
+		name:     "unsupported data model",
+		template: `foo: bar`,
+		opts:     []Option{WithDataModel("Request")},
+	}, {
+		name:     "bad library",
+		template: `foo: bar`,
+		opts: []Option{WithLibraries(map[string]string{
+			"broken": `{{ define "foo" }}`,
+		})},
+	}, {
+		name:     "missing library",
+		template: `foo: {{ template "nope" . }}`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if m, err := Compile(test.template, test.opts...); err == nil {
+				t.Errorf("Compile() = %v, wanted error", m)
+			}
+		})
+	}
+}
+
+func TestMutateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		opts     []Option
+	}{{
+		name:     "invalid yaml",
+		template: `foo: {{ .asdf }}`,
+	}, {
+		name:     "invalid json",
+		template: `{"foo": {{ .asdf }}}`,
+		opts:     []Option{WithFormat(JSON)},
+	}}
+
+	input := map[string]interface{}{
+		"asdf": "[unterminated",
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Compile(test.template, test.opts...)
+			if err != nil {
+				t.Fatalf("Compile() = %v", err)
+			}
+			if got, err := m.Mutate(nil, input); err == nil {
+				t.Errorf("m.Mutate() = %s, wanted error", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// Lookup returns the value of the given key of the named object (e.g. a
+// Secret or ConfigMap).
+type Lookup func(name, key string) (string, error)
+
+// WithSecrets sets how templates look up {{ secret "name" "key" }}.
+// Without it, templates that call secret fail when they are executed.
+func WithSecrets(l Lookup) Option {
+	return func(o *options) {
+		o.secrets = l
+	}
+}
+
+// WithConfig sets how templates look up {{ config "name" "key" }}.
+// Without it, templates that call config fail when they are executed.
+func WithConfig(l Lookup) Option {
+	return func(o *options) {
+		o.config = l
+	}
+}
+
+// MapLookup returns a Lookup that reads the given values, keyed by the name
+// of their object and then by their key.  The kind (e.g. "secret") is used
+// in errors about missing values.
+func MapLookup(kind string, values map[string]map[string]string) Lookup {
+	return func(name, key string) (string, error) {
+		v, ok := values[name][key]
+		if !ok {
+			return "", fmt.Errorf("%s %q has no key %q available", kind, name, key)
+		}
+		return v, nil
+	}
+}
+
+// valueFuncs returns the secret and config functions for the given
+// options.
+func valueFuncs(o *options) template.FuncMap {
+	secrets, config := o.secrets, o.config
+	if secrets == nil {
+		secrets = MapLookup("secret", nil)
+	}
+	if config == nil {
+		config = MapLookup("config", nil)
+	}
+	return template.FuncMap{
+		"secret": secrets,
+		"config": config,
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Matt Moore
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValues(t *testing.T) {
+	secrets := MapLookup("secret", map[string]map[string]string{
+		"tokens": {"github": "s3cr3t"},
+	})
+	config := MapLookup("config", map[string]map[string]string{
+		"tenant": {"id": "acme"},
+	})
+
+	tests := []struct {
+		name     string
+		template string
+		opts     []Option
+		want     string
+		wantErr  string
+	}{{
+		name:     "secret",
+		template: `token: {{ secret "tokens" "github" }}`,
+		opts:     []Option{WithSecrets(secrets)},
+		want:     `{"token":"s3cr3t"}`,
+	}, {
+		name:     "config",
+		template: `tenant: {{ config "tenant" "id" }}`,
+		opts:     []Option{WithConfig(config)},
+		want:     `{"tenant":"acme"}`,
+	}, {
+		name:     "missing key",
+		template: `token: {{ secret "tokens" "gitlab" }}`,
+		opts:     []Option{WithSecrets(secrets)},
+		wantErr:  `secret "tokens" has no key "gitlab" available`,
+	}, {
+		name:     "missing object",
+		template: `tenant: {{ config "tenants" "id" }}`,
+		opts:     []Option{WithConfig(config)},
+		wantErr:  `config "tenants" has no key "id" available`,
+	}, {
+		name:     "no secrets",
+		template: `token: {{ secret "tokens" "github" }}`,
+		opts:     []Option{WithConfig(config)},
+		wantErr:  `secret "tokens" has no key "github" available`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Compile(test.template, test.opts...)
+			if err != nil {
+				t.Fatalf("Compile() = %v", err)
+			}
+			got, err := m.Mutate(nil, map[string]interface{}{})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("Mutate() = %v, wanted %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Mutate() = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("Mutate() = %s, wanted %s", got, test.want)
+			}
+		})
+	}
+}